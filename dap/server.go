@@ -0,0 +1,406 @@
+package dap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/cgrunewald/golox/debug"
+	"github.com/cgrunewald/golox/interpreter"
+	"github.com/cgrunewald/golox/lsp"
+)
+
+// The interpreter runs a single thread.
+const threadID = 1
+
+// Server is a debug adapter for Lox scripts run by the tree walking
+// interpreter. Requests are handled one at a time by the goroutine running
+// Serve, while another forwards the events of the running program.
+type Server struct {
+	conn *lsp.Conn
+
+	mu      sync.Mutex
+	seq     int
+	stopped bool
+
+	breakpoints map[string][]int
+	session     *debug.Session
+	program     []interpreter.Stmt
+	source      string
+	path        string
+	stopOnEntry bool
+	configured  bool
+	started     bool
+	exited      chan struct{}
+
+	// Valid while the program is stopped. A variables reference indexes
+	// references, offset by one so that zero means no children.
+	frames     []debug.Frame
+	references []interface{}
+}
+
+func NewServer() *Server {
+	return &Server{breakpoints: make(map[string][]int), exited: make(chan struct{})}
+}
+
+// Serve answers the requests read from r on w until the client disconnects or
+// closes the connection.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = lsp.NewConn(r, w)
+	defer s.terminate()
+
+	for {
+		body, err := s.conn.ReadRaw()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		request := &Message{}
+		if err := json.Unmarshal(body, request); err != nil || request.Type != TYPE_REQUEST {
+			continue
+		}
+
+		result, err := s.dispatch(request)
+		if err := s.respond(request, result, err); err != nil {
+			return err
+		}
+
+		switch request.Command {
+		case "initialize":
+			s.send(&Message{Type: TYPE_EVENT, Event: "initialized"})
+		case "disconnect":
+			return nil
+		}
+		s.start()
+	}
+}
+
+func (s *Server) dispatch(request *Message) (interface{}, error) {
+	switch request.Command {
+	case "initialize":
+		return Capabilities{SupportsConfigurationDoneRequest: true, SupportsTerminateRequest: true}, nil
+	case "launch":
+		args := LaunchArguments{}
+		if err := decode(request, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		args := SetBreakpointsArguments{}
+		if err := decode(request, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+	case "configurationDone":
+		s.configured = true
+		return nil, nil
+	case "threads":
+		return ThreadsResponse{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		return s.stackTrace()
+	case "scopes":
+		args := ScopesArguments{}
+		if err := decode(request, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args.FrameID)
+	case "variables":
+		args := VariablesArguments{}
+		if err := decode(request, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference)
+	case "continue":
+		return ContinueResponse{AllThreadsContinued: true}, s.resume((*debug.Session).Continue)
+	case "next":
+		return nil, s.resume((*debug.Session).StepOver)
+	case "stepIn":
+		return nil, s.resume((*debug.Session).StepIn)
+	case "stepOut":
+		return nil, s.resume((*debug.Session).StepOut)
+	case "pause":
+		if s.session != nil {
+			s.session.Pause()
+		}
+		return nil, nil
+	case "terminate", "disconnect":
+		s.terminate()
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("Unknown command '%s'", request.Command)
+}
+
+func decode(request *Message, args interface{}) error {
+	if len(request.Arguments) == 0 {
+		return nil
+	}
+	return json.Unmarshal(request.Arguments, args)
+}
+
+func (s *Server) respond(request *Message, result interface{}, err error) error {
+	response := &Message{Type: TYPE_RESPONSE, RequestSeq: request.Seq, Command: request.Command, Success: err == nil}
+	if err != nil {
+		response.Message = err.Error()
+	} else if result != nil {
+		body, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		response.Body = body
+	}
+	return s.send(response)
+}
+
+func (s *Server) event(event string, body interface{}) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return s.send(&Message{Type: TYPE_EVENT, Event: event, Body: raw})
+}
+
+// send numbers and writes a message. Events come from the program's goroutine
+// as well as the one serving requests.
+func (s *Server) send(message *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	message.Seq = s.seq
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return s.conn.WriteRaw(body)
+}
+
+// launch compiles the program. It starts once the client is done configuring
+// breakpoints.
+func (s *Server) launch(args LaunchArguments) error {
+	if s.session != nil {
+		return errors.New("A program is already running")
+	}
+
+	contents, err := os.ReadFile(args.Program)
+	if err != nil {
+		return fmt.Errorf("Could not read file '%s'", args.Program)
+	}
+
+	s.source = string(contents)
+	s.path = args.Program
+	s.stopOnEntry = args.StopOnEntry
+
+	interp := interpreter.NewInterpreter(interpreter.InterpreterConfig{
+		ScriptPath: args.Program,
+		PrintFunc: func(value string) {
+			s.event("output", OutputEvent{Category: "stdout", Output: value + "\n"})
+		},
+	})
+
+	program, errs := interpreter.Compile(s.source, interpreter.NewResolver(interp))
+	if len(errs) > 0 {
+		for _, err := range errs {
+			s.event("output", OutputEvent{Category: "stderr", Output: interpreter.Diagnostic(s.source, s.path, err)})
+		}
+		return errors.New(interpreter.ErrorCount(errs))
+	}
+
+	s.program = program
+	s.session = debug.NewSession(interp)
+	for path, lines := range s.breakpoints {
+		s.session.SetBreakpoints(path, lines)
+	}
+	return nil
+}
+
+// start runs the program once it is launched and configured.
+func (s *Server) start() {
+	if s.started || s.session == nil || !s.configured {
+		return
+	}
+
+	s.started = true
+	s.session.Start(s.program, s.stopOnEntry)
+	go s.forward()
+}
+
+// forward reports the program stopping and exiting to the client.
+func (s *Server) forward() {
+	defer close(s.exited)
+
+	for event := range s.session.Events() {
+		if !event.Exited {
+			s.mu.Lock()
+			s.stopped = true
+			s.mu.Unlock()
+
+			s.event("stopped", StoppedEvent{Reason: event.Reason, ThreadID: threadID, AllThreadsStopped: true})
+			continue
+		}
+
+		s.mu.Lock()
+		s.stopped = false
+		s.mu.Unlock()
+
+		exitCode := 0
+		if event.Err != nil && event.Err != debug.ErrTerminated {
+			exitCode = 1
+			s.event("output", OutputEvent{Category: "stderr", Output: interpreter.Diagnostic(s.source, s.path, event.Err)})
+		}
+		s.event("exited", ExitedEvent{ExitCode: exitCode})
+		s.event("terminated", struct{}{})
+	}
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) SetBreakpointsResponse {
+	lines := make([]int, 0, len(args.Breakpoints))
+	breakpoints := make([]Breakpoint, 0, len(args.Breakpoints))
+	for _, breakpoint := range args.Breakpoints {
+		lines = append(lines, breakpoint.Line)
+		breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: breakpoint.Line, Source: args.Source})
+	}
+
+	s.breakpoints[args.Source.Path] = lines
+	if s.session != nil {
+		s.session.SetBreakpoints(args.Source.Path, lines)
+	}
+	return SetBreakpointsResponse{Breakpoints: breakpoints}
+}
+
+// isStopped reports whether the program is stopped, so it may be inspected
+// and resumed.
+func (s *Server) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+func (s *Server) resume(resume func(*debug.Session)) error {
+	if !s.isStopped() {
+		return errors.New("The program is not stopped")
+	}
+
+	s.mu.Lock()
+	s.stopped = false
+	s.mu.Unlock()
+
+	s.frames = nil
+	s.references = nil
+	resume(s.session)
+	return nil
+}
+
+func (s *Server) terminate() {
+	if s.session == nil || !s.started {
+		return
+	}
+
+	s.session.Terminate()
+	<-s.exited
+	s.session = nil
+}
+
+func (s *Server) stackTrace() (interface{}, error) {
+	if !s.isStopped() {
+		return nil, errors.New("The program is not stopped")
+	}
+
+	if s.frames == nil {
+		s.frames = s.session.Frames()
+	}
+
+	frames := make([]StackFrame, 0, len(s.frames))
+	for idx, frame := range s.frames {
+		frames = append(frames, StackFrame{
+			ID:     idx + 1,
+			Name:   frame.Name,
+			Source: Source{Name: filepath.Base(frame.File), Path: frame.File},
+			Line:   frame.Line,
+			Column: 1,
+		})
+	}
+	return StackTraceResponse{StackFrames: frames, TotalFrames: len(frames)}, nil
+}
+
+func (s *Server) scopes(frameID int) (interface{}, error) {
+	if !s.isStopped() || frameID < 1 || frameID > len(s.frames) {
+		return nil, fmt.Errorf("Unknown frame %d", frameID)
+	}
+
+	scopes := make([]Scope, 0)
+	for _, scope := range s.frames[frameID-1].Scopes() {
+		scopes = append(scopes, Scope{Name: scope.Name, VariablesReference: s.reference(scope.Variables)})
+	}
+	return ScopesResponse{Scopes: scopes}, nil
+}
+
+// reference hands out a variables reference for a value with children.
+func (s *Server) reference(value interface{}) int {
+	s.references = append(s.references, value)
+	return len(s.references)
+}
+
+func (s *Server) variables(reference int) (interface{}, error) {
+	if !s.isStopped() || reference < 1 || reference > len(s.references) {
+		return nil, fmt.Errorf("Unknown variables reference %d", reference)
+	}
+
+	variables := make([]Variable, 0)
+	add := func(name string, value interface{}) {
+		variables = append(variables, s.variable(name, value))
+	}
+
+	switch value := s.references[reference-1].(type) {
+	case []debug.Variable:
+		for _, variable := range value {
+			add(variable.Name, variable.Value)
+		}
+	case *interpreter.KlassInstance:
+		properties := value.Properties()
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(name, properties[name])
+		}
+	case *interpreter.LoxList:
+		for idx, element := range value.Elements() {
+			add(fmt.Sprintf("[%d]", idx), element)
+		}
+	case *interpreter.LoxMap:
+		values := value.Values()
+		for idx, key := range value.Keys() {
+			add(fmt.Sprintf("[%s]", debug.Format(key)), values[idx])
+		}
+	}
+	return VariablesResponse{Variables: variables}, nil
+}
+
+func (s *Server) variable(name string, value interface{}) Variable {
+	variable := Variable{Name: name, Value: debug.Format(value), Type: interpreter.TypeOf(value)}
+	switch value := value.(type) {
+	case *interpreter.KlassInstance:
+		if len(value.Properties()) > 0 {
+			variable.VariablesReference = s.reference(value)
+		}
+	case *interpreter.LoxList:
+		if len(value.Elements()) > 0 {
+			variable.VariablesReference = s.reference(value)
+		}
+	case *interpreter.LoxMap:
+		if value.Len() > 0 {
+			variable.VariablesReference = s.reference(value)
+		}
+	}
+	return variable
+}
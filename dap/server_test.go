@@ -0,0 +1,366 @@
+package dap
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cgrunewald/golox/lsp"
+)
+
+// testClient drives a server running in-process over pipes, the way an
+// editor drives it over stdio.
+type testClient struct {
+	t        *testing.T
+	conn     *lsp.Conn
+	seq      int
+	messages chan *Message
+	events   []*Message
+	done     chan error
+	close    func()
+}
+
+func newTestClient(t *testing.T) *testClient {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	c := &testClient{
+		t:        t,
+		conn:     lsp.NewConn(clientReader, clientWriter),
+		messages: make(chan *Message, 64),
+		done:     make(chan error, 1),
+		close: func() {
+			clientWriter.Close()
+			clientReader.Close()
+		},
+	}
+
+	go func() {
+		c.done <- NewServer().Serve(serverReader, serverWriter)
+		serverWriter.Close()
+	}()
+
+	go func() {
+		defer close(c.messages)
+		for {
+			body, err := c.conn.ReadRaw()
+			if err != nil {
+				return
+			}
+			message := &Message{}
+			json.Unmarshal(body, message)
+			c.messages <- message
+		}
+	}()
+
+	return c
+}
+
+func (c *testClient) next() *Message {
+	select {
+	case message, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("connection closed")
+		}
+		return message
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("timed out waiting for the server")
+	}
+	return nil
+}
+
+// request sends a request and returns its response, keeping the events that
+// arrive in the meantime.
+func (c *testClient) request(command string, args interface{}) *Message {
+	c.t.Helper()
+	c.seq++
+	raw, _ := json.Marshal(args)
+	body, _ := json.Marshal(&Message{Seq: c.seq, Type: TYPE_REQUEST, Command: command, Arguments: raw})
+	if err := c.conn.WriteRaw(body); err != nil {
+		c.t.Fatalf("write failed: %v", err)
+	}
+
+	for {
+		message := c.next()
+		if message.Type == TYPE_EVENT {
+			c.events = append(c.events, message)
+			continue
+		}
+		if message.RequestSeq != c.seq || message.Command != command {
+			c.t.Fatalf("unexpected response %+v", message)
+		}
+		return message
+	}
+}
+
+// call sends a request that must succeed and decodes its body into result.
+func (c *testClient) call(command string, args interface{}, result interface{}) {
+	c.t.Helper()
+	response := c.request(command, args)
+	if !response.Success {
+		c.t.Fatalf("%s failed: %s", command, response.Message)
+	}
+	if result != nil {
+		if err := json.Unmarshal(response.Body, result); err != nil {
+			c.t.Fatalf("could not decode %s: %v", response.Body, err)
+		}
+	}
+}
+
+// event waits for the next event named name and decodes its body into body.
+func (c *testClient) event(name string, body interface{}) {
+	c.t.Helper()
+	for {
+		var message *Message
+		if len(c.events) > 0 {
+			message, c.events = c.events[0], c.events[1:]
+		} else {
+			message = c.next()
+		}
+
+		if message.Type == TYPE_EVENT && message.Event == name {
+			if body != nil {
+				json.Unmarshal(message.Body, body)
+			}
+			return
+		}
+	}
+}
+
+func (c *testClient) expectStop(reason string) {
+	c.t.Helper()
+	stopped := StoppedEvent{}
+	c.event("stopped", &stopped)
+	if stopped.Reason != reason || stopped.ThreadID != threadID {
+		c.t.Fatalf("expected a %s stop, got %+v", reason, stopped)
+	}
+}
+
+// stack returns the frames of the stopped program, innermost first.
+func (c *testClient) stack() []StackFrame {
+	c.t.Helper()
+	trace := StackTraceResponse{}
+	c.call("stackTrace", StackTraceArguments{ThreadID: threadID}, &trace)
+	return trace.StackFrames
+}
+
+func (c *testClient) variables(reference int) map[string]Variable {
+	c.t.Helper()
+	response := VariablesResponse{}
+	c.call("variables", VariablesArguments{VariablesReference: reference}, &response)
+
+	variables := make(map[string]Variable)
+	for _, variable := range response.Variables {
+		variables[variable.Name] = variable
+	}
+	return variables
+}
+
+func (c *testClient) disconnect() {
+	c.call("disconnect", nil, nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			c.t.Errorf("server exited with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("server did not exit")
+	}
+	c.close()
+}
+
+// launch starts a session on source with breakpoints on the given lines.
+func launch(t *testing.T, source string, stopOnEntry bool, lines ...int) (*testClient, string) {
+	path := filepath.Join(t.TempDir(), "test.lox")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestClient(t)
+	capabilities := Capabilities{}
+	c.call("initialize", map[string]interface{}{"adapterID": "golox"}, &capabilities)
+	if !capabilities.SupportsConfigurationDoneRequest {
+		t.Errorf("expected configurationDone to be supported")
+	}
+	c.event("initialized", nil)
+
+	c.call("launch", LaunchArguments{Program: path, StopOnEntry: stopOnEntry}, nil)
+
+	breakpoints := make([]SourceBreakpoint, 0)
+	for _, line := range lines {
+		breakpoints = append(breakpoints, SourceBreakpoint{Line: line})
+	}
+	response := SetBreakpointsResponse{}
+	c.call("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}, Breakpoints: breakpoints}, &response)
+	if len(response.Breakpoints) != len(lines) {
+		t.Errorf("expected %d breakpoints, got %+v", len(lines), response.Breakpoints)
+	}
+
+	c.call("configurationDone", nil, nil)
+	return c, path
+}
+
+const program = `class Point {
+  fun init(x, y) {
+    this.x = x;
+    this.y = y;
+  }
+  fun norm() {
+    var squared = this.x * this.x + this.y * this.y;
+    return squared;
+  }
+}
+var origin = Point(0, [1, 2]);
+var p = Point(3, 4);
+print p.norm();
+`
+
+func TestBreakpointsAndVariables(t *testing.T) {
+	c, path := launch(t, program, false, 8)
+
+	c.expectStop("breakpoint")
+
+	threads := ThreadsResponse{}
+	c.call("threads", nil, &threads)
+	if len(threads.Threads) != 1 {
+		t.Errorf("expected a single thread, got %+v", threads)
+	}
+
+	stack := c.stack()
+	expected := []StackFrame{
+		{ID: 1, Name: "Point.norm", Source: Source{Name: "test.lox", Path: path}, Line: 8, Column: 1},
+		{ID: 2, Name: "<script>", Source: Source{Name: "test.lox", Path: path}, Line: 13, Column: 1},
+	}
+	if !reflect.DeepEqual(stack, expected) {
+		t.Fatalf("expected stack %+v, got %+v", expected, stack)
+	}
+
+	scopes := ScopesResponse{}
+	c.call("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	names := make([]string, 0)
+	for _, scope := range scopes.Scopes {
+		names = append(names, scope.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Locals", "Closure", "Globals"}) {
+		t.Fatalf("unexpected scopes %+v", scopes)
+	}
+
+	locals := c.variables(scopes.Scopes[0].VariablesReference)
+	if locals["squared"].Value != "25" || locals["squared"].Type != "number" {
+		t.Errorf("unexpected locals %+v", locals)
+	}
+
+	// The properties of instances, and the elements of lists, are children.
+	this := c.variables(scopes.Scopes[1].VariablesReference)["this"]
+	if this.Value != "Point instance" || this.VariablesReference == 0 {
+		t.Fatalf("unexpected this %+v", this)
+	}
+	properties := c.variables(this.VariablesReference)
+	if properties["x"].Value != "3" || properties["y"].Value != "4" || len(properties) != 2 {
+		t.Errorf("unexpected properties %+v", properties)
+	}
+
+	origin := c.variables(c.variables(scopes.Scopes[2].VariablesReference)["origin"].VariablesReference)
+	elements := c.variables(origin["y"].VariablesReference)
+	if elements["[0]"].Value != "1" || elements["[1]"].Value != "2" {
+		t.Errorf("unexpected elements %+v", elements)
+	}
+
+	c.call("continue", nil, nil)
+	output := OutputEvent{}
+	c.event("output", &output)
+	if output.Output != "25\n" || output.Category != "stdout" {
+		t.Errorf("unexpected output %+v", output)
+	}
+
+	exited := ExitedEvent{}
+	c.event("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("expected exit code 0, got %d", exited.ExitCode)
+	}
+	c.event("terminated", nil)
+
+	if response := c.request("stackTrace", StackTraceArguments{ThreadID: threadID}); response.Success {
+		t.Errorf("expected no stack once the program exited")
+	}
+	c.disconnect()
+}
+
+func TestStepping(t *testing.T) {
+	c, _ := launch(t, program, true)
+
+	lines := func() []int {
+		lines := make([]int, 0)
+		for _, frame := range c.stack() {
+			lines = append(lines, frame.Line)
+		}
+		return lines
+	}
+
+	steps := []struct {
+		command  string
+		expected []int
+	}{
+		{"next", []int{11}},
+		{"stepIn", []int{3, 11}},
+		{"stepIn", []int{4, 11}},
+		{"stepOut", []int{12}},
+		{"next", []int{13}},
+		{"stepIn", []int{7, 13}},
+	}
+
+	c.expectStop("entry")
+	for _, step := range steps {
+		c.call(step.command, map[string]int{"threadId": threadID}, nil)
+		c.expectStop("step")
+		if !reflect.DeepEqual(lines(), step.expected) {
+			t.Fatalf("after %s expected lines %v, got %v", step.command, step.expected, lines())
+		}
+	}
+
+	c.call("terminate", nil, nil)
+	c.event("terminated", nil)
+	c.disconnect()
+}
+
+func TestRuntimeError(t *testing.T) {
+	c, _ := launch(t, "var a = 1;\nprint a + nil;", false)
+
+	output := OutputEvent{}
+	c.event("output", &output)
+	if output.Category != "stderr" || output.Output == "" {
+		t.Errorf("expected the error on stderr, got %+v", output)
+	}
+
+	exited := ExitedEvent{}
+	c.event("exited", &exited)
+	if exited.ExitCode != 1 {
+		t.Errorf("expected exit code 1, got %d", exited.ExitCode)
+	}
+	c.disconnect()
+}
+
+func TestLaunchErrors(t *testing.T) {
+	c := newTestClient(t)
+	c.call("initialize", nil, nil)
+
+	if response := c.request("launch", LaunchArguments{Program: "missing.lox"}); response.Success {
+		t.Errorf("expected launching a missing file to fail")
+	}
+	if response := c.request("evaluate", nil); response.Success || response.Message != "Unknown command 'evaluate'" {
+		t.Errorf("unexpected response %+v", response)
+	}
+	c.disconnect()
+}
+
+func TestInvalidContentLength(t *testing.T) {
+	input := strings.NewReader("Content-Length: -1\r\n\r\n{}")
+	if err := NewServer().Serve(input, io.Discard); err == nil {
+		t.Errorf("expected serving to fail")
+	}
+}
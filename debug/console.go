@@ -0,0 +1,170 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cgrunewald/golox/interpreter"
+)
+
+const consoleHelp = `Commands:
+  break N, b N     stop at line N
+  delete N         remove the breakpoint at line N
+  continue, c      run until a breakpoint
+  step, s          run to the next line, stepping into calls
+  next, n          run to the next line, stepping over calls
+  finish, out      run until the current function returns
+  backtrace, bt    show the call stack
+  locals, vars     show the variables in scope
+  print NAME, p    show the value of a variable
+  list, l          show the source around the current line
+  quit, q          stop the program`
+
+// Console is a command line front end for a session on one script.
+type Console struct {
+	session *Session
+	path    string
+	lines   []string
+	in      *bufio.Scanner
+	out     io.Writer
+}
+
+func NewConsole(session *Session, path string, source string, in io.Reader, out io.Writer) *Console {
+	return &Console{
+		session: session,
+		path:    path,
+		lines:   strings.Split(source, "\n"),
+		in:      bufio.NewScanner(in),
+		out:     out,
+	}
+}
+
+// Run starts program stopped on its first statement and reads commands until
+// it exits. It returns the error the program exited with.
+func (c *Console) Run(program []interpreter.Stmt) error {
+	c.session.Start(program, true)
+	for event := range c.session.Events() {
+		if event.Exited {
+			if event.Err == nil {
+				fmt.Fprintln(c.out, "Program exited.")
+			}
+			return event.Err
+		}
+
+		fmt.Fprintf(c.out, "Stopped at %s:%d (%s)\n", event.File, event.Line, event.Reason)
+		c.list(event.File, event.Line, 0)
+		c.prompt()
+	}
+	return nil
+}
+
+// prompt runs commands until one resumes the program.
+func (c *Console) prompt() {
+	for {
+		fmt.Fprint(c.out, "(debug) ")
+		if !c.in.Scan() {
+			c.session.Terminate()
+			return
+		}
+
+		fields := strings.Fields(c.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		command, args := fields[0], fields[1:]
+		switch command {
+		case "continue", "c":
+			c.session.Continue()
+			return
+		case "step", "s":
+			c.session.StepIn()
+			return
+		case "next", "n":
+			c.session.StepOver()
+			return
+		case "finish", "out":
+			c.session.StepOut()
+			return
+		case "quit", "q":
+			c.session.Terminate()
+			return
+		case "break", "b", "delete":
+			c.breakpoint(command != "delete", args)
+		case "backtrace", "bt":
+			for idx, frame := range c.session.Frames() {
+				fmt.Fprintf(c.out, "#%d %s at %s:%d\n", idx, frame.Name, frame.File, frame.Line)
+			}
+		case "locals", "vars":
+			for _, scope := range c.session.Frames()[0].Scopes() {
+				if scope.Name == "Globals" {
+					continue
+				}
+				for _, variable := range scope.Variables {
+					fmt.Fprintf(c.out, "%s = %s\n", variable.Name, Format(variable.Value))
+				}
+			}
+		case "print", "p":
+			if len(args) != 1 {
+				fmt.Fprintln(c.out, "Usage: print NAME")
+			} else if value, ok := c.session.Frames()[0].Lookup(args[0]); ok {
+				fmt.Fprintf(c.out, "%s = %s\n", args[0], Format(value))
+			} else {
+				fmt.Fprintf(c.out, "Undefined variable '%s'\n", args[0])
+			}
+		case "list", "l":
+			frame := c.session.Frames()[0]
+			c.list(frame.File, frame.Line, 3)
+		case "help", "h":
+			fmt.Fprintln(c.out, consoleHelp)
+		default:
+			fmt.Fprintf(c.out, "Unknown command '%s', try 'help'\n", command)
+		}
+	}
+}
+
+func (c *Console) breakpoint(add bool, args []string) {
+	line, err := 0, fmt.Errorf("missing line")
+	if len(args) == 1 {
+		line, err = strconv.Atoi(args[0])
+	}
+	if err != nil || line < 1 || line > len(c.lines) {
+		fmt.Fprintln(c.out, "Expected a line number of the script")
+		return
+	}
+
+	lines := make([]int, 0)
+	for _, existing := range c.session.Breakpoints(c.path) {
+		if existing != line {
+			lines = append(lines, existing)
+		}
+	}
+	if add {
+		lines = append(lines, line)
+		fmt.Fprintf(c.out, "Breakpoint at %s:%d\n", c.path, line)
+	}
+	c.session.SetBreakpoints(c.path, lines)
+}
+
+// list prints the lines within context of line, marking line itself. Only
+// the script's own source is known.
+func (c *Console) list(file string, line int, context int) {
+	if file != c.path {
+		return
+	}
+
+	for number := line - context; number <= line+context; number++ {
+		if number < 1 || number > len(c.lines) {
+			continue
+		}
+
+		marker := " "
+		if number == line {
+			marker = ">"
+		}
+		fmt.Fprintf(c.out, "%s %4d | %s\n", marker, number, c.lines[number-1])
+	}
+}
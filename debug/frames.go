@@ -0,0 +1,141 @@
+package debug
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cgrunewald/golox/interpreter"
+)
+
+// Frame is a function call, or the script itself, on the stack of a stopped
+// program.
+type Frame struct {
+	Name string
+	File string
+	Line int
+
+	env    *interpreter.Environment
+	locals *interpreter.Environment
+}
+
+// Variable is a name bound in a scope.
+type Variable struct {
+	Name  string
+	Value interface{}
+}
+
+// Scope is a group of variables visible from a frame.
+type Scope struct {
+	Name      string
+	Variables []Variable
+}
+
+// Frames lists the stack of the stopped program, innermost first. The last
+// frame is the script.
+func (s *Session) Frames() []Frame {
+	callstack := s.interp.Callstack()
+	frames := make([]Frame, 0, len(callstack)+1)
+
+	env := s.interp.CurrentEnvironment()
+	line := s.stop.Line
+	file := s.stop.File
+	for idx := len(callstack) - 1; idx >= 0; idx-- {
+		activation := callstack[idx]
+		frames = append(frames, Frame{
+			Name:   frameName(activation.Frame),
+			File:   file,
+			Line:   line,
+			env:    env,
+			locals: activation.Locals,
+		})
+
+		// The caller stopped on the line making the call.
+		env, line, file = activation.Caller, activation.Frame.Line, activation.Frame.File
+	}
+
+	return append(frames, Frame{Name: "<script>", File: file, Line: line, env: env})
+}
+
+func frameName(frame interpreter.StackFrame) string {
+	if frame.Class != "" {
+		return frame.Class + "." + frame.Function
+	}
+	return frame.Function
+}
+
+// Scopes groups the variables visible from f: those of the call and the
+// blocks inside it, those it closes over, and the globals.
+func (f Frame) Scopes() []Scope {
+	locals := Scope{Name: "Locals"}
+	closure := Scope{Name: "Closure"}
+	globals := Scope{Name: "Globals"}
+
+	scope := &locals
+	for env := f.env; env != nil; env = env.Enclosing {
+		if env.Enclosing == nil {
+			globals.Variables = variables(globals.Variables, env, true)
+			break
+		}
+
+		scope.Variables = variables(scope.Variables, env, false)
+		if env == f.locals {
+			scope = &closure
+		}
+	}
+
+	scopes := []Scope{locals}
+	if f.locals != nil {
+		scopes = append(scopes, closure)
+	}
+	return append(scopes, globals)
+}
+
+// variables adds the values of env that are not shadowed by a variable found
+// already. The native functions every global scope starts with are skipped.
+func variables(found []Variable, env *interpreter.Environment, global bool) []Variable {
+	names := make([]string, 0, len(env.Values))
+	for name, value := range env.Values {
+		if _, ok := value.(*interpreter.NativeCallable); ok && global {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !hasVariable(found, name) {
+			found = append(found, Variable{Name: name, Value: env.Values[name]})
+		}
+	}
+	return found
+}
+
+func hasVariable(variables []Variable, name string) bool {
+	for _, variable := range variables {
+		if variable.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup finds the value name has in f.
+func (f Frame) Lookup(name string) (interface{}, bool) {
+	for env := f.env; env != nil; env = env.Enclosing {
+		if value, ok := env.Values[name]; ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Format renders a value the way it is written in Lox.
+func Format(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return fmt.Sprintf("%q", value)
+	}
+	return fmt.Sprintf("%v", value)
+}
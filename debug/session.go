@@ -0,0 +1,235 @@
+package debug
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/cgrunewald/golox/interpreter"
+)
+
+// Reasons a program stops.
+const (
+	STOP_ENTRY      = "entry"
+	STOP_BREAKPOINT = "breakpoint"
+	STOP_STEP       = "step"
+	STOP_PAUSE      = "pause"
+)
+
+type stepMode int32
+
+const (
+	STEP_NONE stepMode = iota
+	STEP_IN
+	STEP_OVER
+	STEP_OUT
+)
+
+// Event reports that the program stopped or exited. Err is set when it exited
+// with a runtime error.
+type Event struct {
+	Exited bool
+	Err    error
+
+	Reason string
+	File   string
+	Line   int
+}
+
+// ErrTerminated is the error a program exits with when the session is
+// terminated.
+var ErrTerminated = errors.New("debug: program terminated")
+
+type terminated struct{}
+
+// Session runs a program under a debugger. The program runs on its own
+// goroutine and stops before a statement when it reaches a breakpoint, after
+// a step or when paused. While it is stopped, Frames inspects it and one of
+// Continue, StepIn, StepOver, StepOut or Terminate resumes it.
+type Session struct {
+	interp *interpreter.Interpreter
+	events chan Event
+	resume chan stepMode
+
+	mu          sync.Mutex
+	breakpoints map[string]map[int]bool
+	pause       bool
+	terminate   bool
+	stopped     bool
+
+	// Only touched on the program's goroutine, or while it is stopped.
+	mode      stepMode
+	stepDepth int
+	stop      Event
+	lastStmt  interpreter.Stmt
+	lastLine  int
+	lastDepth int
+	lastFile  string
+}
+
+// NewSession attaches a session to interp.
+func NewSession(interp *interpreter.Interpreter) *Session {
+	s := &Session{
+		interp:      interp,
+		events:      make(chan Event),
+		resume:      make(chan stepMode),
+		breakpoints: make(map[string]map[int]bool),
+	}
+	interp.Attach(s)
+	return s
+}
+
+// Start runs program. With stopOnEntry it stops before the first statement.
+func (s *Session) Start(program []interpreter.Stmt, stopOnEntry bool) {
+	if stopOnEntry {
+		s.mode = STEP_IN
+	}
+
+	go func() {
+		var err error
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					if _, ok := r.(terminated); !ok {
+						panic(r)
+					}
+					err = ErrTerminated
+				}
+			}()
+			_, err = s.interp.Interpret(program)
+		}()
+
+		s.interp.Attach(nil)
+		s.events <- Event{Exited: true, Err: err}
+		close(s.events)
+	}()
+}
+
+// Events delivers an event each time the program stops, and a final one when
+// it exits.
+func (s *Session) Events() <-chan Event {
+	return s.events
+}
+
+// SetBreakpoints replaces the breakpoints in file. It may be called while the
+// program runs.
+func (s *Session) SetBreakpoints(file string, lines []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.breakpoints[file] = make(map[int]bool)
+	for _, line := range lines {
+		s.breakpoints[file][line] = true
+	}
+}
+
+// Breakpoints lists the lines with a breakpoint in file.
+func (s *Session) Breakpoints(file string) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lines := make([]int, 0, len(s.breakpoints[file]))
+	for line := range s.breakpoints[file] {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Pause stops the program at its next statement.
+func (s *Session) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pause = true
+}
+
+// Terminate ends the program at its next statement, or now if it is stopped.
+func (s *Session) Terminate() {
+	s.mu.Lock()
+	s.terminate = true
+	stopped := s.stopped
+	s.mu.Unlock()
+
+	if stopped {
+		s.resume <- STEP_NONE
+	}
+}
+
+func (s *Session) Continue() { s.resume <- STEP_NONE }
+func (s *Session) StepIn()   { s.resume <- STEP_IN }
+func (s *Session) StepOver() { s.resume <- STEP_OVER }
+func (s *Session) StepOut()  { s.resume <- STEP_OUT }
+
+func (s *Session) BeforeStatement(stmt interpreter.Stmt) {
+	// A block stops at its first statement instead.
+	if _, ok := stmt.(*interpreter.BlockStmt); ok {
+		return
+	}
+
+	line := stmt.Span().Start.Line
+	depth := s.interp.CallDepth()
+	file := s.interp.CurrentFile()
+
+	// Statements sharing a line are stepped over together, but a statement
+	// running again is a new iteration of a loop.
+	newLine := stmt == s.lastStmt || line != s.lastLine || depth != s.lastDepth || file != s.lastFile
+	s.lastStmt, s.lastLine, s.lastDepth, s.lastFile = stmt, line, depth, file
+
+	s.mu.Lock()
+	if s.terminate {
+		s.mu.Unlock()
+		panic(terminated{})
+	}
+
+	reason := ""
+	if s.pause {
+		reason = STOP_PAUSE
+	} else if newLine && s.breakpoints[file][line] {
+		reason = STOP_BREAKPOINT
+	} else if newLine {
+		reason = s.stepReason(depth)
+	}
+
+	if reason == "" {
+		s.mu.Unlock()
+		return
+	}
+
+	s.pause = false
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.stop = Event{Reason: reason, File: file, Line: line}
+	s.events <- s.stop
+	mode := <-s.resume
+
+	s.mu.Lock()
+	s.stopped = false
+	if s.terminate {
+		s.mu.Unlock()
+		panic(terminated{})
+	}
+	s.mu.Unlock()
+
+	s.mode = mode
+	s.stepDepth = depth
+}
+
+func (s *Session) stepReason(depth int) string {
+	switch s.mode {
+	case STEP_IN:
+		if s.stop.Line == 0 {
+			return STOP_ENTRY
+		}
+		return STOP_STEP
+	case STEP_OVER:
+		if depth <= s.stepDepth {
+			return STOP_STEP
+		}
+	case STEP_OUT:
+		if depth < s.stepDepth {
+			return STOP_STEP
+		}
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package debug
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cgrunewald/golox/interpreter"
+)
+
+const program = `fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+fun counter() {
+  var count = 0;
+  fun increment() {
+    count = count + 1;
+    return count;
+  }
+  return increment;
+}
+var inc = counter();
+var total = add(1, 2);
+inc();
+print total + inc();
+`
+
+type testSession struct {
+	*Session
+	t      *testing.T
+	output []string
+}
+
+func newTestSession(t *testing.T, source string, stopOnEntry bool, breakpoints ...int) *testSession {
+	s := &testSession{t: t}
+	interp := interpreter.NewInterpreter(interpreter.InterpreterConfig{
+		ScriptPath: "test.lox",
+		PrintFunc: func(value string) {
+			s.output = append(s.output, value)
+		},
+	})
+
+	stmts, errs := interpreter.Compile(source, interpreter.NewResolver(interp))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	s.Session = NewSession(interp)
+	s.SetBreakpoints("test.lox", breakpoints)
+	s.Start(stmts, stopOnEntry)
+	return s
+}
+
+func (s *testSession) next() Event {
+	select {
+	case event := <-s.Events():
+		return event
+	case <-time.After(5 * time.Second):
+		s.t.Fatalf("timed out waiting for the program")
+	}
+	return Event{}
+}
+
+// expectStop waits for the program to stop at line.
+func (s *testSession) expectStop(reason string, line int) {
+	s.t.Helper()
+	event := s.next()
+	if event.Exited || event.Reason != reason || event.Line != line || event.File != "test.lox" {
+		s.t.Fatalf("expected a %s stop at line %d, got %+v", reason, line, event)
+	}
+}
+
+func (s *testSession) expectExit() error {
+	s.t.Helper()
+	event := s.next()
+	if !event.Exited {
+		s.t.Fatalf("expected the program to exit, got %+v", event)
+	}
+	return event.Err
+}
+
+func (s *testSession) backtrace() []string {
+	frames := make([]string, 0)
+	for _, frame := range s.Frames() {
+		frames = append(frames, frame.Name+":"+Format(frame.Line))
+	}
+	return frames
+}
+
+func TestBreakpoints(t *testing.T) {
+	s := newTestSession(t, program, false, 2, 8)
+
+	s.expectStop(STOP_BREAKPOINT, 2)
+	if expected := []string{"add:2", "<script>:14"}; !reflect.DeepEqual(s.backtrace(), expected) {
+		t.Errorf("expected backtrace %v, got %v", expected, s.backtrace())
+	}
+
+	s.Continue()
+	s.expectStop(STOP_BREAKPOINT, 8)
+	if expected := []string{"increment:8", "<script>:15"}; !reflect.DeepEqual(s.backtrace(), expected) {
+		t.Errorf("expected backtrace %v, got %v", expected, s.backtrace())
+	}
+
+	// Breakpoints may change while the program is stopped.
+	s.SetBreakpoints("test.lox", nil)
+	s.Continue()
+	if err := s.expectExit(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if expected := []string{"5"}; !reflect.DeepEqual(s.output, expected) {
+		t.Errorf("expected output %v, got %v", expected, s.output)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	s := newTestSession(t, program, true)
+
+	s.expectStop(STOP_ENTRY, 1)
+	s.StepOver()
+	s.expectStop(STOP_STEP, 5)
+	s.StepOver()
+	s.expectStop(STOP_STEP, 13)
+
+	// Stepping in stops inside the function called.
+	s.StepIn()
+	s.expectStop(STOP_STEP, 6)
+	s.StepIn()
+	s.expectStop(STOP_STEP, 7)
+	s.StepOut()
+	s.expectStop(STOP_STEP, 14)
+	s.StepIn()
+	s.expectStop(STOP_STEP, 2)
+	s.StepIn()
+	s.expectStop(STOP_STEP, 3)
+	s.StepIn()
+	s.expectStop(STOP_STEP, 15)
+
+	// Stepping over a call skips the statements inside it.
+	s.StepOver()
+	s.expectStop(STOP_STEP, 16)
+	s.StepOver()
+	if err := s.expectExit(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestLoopIterationsStop(t *testing.T) {
+	s := newTestSession(t, "var i = 0;\nwhile (i < 3) i = i + 1;\nprint i;", false, 2)
+
+	// The first iteration shares its line with the while statement, the
+	// others stop again.
+	s.expectStop(STOP_BREAKPOINT, 2)
+	for idx := 0; idx < 2; idx++ {
+		s.StepIn()
+		s.expectStop(STOP_BREAKPOINT, 2)
+	}
+	s.StepIn()
+	s.expectStop(STOP_STEP, 3)
+	s.Continue()
+	s.expectExit()
+}
+
+func TestScopes(t *testing.T) {
+	s := newTestSession(t, program, false, 9)
+
+	s.expectStop(STOP_BREAKPOINT, 9)
+	frames := s.Frames()
+	if expected := []string{"increment:9", "<script>:15"}; !reflect.DeepEqual(s.backtrace(), expected) {
+		t.Fatalf("expected backtrace %v, got %v", expected, s.backtrace())
+	}
+
+	scopes := frames[0].Scopes()
+	names := make(map[string][]string)
+	for _, scope := range scopes {
+		for _, variable := range scope.Variables {
+			names[scope.Name] = append(names[scope.Name], variable.Name+"="+Format(variable.Value))
+		}
+	}
+
+	expected := map[string][]string{
+		"Closure": {"count=1", "increment=increment"},
+		"Globals": {"add=add", "counter=counter", "inc=increment", "math=<module math>", "string=<module string>", "total=3"},
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected scopes %v, got %v", expected, names)
+	}
+
+	if value, ok := frames[1].Lookup("total"); !ok || value != 3.0 {
+		t.Errorf("expected total to be 3, got %v", value)
+	}
+	if _, ok := frames[1].Lookup("count"); ok {
+		t.Errorf("expected count not to be visible from the script")
+	}
+
+	s.Continue()
+	s.expectStop(STOP_BREAKPOINT, 9)
+	if value, _ := s.Frames()[0].Lookup("count"); value != 2.0 {
+		t.Errorf("expected count to be 2, got %v", value)
+	}
+	s.Continue()
+	s.expectExit()
+}
+
+func TestTerminate(t *testing.T) {
+	s := newTestSession(t, "while (true) {}", false)
+
+	s.Pause()
+	s.expectStop(STOP_PAUSE, 1)
+	s.Terminate()
+	if err := s.expectExit(); !errors.Is(err, ErrTerminated) {
+		t.Errorf("expected the program to be terminated, got %v", err)
+	}
+}
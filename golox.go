@@ -2,25 +2,86 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
+	"github.com/cgrunewald/golox/dap"
+	"github.com/cgrunewald/golox/debug"
 	i "github.com/cgrunewald/golox/interpreter"
+	"github.com/cgrunewald/golox/lsp"
+	"github.com/cgrunewald/golox/vm"
 )
 
-var interpreter = i.NewInterpreter(i.InterpreterConfig{
+// backend executes resolved programs. Both the tree walking interpreter and
+// the bytecode VM satisfy it.
+type backend interface {
+	Interpret(program []i.Stmt) (interface{}, error)
+	InterpretExpr(expr i.Expr) (interface{}, error)
+}
+
+var config = i.InterpreterConfig{
 	PrintFunc: func(value string) {
 		fmt.Println(value)
 	},
-})
+}
 
-var resolver = i.NewResolver(interpreter)
+var interpreter backend
+
+var resolver *i.Resolver
 
 func main() {
-	args := os.Args[1:]
+	useVM := flag.Bool("vm", false, "run scripts on the bytecode VM")
+	flag.Usage = func() {
+		fmt.Println("Usage: golox [--vm] [script]")
+		fmt.Println("       golox debug script")
+		fmt.Println("       golox dap")
+		fmt.Println("       golox lsp")
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 1 && (args[0] == "lsp" || args[0] == "dap") {
+		serve := lsp.NewServer().Serve
+		if args[0] == "dap" {
+			serve = dap.NewServer().Serve
+		}
+
+		// The protocol owns stdout, so errors go to stderr.
+		if err := serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(args) == 2 && args[0] == "debug" {
+		config.ScriptPath = args[1]
+		if err := debugFile(args[1]); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(args) == 1 {
+		config.ScriptPath = args[0]
+	}
+
+	if *useVM {
+		interpreter = vm.NewVM(config)
+		resolver = i.NewResolver(nil)
+	} else {
+		treeInterpreter := i.NewInterpreter(config)
+		interpreter = treeInterpreter
+		resolver = i.NewResolver(treeInterpreter)
+	}
+
 	if len(args) > 1 {
-		fmt.Println("Usage: golox [script]")
+		flag.Usage()
 		os.Exit(1)
 		return
 	} else if len(args) == 1 {
@@ -45,7 +106,35 @@ func runFile(file string) error {
 	}
 
 	str := string(contents)
-	return run(str, false)
+	errs := run(str, false)
+	if len(errs) > 0 {
+		return errors.New(report(str, file, errs))
+	}
+	return nil
+}
+
+// debugFile runs a script under the debugger, taking commands from stdin.
+func debugFile(file string) error {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("golox: could not read file: '%s'", file)
+	}
+
+	str := string(contents)
+	treeInterpreter := i.NewInterpreter(config)
+	program, errs := i.Compile(str, i.NewResolver(treeInterpreter))
+	if len(errs) == 0 {
+		session := debug.NewSession(treeInterpreter)
+		err = debug.NewConsole(session, file, str, os.Stdin, os.Stdout).Run(program)
+		if err != nil && err != debug.ErrTerminated {
+			errs = []error{err}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(report(str, file, errs))
+	}
+	return nil
 }
 
 func runPrompt() error {
@@ -62,61 +151,81 @@ func runPrompt() error {
 			return err
 		}
 
-		err = run(str, true)
-		if err != nil && !i.IsLoxError(err) {
-			return err
-		} else if err != nil {
-			fmt.Println(err.Error())
+		errs := run(str, true)
+		if len(errs) > 0 {
+			fmt.Println(report(str, "", errs))
 		}
 	}
 }
 
+// report renders every error against the source it came from, followed by
+// how many there were.
+func report(source string, path string, errs []error) string {
+	builder := strings.Builder{}
+	for _, err := range errs {
+		builder.WriteString(i.Diagnostic(source, path, err))
+	}
+	builder.WriteString(i.ErrorCount(errs))
+	return builder.String()
+}
+
 func isTokenTypeStmt(tokenType i.TokenType) bool {
 	return tokenType == i.TK_RIGHT_BRACE || tokenType == i.TK_SEMICOLON
 }
 
-func run(source string, interactive bool) error {
-	scanner := i.NewScanner(source)
-	tokens := scanner.ScanTokens()
-	if scanner.HasError() {
-		return scanner.Errors()[0]
-	}
-
-	parser := i.NewParser(tokens)
-	if interactive && len(tokens) > 1 && !isTokenTypeStmt(tokens[len(tokens)-2].TokenType) {
-		expr := parser.ParseExpr()
-		if parser.HasError() {
-			return parser.Errors()[0]
-		}
-
-		resolver.ResolveExpr(expr)
-		if resolver.HasError() {
-			return resolver.Errors()[0]
+func run(source string, interactive bool) []error {
+	if interactive {
+		tokens := i.NewScanner(source).ScanTokens()
+		if len(tokens) > 1 && !isTokenTypeStmt(tokens[len(tokens)-2].TokenType) {
+			return runExpr(tokens)
 		}
+	}
 
-		result, err := interpreter.InterpretExpr(expr)
-		if err != nil {
-			return err
-		}
+	program, errs := i.Compile(source, resolver)
+	if len(errs) > 0 {
+		return errs
+	}
 
-		fmt.Println(result)
-		return nil
+	_, err := interpreter.Interpret(program)
+	if err != nil {
+		return []error{err}
 	}
 
-	program := parser.Parse()
+	return nil
+}
+
+// runExpr evaluates a single expression typed at the prompt and prints its
+// value.
+func runExpr(tokens []i.Token) []error {
+	parser := i.NewParser(tokens)
+	expr := parser.ParseExpr()
 	if parser.HasError() {
-		return parser.Errors()[0]
+		return parser.Errors()
 	}
 
-	resolver.ResolveStmts(program)
-	if resolver.HasError() {
-		return resolver.Errors()[0]
+	resolved := len(resolver.Errors())
+	resolver.ResolveExpr(expr)
+	if len(resolver.Errors()) > resolved {
+		return resolver.Errors()[resolved:]
 	}
 
-	_, err := interpreter.Interpret(program)
+	result, err := interpreter.InterpretExpr(expr)
 	if err != nil {
-		return err
+		return []error{err}
+	}
+
+	// The tree walking interpreter shows instances with their toString method.
+	if stringifier, ok := interpreter.(interface {
+		Stringify(value interface{}) (string, error)
+	}); ok {
+		str, err := stringifier.Stringify(result)
+		if err != nil {
+			return []error{err}
+		}
+		fmt.Println(str)
+		return nil
 	}
 
+	fmt.Println(result)
 	return nil
 }
@@ -51,17 +51,28 @@ func (p *ASTPrinter) VisitVarStmt(stmt *VarStmt) interface{} {
 	return p.parenthesized("def "+stmt.Name.Lexeme, stmt.Initializer)
 }
 
+func (p *ASTPrinter) VisitImportStmt(stmt *ImportStmt) interface{} {
+	return fmt.Sprintf("(import %s %s)", stmt.Path.Lexeme, stmt.Name.Lexeme)
+}
+
 func (p *ASTPrinter) VisitFunctionStmt(stmt *FunctionStmt) interface{} {
-	return p.printFunction(stmt.Name.Lexeme, stmt.Params, stmt.Body)
+	if stmt.IsGetter {
+		return fmt.Sprintf("(get %s %s)", stmt.Name.Lexeme, p.printStatements(stmt.Body))
+	}
+	return p.printFunction(stmt.Name.Lexeme, stmt.Params, stmt.Body, stmt.IsAsync)
 }
 
 func (p *ASTPrinter) VisitLambda(expr *Lambda) interface{} {
-	return p.printFunction("", expr.Params, expr.Body)
+	return p.printFunction("", expr.Params, expr.Body, expr.IsAsync)
 }
 
-func (p *ASTPrinter) printFunction(name string, params []Token, body []Stmt) interface{} {
+func (p *ASTPrinter) printFunction(name string, params []Token, body []Stmt, isAsync bool) interface{} {
 	builder := strings.Builder{}
-	builder.WriteString("(def " + name)
+	builder.WriteString("(def ")
+	if isAsync {
+		builder.WriteString("async ")
+	}
+	builder.WriteString(name)
 	builder.WriteString("(")
 
 	for i, param := range params {
@@ -106,6 +117,30 @@ func (p *ASTPrinter) VisitSet(expr *Set) interface{} {
 	return p.parenthesized(fmt.Sprintf("set %q", expr.Name.Lexeme), expr.Object, expr.Value)
 }
 
+func (p *ASTPrinter) VisitListLiteral(expr *ListLiteral) interface{} {
+	return p.parenthesized("list", expr.Elements...)
+}
+
+func (p *ASTPrinter) VisitMapLiteral(expr *MapLiteral) interface{} {
+	entries := make([]Expr, 0, 2*len(expr.Keys))
+	for idx, key := range expr.Keys {
+		entries = append(entries, key, expr.Values[idx])
+	}
+	return p.parenthesized("map", entries...)
+}
+
+func (p *ASTPrinter) VisitGetIndex(expr *GetIndex) interface{} {
+	return p.parenthesized("index", expr.Object, expr.Index)
+}
+
+func (p *ASTPrinter) VisitSetIndex(expr *SetIndex) interface{} {
+	return p.parenthesized("set-index", expr.Object, expr.Index, expr.Value)
+}
+
+func (p *ASTPrinter) VisitAwait(expr *Await) interface{} {
+	return p.parenthesized("await", expr.Value)
+}
+
 func (p *ASTPrinter) VisitIfStmt(stmt *IfStmt) interface{} {
 	expression := stmt.Condition.Accept(p)
 	thenBranch := stmt.ThenBranch.Accept(p)
@@ -121,6 +156,9 @@ func (p *ASTPrinter) VisitIfStmt(stmt *IfStmt) interface{} {
 func (p *ASTPrinter) VisitWhileStmt(stmt *WhileStmt) interface{} {
 	expression := stmt.Condition.Accept(p)
 	statement := stmt.Body.Accept(p)
+	if stmt.Increment != nil {
+		statement = p.printStatements([]Stmt{stmt.Body, &ExprStmt{Expression: stmt.Increment}})
+	}
 
 	return fmt.Sprintf("(while %s %s)", expression, statement)
 }
@@ -139,6 +177,39 @@ func (p *ASTPrinter) VisitReturnStmt(stmt *ReturnStmt) interface{} {
 	return p.parenthesized("return", stmt.Expression)
 }
 
+func (p *ASTPrinter) VisitYieldStmt(stmt *YieldStmt) interface{} {
+	return p.parenthesized("yield", stmt.Expression)
+}
+
+func (p *ASTPrinter) VisitBreakStmt(stmt *BreakStmt) interface{} {
+	return "(break)"
+}
+
+func (p *ASTPrinter) VisitContinueStmt(stmt *ContinueStmt) interface{} {
+	return "(continue)"
+}
+
+func (p *ASTPrinter) VisitThrowStmt(stmt *ThrowStmt) interface{} {
+	return p.parenthesized("throw", stmt.Expression)
+}
+
+func (p *ASTPrinter) VisitTryStmt(stmt *TryStmt) interface{} {
+	builder := strings.Builder{}
+	builder.WriteString("(try ")
+	builder.WriteString(p.printStatements(stmt.Body.Statements))
+
+	if stmt.CatchBody != nil {
+		builder.WriteString(fmt.Sprintf(" (catch %s %s)", stmt.CatchName.Lexeme, p.printStatements(stmt.CatchBody.Statements)))
+	}
+
+	if stmt.FinallyBody != nil {
+		builder.WriteString(fmt.Sprintf(" (finally %s)", p.printStatements(stmt.FinallyBody.Statements)))
+	}
+
+	builder.WriteString(")")
+	return builder.String()
+}
+
 func (p *ASTPrinter) printStatements(stmts []Stmt) string {
 	builder := strings.Builder{}
 	builder.WriteString("(scope")
@@ -171,7 +242,29 @@ func (p *ASTPrinter) parenthesized(name string, exprs ...Expr) string {
 }
 
 func (p *ASTPrinter) VisitClassStmt(stmt *ClassStmt) interface{} {
-	return ("class " + stmt.Name.Lexeme + ")")
+	builder := strings.Builder{}
+	builder.WriteString("(class ")
+	builder.WriteString(stmt.Name.Lexeme)
+	if stmt.SuperClass != nil {
+		builder.WriteString(" < ")
+		builder.WriteString(stmt.SuperClass.Name.Lexeme)
+	}
+
+	for _, field := range stmt.ClassFields {
+		builder.WriteString(" (class " + field.Accept(p).(string) + ")")
+	}
+	for _, method := range stmt.ClassMethods {
+		builder.WriteString(" (class " + method.Accept(p).(string) + ")")
+	}
+	for _, field := range stmt.Fields {
+		builder.WriteString(" " + field.Accept(p).(string))
+	}
+	for _, method := range stmt.Methods {
+		builder.WriteString(" " + method.Accept(p).(string))
+	}
+
+	builder.WriteString(")")
+	return builder.String()
 }
 
 func (p *ASTPrinter) PrintProgram(stmts []Stmt) string {
@@ -0,0 +1,12 @@
+package interpreter_test
+
+import (
+	"github.com/cgrunewald/golox/interpreter"
+	"github.com/cgrunewald/golox/vm"
+)
+
+// The bytecode VM imports this package, so it can only be registered from an
+// external test package.
+func init() {
+	interpreter.ProgramRunners = append(interpreter.ProgramRunners, interpreter.ProgramRunner{Name: "vm", Run: vm.RunProgram})
+}
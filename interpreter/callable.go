@@ -1,6 +1,13 @@
 package interpreter
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
+
+// maxCallDepth bounds the calls in progress when no MaxCallDepth is set, as
+// each one takes Go stack.
+const maxCallDepth = 10000
 
 type Callable interface {
 	Arity() int
@@ -39,25 +46,50 @@ type FunctionCallable struct {
 	body               []Stmt
 	lexicalEnvironment *Environment
 	isInit             bool
+	isAsync            bool
+	isGenerator        bool
+	isGetter           bool
+	class              string
 }
 
 func NewFunctionCallable(stmt *FunctionStmt, lexicalEnvironment *Environment) Callable {
-	return &FunctionCallable{name: stmt.Name, params: stmt.Params, body: stmt.Body, lexicalEnvironment: lexicalEnvironment, isInit: false}
+	return &FunctionCallable{name: stmt.Name, params: stmt.Params, body: stmt.Body, lexicalEnvironment: lexicalEnvironment, isInit: false, isAsync: stmt.IsAsync, isGenerator: stmt.IsGenerator}
 }
 
 func NewInitFunctionCallable(stmt *FunctionStmt, lexicalEnvironment *Environment) Callable {
 	return &FunctionCallable{name: stmt.Name, params: stmt.Params, body: stmt.Body, lexicalEnvironment: lexicalEnvironment, isInit: true}
 }
 
+func NewMethodCallable(stmt *FunctionStmt, lexicalEnvironment *Environment, class string, isInit bool) Callable {
+	return &FunctionCallable{name: stmt.Name, params: stmt.Params, body: stmt.Body, lexicalEnvironment: lexicalEnvironment, isInit: isInit, isAsync: stmt.IsAsync, isGenerator: stmt.IsGenerator, isGetter: stmt.IsGetter, class: class}
+}
+
 func NewLambdaCallable(expr *Lambda, lexicalEnvironment *Environment) Callable {
-	return &FunctionCallable{name: expr.Name, params: expr.Params, body: expr.Body, lexicalEnvironment: lexicalEnvironment}
+	return &FunctionCallable{name: expr.Name, params: expr.Params, body: expr.Body, lexicalEnvironment: lexicalEnvironment, isAsync: expr.IsAsync, isGenerator: expr.IsGenerator}
 }
 
 func (n *FunctionCallable) Arity() int {
 	return len(n.params)
 }
 
+// Call runs the function. An async function starts running and returns a
+// future of its result, while a generator returns a generator that runs it
+// when asked for values.
 func (n *FunctionCallable) Call(i *Interpreter, arguments []interface{}) interface{} {
+	if n.isGenerator {
+		return i.newGenerator(n.name.Lexeme, func(state *Interpreter) interface{} {
+			return n.call(state, arguments)
+		})
+	}
+	if n.isAsync {
+		return i.async(func(state *Interpreter) interface{} {
+			return n.call(state, arguments)
+		})
+	}
+	return n.call(i, arguments)
+}
+
+func (n *FunctionCallable) call(i *Interpreter, arguments []interface{}) interface{} {
 	environment := NewEnclosedEnvironment(n.lexicalEnvironment)
 
 	if len(arguments) != len(n.params) {
@@ -68,12 +100,25 @@ func (n *FunctionCallable) Call(i *Interpreter, arguments []interface{}) interfa
 		environment.Define(tok.Lexeme, arguments[idx])
 	}
 
-	i.PushCallstack(n.String())
+	depth := i.depth + len(i.callstack)
+	if i.config.MaxCallDepth > 0 && depth >= i.config.MaxCallDepth {
+		message := fmt.Sprintf("Exceeded the limit of %d nested calls", i.config.MaxCallDepth)
+		return i.callSite.ToRuntimeError(E_CALL_DEPTH_EXCEEDED, message)
+	}
+	if depth >= maxCallDepth {
+		return i.callSite.ToRuntimeError(E_STACK_OVERFLOW, "Stack overflow")
+	}
+
+	frame := StackFrame{Function: FunctionName(n.name.Lexeme), Class: n.class, Line: i.callSite.Line, File: i.modulePath}
+	i.pushCall(frame, environment)
 	defer i.PopCallstack()
 
+	// Functions imported from a module read the globals of that module.
+	defer i.enterModule(n.lexicalEnvironment.global())()
+
 	r := i.executeBlock(n.body, environment).(*result)
 	if r.IsError() {
-		return r.Err
+		return AddStackFrame(inFile(r.Err, i.modulePath, i.sources[i.modulePath]), frame)
 	}
 
 	if n.isInit {
@@ -0,0 +1,48 @@
+package interpreter
+
+// Debugger is called before each statement executes while it is attached to
+// an interpreter. It runs on the interpreter's goroutine, so the program stays
+// paused for as long as BeforeStatement blocks.
+type Debugger interface {
+	BeforeStatement(stmt Stmt)
+}
+
+// Attach makes debugger observe the statements the interpreter executes. A
+// nil debugger detaches it.
+func (i *Interpreter) Attach(debugger Debugger) {
+	i.debugger = debugger
+}
+
+// Activation is a function call in progress.
+type Activation struct {
+	Frame StackFrame
+	// Caller is the innermost scope of the code that made the call and Locals
+	// the scope holding the call's parameters.
+	Caller *Environment
+	Locals *Environment
+}
+
+// Callstack returns the function calls in progress, outermost first.
+func (i *Interpreter) Callstack() []Activation {
+	return append([]Activation{}, i.callstack...)
+}
+
+// CallDepth is the number of function calls in progress.
+func (i *Interpreter) CallDepth() int {
+	return len(i.callstack)
+}
+
+// CurrentEnvironment is the innermost scope of the code executing.
+func (i *Interpreter) CurrentEnvironment() *Environment {
+	return i.environment
+}
+
+// GlobalEnvironment holds the globals of the script or module executing.
+func (i *Interpreter) GlobalEnvironment() *Environment {
+	return i.globalEnvironment
+}
+
+// CurrentFile is the script or module the code executing belongs to.
+func (i *Interpreter) CurrentFile() string {
+	return i.modulePath
+}
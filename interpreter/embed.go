@@ -0,0 +1,505 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterFunc defines a global function that calls fn, which must be a Go
+// function. Arguments are converted from Lox values to the types of fn's
+// parameters, and its result back to a Lox value: numbers, strings,
+// booleans, nil, slices, maps and structs registered with RegisterType are
+// supported. fn may also return an error as its last result, which is raised
+// as an E_HOST_ERROR runtime error. Other tasks keep running while fn does.
+func (i *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	callable, err := NewGoFunc(name, fn)
+	if err != nil {
+		return err
+	}
+
+	i.defineHost(name, callable)
+	return nil
+}
+
+// RegisterType makes the Go struct type of value available to Lox under
+// name. value is either a struct, or a pointer to one, in which case Lox
+// creates it with name() and fills in its fields, or a function returning a
+// pointer to a struct, which is then called as the constructor.
+//
+// The exported fields of the struct become properties and its exported
+// methods become callable, named with a lowercase first letter unless a
+// field has a `lox:"name"` tag.
+func (i *Interpreter) RegisterType(name string, value interface{}) error {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return errors.New("lox: cannot register nil as a type")
+	}
+
+	var constructor Callable
+	if t.Kind() == reflect.Func {
+		if t.NumOut() == 0 || !isStructPointer(t.Out(0)) {
+			return fmt.Errorf("lox: constructor of %s must return a pointer to a struct", name)
+		}
+
+		var err error
+		if constructor, err = NewGoFunc(name, value); err != nil {
+			return err
+		}
+		t = t.Out(0).Elem()
+	} else {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return fmt.Errorf("lox: %s must be a struct, got %v", name, t)
+		}
+
+		constructor = NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			return i.newGoObject(reflect.New(t))
+		})
+	}
+
+	i.types[t] = name
+	i.defineHost(name, constructor)
+	return nil
+}
+
+// defineHost defines a global registered by the host program in the script
+// and in every module it imports.
+func (i *Interpreter) defineHost(name string, value interface{}) {
+	i.shared.host[name] = value
+	i.shared.globals.Define(name, value)
+}
+
+// NewGoFunc wraps a Go function as a Lox callable, converting its arguments
+// and results as RegisterFunc does. It can be given to the VM through
+// InterpreterConfig.GlobalFuncOverrides.
+func NewGoFunc(name string, fn interface{}) (Callable, error) {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return nil, fmt.Errorf("lox: %s must be a function, got %T", name, fn)
+	}
+	return newGoFunc(name, value)
+}
+
+func newGoFunc(name string, fn reflect.Value) (Callable, error) {
+	t := fn.Type()
+	if t.IsVariadic() {
+		return nil, fmt.Errorf("lox: %s cannot be variadic", name)
+	}
+
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	results := t.NumOut()
+	if returnsError {
+		results--
+	}
+	if results > 1 {
+		return nil, fmt.Errorf("lox: %s must return at most one value and an error", name)
+	}
+
+	return NewNativeCallable(t.NumIn(), func(i *Interpreter, arguments []interface{}) (value interface{}) {
+		in := make([]reflect.Value, len(arguments))
+		for idx, argument := range arguments {
+			converted, err := i.fromLox(argument, t.In(idx))
+			if err != nil {
+				return NewNativeError(E_INVALID_ARGUMENTS, fmt.Sprintf("Argument %d of '%s': %v", idx+1, name, err))
+			}
+			in[idx] = converted
+		}
+
+		// A panicking host function fails the call rather than the
+		// interpreter.
+		defer func() {
+			if r := recover(); r != nil {
+				value = NewNativeError(E_HOST_ERROR, fmt.Sprintf("'%s' panicked: %v", name, r))
+			}
+		}()
+
+		// Other tasks run while the function does.
+		var out []reflect.Value
+		i.unlocked(func() { out = fn.Call(in) })
+		if returnsError && !out[len(out)-1].IsNil() {
+			return NewNativeError(E_HOST_ERROR, out[len(out)-1].Interface().(error).Error())
+		}
+		if results == 0 {
+			return nil
+		}
+
+		converted, err := i.toLox(out[0])
+		if err != nil {
+			return NewNativeError(E_HOST_ERROR, fmt.Sprintf("Result of '%s': %v", name, err))
+		}
+		return converted
+	}), nil
+}
+
+func isStructPointer(t reflect.Type) bool {
+	return t.Kind() == reflect.Pointer && t.Elem().Kind() == reflect.Struct
+}
+
+// isLoxValue reports whether value is already a Lox value and needs no
+// conversion.
+func isLoxValue(value interface{}) bool {
+	switch value.(type) {
+	case nil, bool, float64, string, Callable, *LoxList, *LoxMap, *KlassInstance, *Module, *ErrorObject, *GoObject:
+		return true
+	}
+	return false
+}
+
+// toLox converts a Go value to a Lox value.
+func (i *Interpreter) toLox(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Kind() == reflect.Interface {
+			return i.toLox(v.Elem())
+		}
+	}
+	if v.CanInterface() && isLoxValue(v.Interface()) {
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if isStructPointer(v.Type()) {
+			return i.newGoObject(v), nil
+		}
+		return i.toLox(v.Elem())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+
+		elements := make([]interface{}, v.Len())
+		for idx := range elements {
+			element, err := i.toLox(v.Index(idx))
+			if err != nil {
+				return nil, err
+			}
+			elements[idx] = element
+		}
+		return NewList(elements), nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return i.mapToLox(v)
+	case reflect.Struct:
+		// Structs are copied, as they are in Go.
+		pointer := reflect.New(v.Type())
+		pointer.Elem().Set(v)
+		return i.newGoObject(pointer), nil
+	case reflect.Func:
+		return newGoFunc("func", v)
+	}
+
+	return nil, fmt.Errorf("cannot convert %v to a Lox value", v.Type())
+}
+
+// mapToLox converts a Go map. Keys are sorted, so that iterating the map in
+// Lox is deterministic.
+func (i *Interpreter) mapToLox(v reflect.Value) (interface{}, error) {
+	type entry struct {
+		key   interface{}
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := i.toLox(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{key, iter.Value()})
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return fmt.Sprint(entries[a].key) < fmt.Sprint(entries[b].key)
+	})
+
+	m := NewMap()
+	for _, entry := range entries {
+		value, err := i.toLox(entry.value)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Put(entry.key, value); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// fromLox converts a Lox value to a Go value of type t.
+func (i *Interpreter) fromLox(value interface{}, t reflect.Type) (reflect.Value, error) {
+	mismatch := func() (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("expected %s, got %s", i.describeType(t), TypeOf(value))
+	}
+
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+		return mismatch()
+	}
+
+	if t.Kind() == reflect.Interface {
+		var converted interface{}
+		if t.NumMethod() == 0 {
+			converted = goValue(value)
+		} else if object, ok := value.(*GoObject); ok {
+			converted = object.value.Interface()
+		} else {
+			converted = value
+		}
+
+		if !reflect.TypeOf(converted).Implements(t) {
+			return mismatch()
+		}
+		v := reflect.New(t).Elem()
+		v.Set(reflect.ValueOf(converted))
+		return v, nil
+	}
+
+	switch value := value.(type) {
+	case *GoObject:
+		if value.value.Type().AssignableTo(t) {
+			return value.value, nil
+		}
+		if value.value.Type().Elem() == t {
+			return value.value.Elem(), nil
+		}
+	case bool:
+		if t.Kind() == reflect.Bool {
+			return reflect.ValueOf(value).Convert(t), nil
+		}
+	case string:
+		if t.Kind() == reflect.String {
+			return reflect.ValueOf(value).Convert(t), nil
+		}
+	case float64:
+		return numberFromLox(value, t, mismatch)
+	case *LoxList:
+		return i.listFromLox(value, t, mismatch)
+	case *LoxMap:
+		if t.Kind() != reflect.Map {
+			return mismatch()
+		}
+
+		m := reflect.MakeMapWithSize(t, value.Len())
+		values := value.Values()
+		for idx, key := range value.Keys() {
+			k, err := i.fromLox(key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v, err := i.fromLox(values[idx], t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			m.SetMapIndex(k, v)
+		}
+		return m, nil
+	}
+
+	return mismatch()
+}
+
+func numberFromLox(value float64, t reflect.Type, mismatch func() (reflect.Value, error)) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value != float64(int64(value)) || v.OverflowInt(int64(value)) {
+			return reflect.Value{}, fmt.Errorf("%v does not fit in %v", value, t)
+		}
+		v.SetInt(int64(value))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value < 0 || value != float64(uint64(value)) || v.OverflowUint(uint64(value)) {
+			return reflect.Value{}, fmt.Errorf("%v does not fit in %v", value, t)
+		}
+		v.SetUint(uint64(value))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(value)
+	default:
+		return mismatch()
+	}
+	return v, nil
+}
+
+func (i *Interpreter) listFromLox(list *LoxList, t reflect.Type, mismatch func() (reflect.Value, error)) (reflect.Value, error) {
+	elements := list.Elements()
+
+	var v reflect.Value
+	switch t.Kind() {
+	case reflect.Slice:
+		v = reflect.MakeSlice(t, len(elements), len(elements))
+	case reflect.Array:
+		if t.Len() != len(elements) {
+			return reflect.Value{}, fmt.Errorf("expected a list of %d elements, got %d", t.Len(), len(elements))
+		}
+		v = reflect.New(t).Elem()
+	default:
+		return mismatch()
+	}
+
+	for idx, element := range elements {
+		converted, err := i.fromLox(element, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.Index(idx).Set(converted)
+	}
+	return v, nil
+}
+
+// goValue converts a Lox value for a parameter of type interface{}: lists
+// and maps become []interface{} and map[interface{}]interface{}, and objects
+// the Go value they wrap.
+func goValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case *LoxList:
+		elements := make([]interface{}, 0, len(value.Elements()))
+		for _, element := range value.Elements() {
+			elements = append(elements, goValue(element))
+		}
+		return elements
+	case *LoxMap:
+		m := make(map[interface{}]interface{}, value.Len())
+		values := value.Values()
+		for idx, key := range value.Keys() {
+			m[key] = goValue(values[idx])
+		}
+		return m
+	case *GoObject:
+		return value.value.Interface()
+	}
+	return value
+}
+
+// describeType names a Go type the way Lox names the values converted to it.
+func (i *Interpreter) describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map:
+		return "map"
+	case reflect.Pointer:
+		return i.describeType(t.Elem())
+	case reflect.Struct:
+		if name, ok := i.types[t]; ok {
+			return name
+		}
+	}
+	return t.String()
+}
+
+// GoObject is a Go struct exposed to Lox. Its exported fields are properties
+// and its exported methods can be called.
+type GoObject struct {
+	// value is a pointer to the struct.
+	value  reflect.Value
+	interp *Interpreter
+}
+
+func (i *Interpreter) newGoObject(pointer reflect.Value) *GoObject {
+	return &GoObject{value: pointer, interp: i}
+}
+
+// Value returns the pointer to the struct.
+func (o *GoObject) Value() interface{} {
+	return o.value.Interface()
+}
+
+func (o *GoObject) TypeName() string {
+	return o.interp.describeType(o.value.Type())
+}
+
+func (o *GoObject) String() string {
+	return fmt.Sprintf("%s instance", o.TypeName())
+}
+
+// loxName is the name a field or method is known by in Lox.
+func loxName(name string) string {
+	first, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(first)) + name[size:]
+}
+
+func (o *GoObject) field(property string) (reflect.Value, bool) {
+	t := o.value.Type().Elem()
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := loxName(field.Name)
+		if tag, ok := field.Tag.Lookup("lox"); ok {
+			name = strings.Split(tag, ",")[0]
+		}
+		if name == property {
+			return o.value.Elem().Field(idx), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func (o *GoObject) Get(property string) (interface{}, bool) {
+	if field, ok := o.field(property); ok {
+		value, err := o.interp.toLox(field)
+		return value, err == nil
+	}
+
+	t := o.value.Type()
+	for idx := 0; idx < t.NumMethod(); idx++ {
+		if loxName(t.Method(idx).Name) == property {
+			method, err := newGoFunc(property, o.value.Method(idx))
+			return method, err == nil
+		}
+	}
+	return nil, false
+}
+
+func (o *GoObject) SetProperty(property string, value interface{}) error {
+	field, ok := o.field(property)
+	if !ok {
+		return NewNativeError(E_UNDEFINED_OBJECT_PROPERTY, "Property is not defined on object")
+	}
+
+	converted, err := o.interp.fromLox(value, field.Type())
+	if err != nil {
+		return NewNativeError(E_UNEXPECTED_TYPE, fmt.Sprintf("Property '%s': %v", property, err))
+	}
+	field.Set(converted)
+	return nil
+}
@@ -0,0 +1,223 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X     float64
+	Y     float64
+	Label string `lox:"name"`
+	Tags  []string
+	count int
+}
+
+type vector struct {
+	X, Y float64
+}
+
+func (p *point) Norm() float64 {
+	return math.Sqrt(p.X*p.X + p.Y*p.Y)
+}
+
+func (p *point) Scale(factor float64) {
+	p.X *= factor
+	p.Y *= factor
+}
+
+func (p *point) Add(other *point) *point {
+	return &point{X: p.X + other.X, Y: p.Y + other.Y}
+}
+
+// runEmbedded runs program on an interpreter set up by register and returns
+// what it printed.
+func runEmbedded(t *testing.T, program string, register func(i *Interpreter) error) ([]string, error) {
+	output := make([]string, 0)
+	i := NewInterpreter(InterpreterConfig{PrintFunc: func(value string) {
+		output = append(output, value)
+	}})
+	if err := register(i); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	stmts, errs := Compile(program, NewResolver(i))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	_, err := i.Interpret(stmts)
+	return output, err
+}
+
+func TestRegisterFunc(t *testing.T) {
+	register := func(i *Interpreter) error {
+		funcs := map[string]interface{}{
+			"add":    func(a, b int) int { return a + b },
+			"repeat": func(s string, n int) string { return strings.Repeat(s, n) },
+			"not":    func(b bool) bool { return !b },
+			"sum": func(xs []float64) float64 {
+				total := 0.0
+				for _, x := range xs {
+					total += x
+				}
+				return total
+			},
+			"keys": func(m map[string]int) []string {
+				keys := make([]string, 0)
+				for key := range m {
+					keys = append(keys, key)
+				}
+				return keys
+			},
+			"counts": func() map[string]int { return map[string]int{"b": 2, "a": 1} },
+			"describe": func(value interface{}) string {
+				return fmt.Sprintf("%T", value)
+			},
+			"fail": func(message string) (float64, error) {
+				return 0, errors.New(message)
+			},
+			"nothing": func() {},
+			"maybe":   func() *point { return nil },
+		}
+		for name, fn := range funcs {
+			if err := i.RegisterFunc(name, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	program := `
+print add(1, 2);
+print repeat("ab", 3);
+print not(true);
+print sum([1, 2, 3.5]);
+print keys({"only": 1});
+print counts();
+print describe([1, "a"]);
+print describe({"a": 1});
+print nothing();
+print maybe();
+try {
+	fail("no luck");
+} catch (e) {
+	print e.type + ": " + e.message;
+}
+`
+	output, err := runEmbedded(t, program, register)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []string{
+		"3", "ababab", "false", "6.5", "[only]", "{a: 1, b: 2}",
+		"[]interface {}", "map[interface {}]interface {}", "<nil>", "<nil>",
+		"E_HOST_ERROR: no luck",
+	}
+	if !reflect.DeepEqual(output, expected) {
+		t.Errorf("expected %v, got %v", expected, output)
+	}
+
+	badArguments := []struct {
+		program string
+		message string
+	}{
+		{"add(1.5, 2);", "Argument 1 of 'add': 1.5 does not fit in int"},
+		{`add(1, "2");`, "Argument 2 of 'add': expected number, got string"},
+		{`sum([1, nil]);`, "Argument 1 of 'sum': expected number, got nil"},
+		{`not(nil);`, "Argument 1 of 'not': expected boolean, got nil"},
+	}
+	for _, test := range badArguments {
+		_, err := runEmbedded(t, test.program, register)
+		var loxError *LoxError
+		if !errors.As(err, &loxError) || loxError.Type() != E_INVALID_ARGUMENTS || loxError.Message() != test.message {
+			t.Errorf("%s: expected %q, got %v", test.program, test.message, err)
+		}
+	}
+}
+
+func TestRegisterFuncErrors(t *testing.T) {
+	i := NewInterpreter(InterpreterConfig{})
+	if err := i.RegisterFunc("f", 1); err == nil {
+		t.Errorf("expected an error for a value that is not a function")
+	}
+	if err := i.RegisterFunc("f", fmt.Sprintf); err == nil {
+		t.Errorf("expected an error for a variadic function")
+	}
+	if err := i.RegisterFunc("f", func() (int, int) { return 1, 2 }); err == nil {
+		t.Errorf("expected an error for a function with two results")
+	}
+	if err := i.RegisterType("P", 1); err == nil {
+		t.Errorf("expected an error for a type that is not a struct")
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	var created *point
+	register := func(i *Interpreter) error {
+		if err := i.RegisterType("Point", func(x, y float64) *point {
+			p := &point{X: x, Y: y}
+			if created == nil {
+				created = p
+			}
+			return p
+		}); err != nil {
+			return err
+		}
+		return i.RegisterType("Vector", vector{})
+	}
+
+	program := `
+var p = Point(3, 4);
+print p;
+print type(p);
+print p.x + p.y;
+print p.norm();
+p.scale(2);
+print p.x;
+p.name = "corner";
+p.tags = ["a", "b"];
+print p.tags;
+var q = p.add(Point(1, 1));
+print q.x;
+var v = Vector();
+v.x = 1;
+print v.x + v.y;
+`
+	output, err := runEmbedded(t, program, register)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []string{"Point instance", "Point", "7", "5", "6", "[a, b]", "7", "1"}
+	if !reflect.DeepEqual(output, expected) {
+		t.Errorf("expected %v, got %v", expected, output)
+	}
+
+	// Lox changed the Go value itself.
+	if created.Label != "corner" || created.X != 6 || !reflect.DeepEqual(created.Tags, []string{"a", "b"}) {
+		t.Errorf("unexpected point %+v", created)
+	}
+
+	badPrograms := []struct {
+		program   string
+		errorType int32
+	}{
+		{`Point(1, 2).x = "one";`, E_UNEXPECTED_TYPE},
+		{`Point(1, 2).z = 1;`, E_UNDEFINED_OBJECT_PROPERTY},
+		{`print Point(1, 2).count;`, E_UNDEFINED_OBJECT_PROPERTY},
+		{`Point(1, 2).add(1);`, E_INVALID_ARGUMENTS},
+	}
+	for _, test := range badPrograms {
+		_, err := runEmbedded(t, test.program, register)
+		var loxError *LoxError
+		if !errors.As(err, &loxError) || loxError.Type() != test.errorType {
+			t.Errorf("%s: expected %s, got %v", test.program, ErrorTypeNames[test.errorType], err)
+		}
+	}
+}
@@ -26,7 +26,7 @@ func (e *Environment) Get(name Token) (interface{}, error) {
 		return e.Enclosing.Get(name)
 	}
 
-	return nil, NewRuntimeError(E_UNDEFINED_VARIABLE, name.Line, name.Lexeme, "Undefined variable")
+	return nil, name.ToRuntimeError(E_UNDEFINED_VARIABLE, "Undefined variable")
 }
 
 func (e *Environment) GetAt(name Token, distance int) (interface{}, error) {
@@ -41,6 +41,14 @@ func (e *Environment) ancestor(distance int) *Environment {
 	return env
 }
 
+func (e *Environment) global() *Environment {
+	env := e
+	for env.Enclosing != nil {
+		env = env.Enclosing
+	}
+	return env
+}
+
 func (e *Environment) Set(name Token, value interface{}) error {
 	if _, ok := e.Values[name.Lexeme]; ok {
 		e.Values[name.Lexeme] = value
@@ -51,7 +59,7 @@ func (e *Environment) Set(name Token, value interface{}) error {
 		return e.Enclosing.Set(name, value)
 	}
 
-	return NewRuntimeError(E_UNDEFINED_VARIABLE, name.Line, name.Lexeme, "Undefined variable")
+	return name.ToRuntimeError(E_UNDEFINED_VARIABLE, "Undefined variable")
 }
 
 func (e *Environment) SetAt(name Token, value interface{}, distance int) error {
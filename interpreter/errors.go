@@ -3,6 +3,7 @@ package interpreter
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 const (
@@ -18,17 +19,234 @@ const (
 	E_VAR_ALREADY_DEFINED
 	E_NOT_AN_OBJECT
 	E_UNDEFINED_OBJECT_PROPERTY
+	E_STACK_OVERFLOW
+	E_NOT_INDEXABLE
+	E_INDEX_OUT_OF_RANGE
+	E_UNDEFINED_KEY
+	E_UNEXPECTED_BREAK
+	E_UNEXPECTED_CONTINUE
+	E_THROWN
+	E_IMPORT_FAILED
+	E_CYCLIC_IMPORT
+	E_STEP_LIMIT_EXCEEDED
+	E_CALL_DEPTH_EXCEEDED
+	E_CANCELLED
+	E_MEMORY_LIMIT_EXCEEDED
+	E_HOST_ERROR
+	E_CHANNEL_CLOSED
+	E_UNEXPECTED_AWAIT
+	E_DEADLOCK
+	E_UNEXPECTED_YIELD
 )
 
+var ErrorTypeNames = map[int32]string{
+	E_NO_ERROR:                  "E_NO_ERROR",
+	E_UNEXPECTED_TYPE:           "E_UNEXPECTED_TYPE",
+	E_UNEXPECTED_OPERATOR:       "E_UNEXPECTED_OPERATOR",
+	E_UNDEFINED_VARIABLE:        "E_UNDEFINED_VARIABLE",
+	E_CANNOT_CALL:               "E_CANNOT_CALL",
+	E_INVALID_ARGUMENTS:         "E_INVALID_ARGUMENTS",
+	E_INVALID_CLASS:             "E_INVALID_CLASS",
+	E_DIVIDE_BY_ZERO:            "E_DIVIDE_BY_ZERO",
+	E_UNEXPECTED_RETURN:         "E_UNEXPECTED_RETURN",
+	E_VAR_ALREADY_DEFINED:       "E_VAR_ALREADY_DEFINED",
+	E_NOT_AN_OBJECT:             "E_NOT_AN_OBJECT",
+	E_UNDEFINED_OBJECT_PROPERTY: "E_UNDEFINED_OBJECT_PROPERTY",
+	E_STACK_OVERFLOW:            "E_STACK_OVERFLOW",
+	E_NOT_INDEXABLE:             "E_NOT_INDEXABLE",
+	E_INDEX_OUT_OF_RANGE:        "E_INDEX_OUT_OF_RANGE",
+	E_UNDEFINED_KEY:             "E_UNDEFINED_KEY",
+	E_UNEXPECTED_BREAK:          "E_UNEXPECTED_BREAK",
+	E_UNEXPECTED_CONTINUE:       "E_UNEXPECTED_CONTINUE",
+	E_THROWN:                    "E_THROWN",
+	E_IMPORT_FAILED:             "E_IMPORT_FAILED",
+	E_CYCLIC_IMPORT:             "E_CYCLIC_IMPORT",
+	E_STEP_LIMIT_EXCEEDED:       "E_STEP_LIMIT_EXCEEDED",
+	E_CALL_DEPTH_EXCEEDED:       "E_CALL_DEPTH_EXCEEDED",
+	E_CANCELLED:                 "E_CANCELLED",
+	E_MEMORY_LIMIT_EXCEEDED:     "E_MEMORY_LIMIT_EXCEEDED",
+	E_HOST_ERROR:                "E_HOST_ERROR",
+	E_CHANNEL_CLOSED:            "E_CHANNEL_CLOSED",
+	E_UNEXPECTED_AWAIT:          "E_UNEXPECTED_AWAIT",
+	E_DEADLOCK:                  "E_DEADLOCK",
+	E_UNEXPECTED_YIELD:          "E_UNEXPECTED_YIELD",
+}
+
 type LoxError struct {
 	line             int
 	message          string
 	where            string
 	runtimeErrorType int32
+	thrown           interface{}
+	trace            []StackFrame
+	span             Span
+	file             string
+	source           string
 }
 
+// maxPrintedFrames bounds the stack trace printed for deep recursion; the
+// frames in the middle are elided.
+const maxPrintedFrames = 20
+
 func (err *LoxError) Error() string {
-	return fmt.Sprintf("[line %d] Error%s: %s\n", err.line, err.where, err.message)
+	return err.header("") + err.traceString()
+}
+
+// header describes the error, and where it was raised when that is a file
+// other than path.
+func (err *LoxError) header(path string) string {
+	header := fmt.Sprintf("[line %d] Error%s: %s\n", err.line, err.where, err.message)
+	if err.file != "" && err.file != path {
+		header += fmt.Sprintf("    in %s:%d\n", err.file, err.line)
+	}
+	return header
+}
+
+func (err *LoxError) traceString() string {
+	builder := strings.Builder{}
+	for idx, frame := range err.trace {
+		if len(err.trace) > maxPrintedFrames && idx >= maxPrintedFrames/2 && idx < len(err.trace)-maxPrintedFrames/2 {
+			if idx == maxPrintedFrames/2 {
+				builder.WriteString(fmt.Sprintf("    ... %d more frames\n", len(err.trace)-maxPrintedFrames))
+			}
+			continue
+		}
+		builder.WriteString(fmt.Sprintf("    %v\n", frame))
+	}
+	return builder.String()
+}
+
+// StackTrace lists the function calls the error unwound through, innermost
+// first.
+func (err *LoxError) StackTrace() []StackFrame {
+	return err.trace
+}
+
+// Span is the source text the error was reported at. It is zero for errors
+// without a position.
+func (err *LoxError) Span() Span {
+	return err.span
+}
+
+// File is the script or module the error was reported in, if known.
+func (err *LoxError) File() string {
+	return err.file
+}
+
+func (err *LoxError) Line() int {
+	return err.line
+}
+
+func (err *LoxError) Message() string {
+	return err.message
+}
+
+func (err *LoxError) Type() int32 {
+	return err.runtimeErrorType
+}
+
+// StackFrame is a function call that was active when a runtime error
+// occurred. Line and File locate the call itself.
+type StackFrame struct {
+	Function string
+	Class    string
+	Line     int
+	File     string
+}
+
+func (f StackFrame) String() string {
+	name := f.Function
+	if f.Class != "" {
+		name = f.Class + "." + name
+	}
+
+	if f.File == "" {
+		return fmt.Sprintf("at %s, called from line %d", name, f.Line)
+	}
+	return fmt.Sprintf("at %s, called from %s:%d", name, f.File, f.Line)
+}
+
+// FunctionName is the name used for a function in stack traces. Lambdas are
+// named after the 'fun' keyword that declares them.
+func FunctionName(name string) string {
+	if name == "fun" {
+		return "<lambda>"
+	}
+	return name
+}
+
+// AddStackFrame records that err unwound through frame.
+func AddStackFrame(err error, frame StackFrame) error {
+	IfLoxError(err, func(loxError *LoxError) {
+		loxError.trace = append(loxError.trace, frame)
+	})
+	return err
+}
+
+// NewThrownError creates the error raised by a throw statement. Throwing a
+// caught error again raises a copy of the original error, which goes on to
+// record the calls it unwinds through from the throw.
+func NewThrownError(value interface{}, token Token) error {
+	switch value := value.(type) {
+	case *ErrorObject:
+		return value.err.rethrown()
+	case *LoxError:
+		return value.rethrown()
+	}
+
+	return &LoxError{
+		line:             token.Line,
+		where:            token.Lexeme,
+		message:          fmt.Sprintf("Uncaught exception: %v", value),
+		runtimeErrorType: E_THROWN,
+		thrown:           value,
+		span:             token.Span(),
+	}
+}
+
+func (err *LoxError) rethrown() *LoxError {
+	copied := *err
+	copied.trace = append([]StackFrame(nil), err.trace...)
+	return &copied
+}
+
+// CaughtValue returns the value a catch clause binds for err: the value given
+// to throw, or an ErrorObject describing a runtime error.
+func CaughtValue(err error) interface{} {
+	var loxError *LoxError
+	if !errors.As(err, &loxError) {
+		loxError = &LoxError{line: -1, message: err.Error(), runtimeErrorType: E_NO_ERROR}
+	}
+
+	if loxError.runtimeErrorType == E_THROWN {
+		return loxError.thrown
+	}
+
+	return &ErrorObject{err: loxError}
+}
+
+// ErrorObject exposes a caught runtime error to Lox code.
+type ErrorObject struct {
+	err *LoxError
+}
+
+func (e *ErrorObject) Get(property string) (interface{}, bool) {
+	switch property {
+	case "message":
+		return e.err.message, true
+	case "line":
+		return float64(e.err.line), true
+	case "column":
+		return float64(e.err.span.Start.Column), true
+	case "type":
+		return ErrorTypeNames[e.err.runtimeErrorType], true
+	}
+
+	return nil, false
+}
+
+func (e *ErrorObject) String() string {
+	return fmt.Sprintf("%s: %s", ErrorTypeNames[e.err.runtimeErrorType], e.err.message)
 }
 
 func NewError(line int, message string) error {
@@ -39,10 +257,56 @@ func NewRuntimeError(errorType int32, line int, where string, message string) er
 	return &LoxError{runtimeErrorType: errorType, line: line, message: message, where: where}
 }
 
+// LimitError creates the error raised when a program exceeds a limit set in
+// its InterpreterConfig or is cancelled, positioned at span.
+func LimitError(errorType int32, span Span, message string) error {
+	return &LoxError{runtimeErrorType: errorType, line: span.Start.Line, message: message, span: span}
+}
+
+// NewNativeError creates an error for a native function to return. It is
+// reported at the line of the call that invoked the native function.
+func NewNativeError(errorType int32, message string) error {
+	return &LoxError{line: -1, message: message, where: "", runtimeErrorType: errorType}
+}
+
+// AtToken fills in the position of errors created by NewNativeError.
+func AtToken(err error, token Token) error {
+	IfLoxError(err, func(loxError *LoxError) {
+		if loxError.line < 0 {
+			loxError.line = token.Line
+			loxError.where = token.Lexeme
+			loxError.span = token.Span()
+		}
+	})
+	return err
+}
+
 func NewTokenError(line int, where string, message string) error {
 	return &LoxError{line: line, message: message, where: where, runtimeErrorType: E_NO_ERROR}
 }
 
+// withSpan positions err at span unless it already has a position.
+func withSpan(err error, span Span) error {
+	IfLoxError(err, func(loxError *LoxError) {
+		if loxError.span.IsZero() {
+			loxError.span = span
+		}
+	})
+	return err
+}
+
+// inFile records that err was raised in file, whose text is source, unless
+// its file is already known.
+func inFile(err error, file string, source string) error {
+	IfLoxError(err, func(loxError *LoxError) {
+		if loxError.file == "" {
+			loxError.file = file
+			loxError.source = source
+		}
+	})
+	return err
+}
+
 func IfLoxError(err error, callback func(*LoxError)) bool {
 	if err == nil {
 		return false
@@ -56,6 +320,20 @@ func IfLoxError(err error, callback func(*LoxError)) bool {
 	return false
 }
 
+// IsUncatchable reports whether err is one of the errors raised when a
+// program exceeds its limits or is cancelled. Try statements do not catch
+// them, so a script cannot keep running past its budget.
+func IsUncatchable(err error) bool {
+	uncatchable := false
+	IfLoxError(err, func(loxError *LoxError) {
+		switch loxError.runtimeErrorType {
+		case E_STEP_LIMIT_EXCEEDED, E_CALL_DEPTH_EXCEEDED, E_CANCELLED, E_MEMORY_LIMIT_EXCEEDED:
+			uncatchable = true
+		}
+	})
+	return uncatchable
+}
+
 func IsLoxError(err error) bool {
 	if err == nil {
 		return false
@@ -66,9 +344,9 @@ func IsLoxError(err error) bool {
 }
 
 func (t Token) ToError(msg string) error {
-	return NewTokenError(t.Line, t.Lexeme, msg)
+	return withSpan(NewTokenError(t.Line, t.Lexeme, msg), t.Span())
 }
 
 func (t Token) ToRuntimeError(errorType int32, msg string) error {
-	return NewRuntimeError(errorType, t.Line, t.Lexeme, msg)
+	return withSpan(NewRuntimeError(errorType, t.Line, t.Lexeme, msg), t.Span())
 }
@@ -2,6 +2,7 @@ package interpreter
 
 type Expr interface {
   Accept(visitor ExprVisitor) interface{}
+  Span() Span
 }
 
 type ExprVisitor interface {
@@ -18,10 +19,16 @@ type ExprVisitor interface {
   VisitGet(expr *Get) interface{}
   VisitSet(expr *Set) interface{}
   VisitLambda(expr *Lambda) interface{}
+  VisitListLiteral(expr *ListLiteral) interface{}
+  VisitMapLiteral(expr *MapLiteral) interface{}
+  VisitGetIndex(expr *GetIndex) interface{}
+  VisitSetIndex(expr *SetIndex) interface{}
+  VisitAwait(expr *Await) interface{}
 }
 
 type Binary struct {
   Expr
+  span Span
   Left Expr
   Operator Token
   Right Expr
@@ -31,8 +38,17 @@ func (e *Binary) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitBinary(e)
 }
 
+func (e *Binary) Span() Span {
+  return e.span
+}
+
+func (e *Binary) SetSpan(span Span) {
+  e.span = span
+}
+
 type Logical struct {
   Expr
+  span Span
   Left Expr
   Operator Token
   Right Expr
@@ -42,8 +58,17 @@ func (e *Logical) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitLogical(e)
 }
 
+func (e *Logical) Span() Span {
+  return e.span
+}
+
+func (e *Logical) SetSpan(span Span) {
+  e.span = span
+}
+
 type Grouping struct {
   Expr
+  span Span
   Expression Expr
 }
 
@@ -51,8 +76,17 @@ func (e *Grouping) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitGrouping(e)
 }
 
+func (e *Grouping) Span() Span {
+  return e.span
+}
+
+func (e *Grouping) SetSpan(span Span) {
+  e.span = span
+}
+
 type Literal struct {
   Expr
+  span Span
   Value interface{}
 }
 
@@ -60,8 +94,17 @@ func (e *Literal) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitLiteral(e)
 }
 
+func (e *Literal) Span() Span {
+  return e.span
+}
+
+func (e *Literal) SetSpan(span Span) {
+  e.span = span
+}
+
 type Unary struct {
   Expr
+  span Span
   Operator Token
   Right Expr
 }
@@ -70,8 +113,17 @@ func (e *Unary) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitUnary(e)
 }
 
+func (e *Unary) Span() Span {
+  return e.span
+}
+
+func (e *Unary) SetSpan(span Span) {
+  e.span = span
+}
+
 type TernaryCondition struct {
   Expr
+  span Span
   Condition Expr
   TrueBranch Expr
   FalseBranch Expr
@@ -81,8 +133,17 @@ func (e *TernaryCondition) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitTernaryCondition(e)
 }
 
+func (e *TernaryCondition) Span() Span {
+  return e.span
+}
+
+func (e *TernaryCondition) SetSpan(span Span) {
+  e.span = span
+}
+
 type Assign struct {
   Expr
+  span Span
   Name Token
   Value Expr
 }
@@ -91,8 +152,17 @@ func (e *Assign) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitAssign(e)
 }
 
+func (e *Assign) Span() Span {
+  return e.span
+}
+
+func (e *Assign) SetSpan(span Span) {
+  e.span = span
+}
+
 type Variable struct {
   Expr
+  span Span
   Name Token
 }
 
@@ -100,8 +170,17 @@ func (e *Variable) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitVariable(e)
 }
 
+func (e *Variable) Span() Span {
+  return e.span
+}
+
+func (e *Variable) SetSpan(span Span) {
+  e.span = span
+}
+
 type Call struct {
   Expr
+  span Span
   Callee Expr
   Paren Token
   Arguments []Expr
@@ -111,8 +190,17 @@ func (e *Call) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitCall(e)
 }
 
+func (e *Call) Span() Span {
+  return e.span
+}
+
+func (e *Call) SetSpan(span Span) {
+  e.span = span
+}
+
 type Super struct {
   Expr
+  span Span
   Super Token
   Call Token
 }
@@ -121,8 +209,17 @@ func (e *Super) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitSuper(e)
 }
 
+func (e *Super) Span() Span {
+  return e.span
+}
+
+func (e *Super) SetSpan(span Span) {
+  e.span = span
+}
+
 type Get struct {
   Expr
+  span Span
   Object Expr
   Name Token
 }
@@ -131,8 +228,17 @@ func (e *Get) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitGet(e)
 }
 
+func (e *Get) Span() Span {
+  return e.span
+}
+
+func (e *Get) SetSpan(span Span) {
+  e.span = span
+}
+
 type Set struct {
   Expr
+  span Span
   Object Expr
   Name Token
   Value Expr
@@ -142,15 +248,133 @@ func (e *Set) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitSet(e)
 }
 
+func (e *Set) Span() Span {
+  return e.span
+}
+
+func (e *Set) SetSpan(span Span) {
+  e.span = span
+}
+
 type Lambda struct {
   Expr
+  span Span
   Name Token
   Params []Token
   Body []Stmt
+  IsAsync bool
+  IsGenerator bool
 }
 
 func (e *Lambda) Accept(visitor ExprVisitor) interface{} {
   return visitor.VisitLambda(e)
 }
 
+func (e *Lambda) Span() Span {
+  return e.span
+}
+
+func (e *Lambda) SetSpan(span Span) {
+  e.span = span
+}
+
+type ListLiteral struct {
+  Expr
+  span Span
+  Bracket Token
+  Elements []Expr
+}
+
+func (e *ListLiteral) Accept(visitor ExprVisitor) interface{} {
+  return visitor.VisitListLiteral(e)
+}
+
+func (e *ListLiteral) Span() Span {
+  return e.span
+}
+
+func (e *ListLiteral) SetSpan(span Span) {
+  e.span = span
+}
+
+type MapLiteral struct {
+  Expr
+  span Span
+  Brace Token
+  Keys []Expr
+  Values []Expr
+}
+
+func (e *MapLiteral) Accept(visitor ExprVisitor) interface{} {
+  return visitor.VisitMapLiteral(e)
+}
+
+func (e *MapLiteral) Span() Span {
+  return e.span
+}
+
+func (e *MapLiteral) SetSpan(span Span) {
+  e.span = span
+}
+
+type GetIndex struct {
+  Expr
+  span Span
+  Object Expr
+  Bracket Token
+  Index Expr
+}
+
+func (e *GetIndex) Accept(visitor ExprVisitor) interface{} {
+  return visitor.VisitGetIndex(e)
+}
+
+func (e *GetIndex) Span() Span {
+  return e.span
+}
+
+func (e *GetIndex) SetSpan(span Span) {
+  e.span = span
+}
+
+type SetIndex struct {
+  Expr
+  span Span
+  Object Expr
+  Bracket Token
+  Index Expr
+  Value Expr
+}
+
+func (e *SetIndex) Accept(visitor ExprVisitor) interface{} {
+  return visitor.VisitSetIndex(e)
+}
+
+func (e *SetIndex) Span() Span {
+  return e.span
+}
+
+func (e *SetIndex) SetSpan(span Span) {
+  e.span = span
+}
+
+type Await struct {
+  Expr
+  span Span
+  Keyword Token
+  Value Expr
+}
+
+func (e *Await) Accept(visitor ExprVisitor) interface{} {
+  return visitor.VisitAwait(e)
+}
+
+func (e *Await) Span() Span {
+  return e.span
+}
+
+func (e *Await) SetSpan(span Span) {
+  e.span = span
+}
+
 
@@ -0,0 +1,142 @@
+package interpreter
+
+import "fmt"
+
+// Generator is the result of calling a function that yields. The function runs
+// on a coroutine of its own, started the first time the generator is asked for
+// a value, which only runs up to its next yield each time. Coroutines left
+// waiting once the host is done are stopped by Close.
+type Generator struct {
+	name     string
+	state    *Interpreter
+	body     func(state *Interpreter) interface{}
+	started  bool
+	finished bool
+	closing  bool
+	// buffered is set while value holds a yielded value that next has not
+	// returned yet.
+	buffered bool
+	value    interface{}
+	err      error
+}
+
+// newGenerator returns a generator of the values body yields, without running
+// any of it yet.
+func (i *Interpreter) newGenerator(name string, body func(state *Interpreter) interface{}) *Generator {
+	g := &Generator{name: name, state: i.fork(), body: body}
+	g.state.callSite = i.callSite
+	g.state.generator = g
+	return g
+}
+
+// start runs the body on a new coroutine, which waits to be resumed.
+func (g *Generator) start() {
+	g.started = true
+	g.state.coroutine = &coroutine{resume: make(chan struct{}), yield: make(chan struct{})}
+	g.state.shared.generators[g] = struct{}{}
+
+	go func() {
+		<-g.state.coroutine.resume
+		value := g.body(g.state)
+		if err, ok := value.(error); ok {
+			g.err = AtToken(err, g.state.callSite)
+		}
+		g.finished = true
+		delete(g.state.shared.generators, g)
+		g.state.coroutine.yield <- struct{}{}
+	}()
+}
+
+// close stops a started generator by raising an uncatchable error at the yield
+// it waits at, so that its pending finally blocks run.
+func (g *Generator) close(i *Interpreter) {
+	g.closing = true
+	if g.started && !g.finished {
+		i.resume(g.state)
+	}
+	g.finished, g.buffered, g.value, g.err = true, false, nil, nil
+}
+
+// Close stops the generators that were started but never finished. RunProgram
+// closes the interpreter it runs a program on; a host that runs programs on
+// its own interpreter calls Close once it no longer uses their values.
+func (i *Interpreter) Close() {
+	defer i.enter()()
+	for len(i.shared.generators) > 0 {
+		for g := range i.shared.generators {
+			g.close(i)
+			delete(i.shared.generators, g)
+		}
+	}
+}
+
+// advance runs the generator up to its next yield, unless a yielded value is
+// still waiting to be returned.
+func (g *Generator) advance(i *Interpreter) error {
+	if g.buffered || g.finished {
+		return nil
+	}
+
+	if !g.started {
+		g.start()
+	}
+	i.resume(g.state)
+	if g.finished {
+		err := g.err
+		g.err = nil
+		return err
+	}
+	g.buffered = true
+	return nil
+}
+
+// yield hands value to the code asking the generator for it, and waits to be
+// resumed. It fails once the generator is being closed.
+func (g *Generator) yield(value interface{}) error {
+	if !g.closing {
+		g.value = value
+		g.state.coroutine.yield <- struct{}{}
+		<-g.state.coroutine.resume
+	}
+
+	if g.closing {
+		return NewNativeError(E_CANCELLED, "Generator closed")
+	}
+	return nil
+}
+
+func (g *Generator) TypeName() string {
+	return "generator"
+}
+
+func (g *Generator) String() string {
+	return fmt.Sprintf("<generator %s>", g.name)
+}
+
+func (g *Generator) Get(property string) (interface{}, bool) {
+	switch property {
+	case "next":
+		// next returns the next value, or nil once the generator is done.
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			if err := g.advance(i); err != nil {
+				return err
+			}
+			if !g.buffered {
+				return nil
+			}
+
+			value := g.value
+			g.buffered, g.value = false, nil
+			return value
+		}), true
+	case "done":
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			if err := g.advance(i); err != nil {
+				return err
+			}
+			return !g.buffered
+		}), true
+	}
+
+	return nil, false
+}
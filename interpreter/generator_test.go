@@ -0,0 +1,198 @@
+package interpreter
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		name     string
+		program  string
+		expected []string
+	}{
+		{
+			"next and done",
+			`
+fun count(n) {
+	for (var i = 0; i < n; i = i + 1) {
+		yield i;
+	}
+}
+var gen = count(3);
+print gen;
+print type(gen);
+while (!gen.done()) {
+	print gen.next();
+}
+print gen.next();
+print gen.done();
+`,
+			[]string{"<generator count>", "generator", "0", "1", "2", "<nil>", "true"},
+		},
+		{
+			"lazy and infinite",
+			`
+fun naturals() {
+	var n = 0;
+	while (true) {
+		print "yielding " + n;
+		yield n;
+		n = n + 1;
+	}
+}
+var gen = naturals();
+print "created";
+print gen.next();
+print gen.next();
+`,
+			[]string{"created", "yielding 0", "0", "yielding 1", "1"},
+		},
+		{
+			"return ends the generator",
+			`
+fun firstTwo(list) {
+	for (var i = 0; i < list.len(); i = i + 1) {
+		if (i == 2) {
+			return;
+		}
+		yield list[i];
+	}
+}
+var gen = firstTwo(["a", "b", "c"]);
+print gen.next();
+print gen.next();
+print gen.done();
+`,
+			[]string{"a", "b", "true"},
+		},
+		{
+			"methods, lambdas and nested generators",
+			`
+class Range {
+	fun init(start, end) {
+		this.start = start;
+		this.end = end;
+	}
+	fun values() {
+		for (var i = this.start; i < this.end; i = i + 1) {
+			yield i;
+		}
+	}
+}
+var doubled = fun (gen) {
+	while (!gen.done()) {
+		yield gen.next() * 2;
+	}
+};
+var gen = doubled(Range(1, 4).values());
+while (!gen.done()) {
+	print gen.next();
+}
+`,
+			[]string{"2", "4", "6"},
+		},
+		{
+			"errors are raised by next",
+			`
+fun failing() {
+	yield 1;
+	throw "failed";
+}
+var gen = failing();
+print gen.next();
+try {
+	gen.next();
+} catch (e) {
+	print e;
+}
+print gen.done();
+`,
+			[]string{"1", "failed", "true"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := runLoopProgram(test.program, nil, nil)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(output, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		program   string
+		errorType int32
+	}{
+		{`yield 1;`, E_UNEXPECTED_YIELD},
+		{`class A { fun init() { yield 1; } }`, E_UNEXPECTED_YIELD},
+		{`async fun f() { yield 1; }`, E_UNEXPECTED_YIELD},
+		{`fun f() { yield 1; return 2; }`, E_UNEXPECTED_RETURN},
+		{`fun f() { yield 1 + nil; } f().next();`, E_UNEXPECTED_TYPE},
+	}
+
+	for _, test := range tests {
+		_, err := runLoopProgram(test.program, nil, nil)
+		var loxError *LoxError
+		if !errors.As(err, &loxError) || loxError.Type() != test.errorType {
+			t.Errorf("%s: expected %s, got %v", test.program, ErrorTypeNames[test.errorType], err)
+		}
+	}
+}
+
+// TestGeneratorsAreClosed checks that generators left unfinished do not keep
+// goroutines alive once their program has run.
+func TestGeneratorsAreClosed(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	program := `
+fun count() {
+	var n = 0;
+	try {
+		while (true) {
+			yield n;
+			n = n + 1;
+		}
+	} catch (e) {
+		print "caught";
+	} finally {
+		print "closed";
+		yield n;
+	}
+}
+for (var i = 0; i < 10000; i = i + 1) {
+	count();
+}
+for (var i = 0; i < 3; i = i + 1) {
+	count().next();
+}
+`
+	output := make([]string, 0)
+	errs := RunProgram(InterpreterConfig{PrintFunc: func(value string) { output = append(output, value) }}, program)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	expected := []string{"closed", "closed", "closed"}
+	if !reflect.DeepEqual(output, expected) {
+		t.Errorf("expected %v, got %v", expected, output)
+	}
+
+	// Closed coroutines exit right after handing control back.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("expected at most %d goroutines, got %d", before, after)
+	}
+}
@@ -0,0 +1,149 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// enter starts running Lox code for the host. The step and memory budgets
+// start over unless the host is already running code, as it is when a Go
+// function called from Lox calls back into it. The returned function ends
+// the run.
+func (i *Interpreter) enter() func() {
+	i.lock()
+	if i.shared.running == 0 {
+		i.shared.steps = 0
+		i.shared.memory = MemoryStats{}
+	}
+	i.shared.running++
+	return func() {
+		i.shared.running--
+		i.unlock()
+	}
+}
+
+// Global returns the value of the global variable name, reporting whether it
+// is defined.
+func (i *Interpreter) Global(name string) (interface{}, bool) {
+	i.shared.lock.Lock()
+	defer i.shared.lock.Unlock()
+
+	value, ok := i.shared.globals.Values[name]
+	return value, ok
+}
+
+// GlobalNames returns the names of the global variables, sorted.
+func (i *Interpreter) GlobalNames() []string {
+	i.shared.lock.Lock()
+	defer i.shared.lock.Unlock()
+
+	names := make([]string, 0, len(i.shared.globals.Values))
+	for name := range i.shared.globals.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Call calls a Lox function, bound method or class with arguments converted
+// from Go values as RegisterFunc converts results. It returns the Lox value
+// the call returned, which Decode converts to a Go value, or the *LoxError
+// the call raised.
+//
+// Call, like Global and Decode, can be used from any goroutine, including
+// from Go functions registered with RegisterFunc while Lox calls them, but
+// not from a NativeCallable, which runs with the interpreter locked. Each call
+// runs as a task of its own and waits for the event loop and the tasks it
+// spawns. Calling an async function returns the value of its future.
+func (i *Interpreter) Call(callee interface{}, arguments ...interface{}) (interface{}, error) {
+	callable, ok := callee.(Callable)
+	if !ok {
+		return nil, NewRuntimeError(E_CANNOT_CALL, 0, "", fmt.Sprintf("Can only call functions or classes, got %s", TypeOf(callee)))
+	}
+
+	site := Token{Lexeme: callable.String()}
+	if callable.Arity() != len(arguments) {
+		message := fmt.Sprintf("'%s' expects %d arguments, got %d", callable, callable.Arity(), len(arguments))
+		return nil, NewRuntimeError(E_INVALID_ARGUMENTS, 0, site.Lexeme, message)
+	}
+
+	task := i.fork()
+	defer task.enter()()
+
+	values := make([]interface{}, len(arguments))
+	for idx, argument := range arguments {
+		value, err := task.toLox(reflect.ValueOf(argument))
+		if err != nil {
+			message := fmt.Sprintf("Argument %d of '%s': %v", idx+1, callable, err)
+			return nil, NewRuntimeError(E_INVALID_ARGUMENTS, 0, site.Lexeme, message)
+		}
+		values[idx] = value
+	}
+
+	task.callSite = site
+	value := callable.Call(task, values)
+	if err, ok := value.(error); ok {
+		task.waitForTasks()
+		return nil, AtToken(err, site)
+	}
+
+	// The result of an async function is returned once it is ready.
+	if future, ok := value.(*Future); ok {
+		var err error
+		if value, err = task.await(future); err != nil {
+			task.waitForTasks()
+			return nil, AtToken(err, site)
+		}
+	}
+	if err := task.finish(); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// CallGlobal calls the global function or class name.
+func (i *Interpreter) CallGlobal(name string, arguments ...interface{}) (interface{}, error) {
+	callee, ok := i.Global(name)
+	if !ok {
+		return nil, NewRuntimeError(E_UNDEFINED_VARIABLE, 0, name, "Undefined variable")
+	}
+	return i.Call(callee, arguments...)
+}
+
+// Stringify formats value as print shows it, calling the toString method of
+// instances whose class defines one, including those in lists and maps.
+func (i *Interpreter) Stringify(value interface{}) (string, error) {
+	task := i.fork()
+	defer task.enter()()
+
+	str, err := task.stringify(value, Token{Lexeme: "toString"})
+	if err != nil {
+		task.waitForTasks()
+		return "", err
+	}
+	if err := task.finish(); err != nil {
+		return "", err
+	}
+	return str, nil
+}
+
+// Decode converts a Lox value to the Go value target points to, as the
+// arguments of functions registered with RegisterFunc are converted.
+func (i *Interpreter) Decode(value interface{}, target interface{}) error {
+	pointer := reflect.ValueOf(target)
+	if pointer.Kind() != reflect.Pointer || pointer.IsNil() {
+		return errors.New("lox: Decode needs a non-nil pointer")
+	}
+
+	i.shared.lock.Lock()
+	defer i.shared.lock.Unlock()
+
+	converted, err := i.fromLox(value, pointer.Type().Elem())
+	if err != nil {
+		return fmt.Errorf("lox: %v", err)
+	}
+	pointer.Elem().Set(converted)
+	return nil
+}
@@ -0,0 +1,166 @@
+package interpreter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	output := make([]string, 0)
+	i := NewInterpreter(InterpreterConfig{PrintFunc: func(value string) {
+		output = append(output, value)
+	}})
+
+	program := `
+var config = {"port": 8080, "hosts": ["a", "b"]};
+var greeting = "hello";
+
+fun handle(request) {
+	print "handling " + request["path"];
+	return {"status": 200, "body": greeting + " " + request["user"]};
+}
+
+fun fail(message) {
+	return message - 1;
+}
+
+class Counter {
+	fun init(start) {
+		this.count = start;
+	}
+	fun add(n) {
+		this.count = this.count + n;
+		return this.count;
+	}
+	fun toString() {
+		return "counter at " + this.count;
+	}
+}
+`
+	stmts, errs := Compile(program, NewResolver(i))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	if _, err := i.Interpret(stmts); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	config, ok := i.Global("config")
+	if !ok {
+		t.Fatalf("expected config to be defined")
+	}
+	var port int
+	if err := i.Decode(config.(*LoxMap).Values()[0], &port); err != nil || port != 8080 {
+		t.Errorf("unexpected port %d, %v", port, err)
+	}
+	var settings map[string]interface{}
+	if err := i.Decode(config, &settings); err != nil || !reflect.DeepEqual(settings["hosts"], []interface{}{"a", "b"}) {
+		t.Errorf("unexpected settings %v, %v", settings, err)
+	}
+	if _, ok := i.Global("missing"); ok {
+		t.Errorf("expected missing not to be defined")
+	}
+
+	response, err := i.CallGlobal("handle", map[string]string{"path": "/", "user": "bob"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	decoded := map[string]interface{}{}
+	if err := i.Decode(response, &decoded); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(decoded, map[string]interface{}{"status": 200.0, "body": "hello bob"}) {
+		t.Errorf("unexpected response %v", decoded)
+	}
+	if !reflect.DeepEqual(output, []string{"handling /"}) {
+		t.Errorf("unexpected output %v", output)
+	}
+
+	// Classes are called to create instances, whose methods are bound.
+	counter, err := i.CallGlobal("Counter", 10)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	add, ok := counter.(*KlassInstance).Get("add")
+	if !ok {
+		t.Fatalf("expected counter to have an add method")
+	}
+	i.Call(add, 5)
+	total, err := i.Call(add, 2)
+	if err != nil || total != 17.0 {
+		t.Errorf("expected 17, got %v, %v", total, err)
+	}
+
+	badCalls := []struct {
+		callee    string
+		arguments []interface{}
+		errorType int32
+	}{
+		{"fail", []interface{}{"oops"}, E_UNEXPECTED_TYPE},
+		{"handle", nil, E_INVALID_ARGUMENTS},
+		{"handle", []interface{}{make(chan int)}, E_INVALID_ARGUMENTS},
+		{"greeting", nil, E_CANNOT_CALL},
+		{"missing", nil, E_UNDEFINED_VARIABLE},
+	}
+	for _, test := range badCalls {
+		_, err := i.CallGlobal(test.callee, test.arguments...)
+		var loxError *LoxError
+		if !errors.As(err, &loxError) || loxError.Type() != test.errorType {
+			t.Errorf("%s: expected %s, got %v", test.callee, ErrorTypeNames[test.errorType], err)
+		}
+	}
+
+	for value, expected := range map[interface{}]string{counter: "counter at 17", 1.5: "1.5", NewList([]interface{}{counter, 2.0}): "[counter at 17, 2]"} {
+		if str, err := i.Stringify(value); err != nil || str != expected {
+			t.Errorf("expected %q, got %q, %v", expected, str, err)
+		}
+	}
+
+	var name string
+	if err := i.Decode(8080.0, &name); err == nil {
+		t.Errorf("expected decoding a number into a string to fail")
+	}
+}
+
+func TestCallLimits(t *testing.T) {
+	i := NewInterpreter(InterpreterConfig{PrintFunc: func(string) {}, MaxSteps: 50})
+	stmts, errs := Compile("fun spin(n) { while (n > 0) { n = n - 1; } return n; }", NewResolver(i))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	if _, err := i.Interpret(stmts); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Every call gets the whole budget.
+	for n := 0; n < 3; n++ {
+		if _, err := i.CallGlobal("spin", 10); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	_, err := i.CallGlobal("spin", 100)
+	var loxError *LoxError
+	if !errors.As(err, &loxError) || loxError.Type() != E_STEP_LIMIT_EXCEEDED {
+		t.Errorf("expected the step limit to be exceeded, got %v", err)
+	}
+}
+
+// TestNestedCallLimits checks that calling back into Lox from a registered
+// Go function does not start the budget of the running program over.
+func TestNestedCallLimits(t *testing.T) {
+	i := NewInterpreter(InterpreterConfig{PrintFunc: func(string) {}, MaxSteps: 50})
+	i.RegisterFunc("reset", func() { i.CallGlobal("noop") })
+
+	stmts, errs := Compile("fun noop() {} for (var n = 0; n < 1000; n = n + 1) { reset(); }", NewResolver(i))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	_, err := i.Interpret(stmts)
+	var loxError *LoxError
+	if !errors.As(err, &loxError) || loxError.Type() != E_STEP_LIMIT_EXCEEDED {
+		t.Errorf("expected the step limit to be exceeded, got %v", err)
+	}
+}
@@ -1,10 +1,40 @@
 package interpreter
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
 
 type InterpreterConfig struct {
 	PrintFunc           func(string)
 	GlobalFuncOverrides map[string]Callable
+
+	// ScriptPath is the file being run. Imports are resolved relative to the
+	// importing file, starting from this one or the working directory.
+	ScriptPath string
+	// ReadModule loads the source of an imported module. It defaults to
+	// reading the file system with the permissions of the host process, so
+	// a script can import any file it names, including absolute paths and
+	// paths outside its own directory. Hosts running untrusted scripts
+	// should set it to restrict what can be imported.
+	ReadModule func(path string) (string, error)
+
+	// MaxSteps bounds the statements a call to Interpret executes, or the
+	// instructions on the VM, and MaxCallDepth the function calls in
+	// progress at once, counting those that started a task, async call or
+	// generator. Zero means no limit, though both backends still fail with
+	// E_STACK_OVERFLOW once calls nest too deeply for them.
+	MaxSteps     int
+	MaxCallDepth int
+	// MaxMemory bounds the approximate bytes a call to Interpret allocates
+	// for strings, instances, environments, closures, lists, maps and
+	// channels. Zero means no limit.
+	MaxMemory int
+	// Context cancels the program when it is done.
+	Context context.Context
+	// Clock is the time timers run on, the system clock if nil.
+	Clock Clock
 }
 
 var DefaultInterpreterConfig = InterpreterConfig{
@@ -18,33 +48,50 @@ type Interpreter struct {
 	config            InterpreterConfig
 	globalEnvironment *Environment
 	environment       *Environment
-	callstack         []string
+	callstack         []Activation
+	depth             int
+	callSite          Token
 	locals            map[Expr]int
+	modulePath        string
+	modules           map[string]*Module
+	files             map[*Environment]string
+	sources           map[string]string
+	debugger          Debugger
+	limited           bool
+	types             map[reflect.Type]string
+	shared            *shared
+	locked            bool
+	coroutine         *coroutine
+	generator         *Generator
 }
 
 type result struct {
-	Value        interface{}
-	IsStmtReturn bool
-	Err          error
+	Value          interface{}
+	IsStmtReturn   bool
+	IsStmtBreak    bool
+	IsStmtContinue bool
+	Err            error
 }
 
 func Result(value interface{}) *result {
-	return &result{value, false, nil}
+	return &result{Value: value}
 }
 
 func Error(err error) *result {
-	return &result{nil, false, err}
+	return &result{Err: err}
 }
 
 func Return(value interface{}) *result {
-	return &result{value, true, nil}
+	return &result{Value: value, IsStmtReturn: true}
 }
 
 func (r *result) IsBlockBreaking() bool {
-	return r.IsError() || r.IsStmtReturn
+	return r.IsError() || r.IsStmtReturn || r.IsStmtBreak || r.IsStmtContinue
 }
 
 var Void = Result(nil)
+var Break = &result{IsStmtBreak: true}
+var Continue = &result{IsStmtContinue: true}
 
 func (r *result) IsError() bool {
 	return r.Err != nil
@@ -58,14 +105,6 @@ func (r *result) ToNumber() (float64, bool) {
 	return value, ok
 }
 
-func (r *result) coerceString() string {
-	// Expect the caller to check for errors
-	if r.IsError() {
-		panic("Cannot coerce error")
-	}
-	return fmt.Sprintf("%v", r.Value)
-}
-
 func (r *result) ToString() (string, bool) {
 	if r.IsError() {
 		return "", false
@@ -108,9 +147,17 @@ func (r *result) IsTruthy() bool {
 	return false
 }
 
-func NewInterpreter(config InterpreterConfig) *Interpreter {
+func newGlobalEnvironment(config InterpreterConfig) *Environment {
 	globals := NewEnvironment()
 	globals.Define("clock", ClockFunc)
+	// Tasks and the event loop only run on the tree-walking interpreter.
+	globals.Define("spawn", SpawnFunc)
+	globals.Define("channel", ChannelFunc)
+	globals.Define("sleep", SleepFunc)
+	globals.Define("setTimeout", SetTimeoutFunc)
+	for key, value := range StandardLibrary() {
+		globals.Define(key, value)
+	}
 
 	if config.GlobalFuncOverrides != nil {
 		for key, value := range config.GlobalFuncOverrides {
@@ -118,15 +165,38 @@ func NewInterpreter(config InterpreterConfig) *Interpreter {
 		}
 	}
 
-	return &Interpreter{environment: globals, config: config, globalEnvironment: globals, callstack: make([]string, 0), locals: make(map[Expr]int)}
+	return globals
+}
+
+func NewInterpreter(config InterpreterConfig) *Interpreter {
+	globals := newGlobalEnvironment(config)
+	return &Interpreter{
+		environment:       globals,
+		config:            config,
+		globalEnvironment: globals,
+		callstack:         make([]Activation, 0),
+		locals:            make(map[Expr]int),
+		modulePath:        config.ScriptPath,
+		modules:           make(map[string]*Module),
+		files:             map[*Environment]string{globals: config.ScriptPath},
+		sources:           make(map[string]string),
+		types:             make(map[reflect.Type]string),
+		limited:           config.MaxSteps > 0 || config.MaxMemory > 0 || config.Context != nil,
+		shared:            &shared{globals: globals, loop: newEventLoop(), generators: make(map[*Generator]struct{}), host: make(map[string]interface{})},
+	}
 }
 
 func (i *Interpreter) resolve(expr Expr, hops int) {
 	i.locals[expr] = hops
 }
 
-func (i *Interpreter) PushCallstack(functionName string) {
-	i.callstack = append(i.callstack, functionName)
+func (i *Interpreter) PushCallstack(frame StackFrame) {
+	i.pushCall(frame, nil)
+}
+
+// pushCall records a function call whose parameters are defined in locals.
+func (i *Interpreter) pushCall(frame StackFrame, locals *Environment) {
+	i.callstack = append(i.callstack, Activation{Frame: frame, Caller: i.environment, Locals: locals})
 }
 
 func (i *Interpreter) PopCallstack() {
@@ -134,24 +204,72 @@ func (i *Interpreter) PopCallstack() {
 }
 
 func (i *Interpreter) Interpret(stmt []Stmt) (interface{}, error) {
+	defer i.enter()()
 	r := i.executeGlobalBlock(stmt)
 	if re, ok := r.(*result); ok {
 		if re.IsError() {
+			i.waitForTasks()
 			return nil, re.Err
 		}
 	}
+	if err := i.finish(); err != nil {
+		return nil, err
+	}
 
 	return r, nil
 }
 
 func (i *Interpreter) InterpretExpr(expr Expr) (interface{}, error) {
+	defer i.enter()()
 	result := expr.Accept(i).(*result)
 	if result.IsError() {
+		i.waitForTasks()
 		return nil, result.Err
 	}
+	if err := i.finish(); err != nil {
+		return nil, err
+	}
 	return result.Value, nil
 }
 
+// stringify formats value as print shows it, calling the toString method of
+// instances whose class defines one from at, including those in lists and
+// maps.
+func (i *Interpreter) stringify(value interface{}, at Token) (string, error) {
+	return i.format(value, at, formatting{})
+}
+
+// format is stringify for a value inside the lists and maps in seen.
+func (i *Interpreter) format(value interface{}, at Token, seen formatting) (string, error) {
+	element := func(value interface{}) (string, error) {
+		return i.format(value, at, seen)
+	}
+	switch value := value.(type) {
+	case *LoxList:
+		return value.format(seen, element)
+	case *LoxMap:
+		return value.format(seen, element)
+	}
+
+	toString := findMethod(value, "toString")
+	if toString == nil {
+		return fmt.Sprintf("%v", value), nil
+	}
+	if toString.Arity() != 0 {
+		return "", at.ToRuntimeError(E_INVALID_ARGUMENTS, "toString must not take any arguments")
+	}
+
+	i.callSite = at
+	str := toString.Call(i, []interface{}{})
+	if err, ok := str.(error); ok {
+		return "", AtToken(err, at)
+	}
+	if str, ok := str.(string); ok {
+		return str, nil
+	}
+	return "", at.ToRuntimeError(E_UNEXPECTED_TYPE, fmt.Sprintf("toString must return a string, not %s", TypeOf(str)))
+}
+
 func (i *Interpreter) evaluateExpression(expr Expr) *result {
 	r := expr.Accept(i).(*result)
 	return r
@@ -210,13 +328,30 @@ func (i *Interpreter) VisitBinary(expr *Binary) interface{} {
 		return right
 	}
 
+	if overloaded, ok := i.overloadBinary(expr, left.Value, right.Value); ok {
+		return overloaded
+	}
+
 	switch expr.Operator.TokenType {
 	case TK_PLUS:
 		if left.IsString() || right.IsString() && (!left.IsError() && !right.IsError()) {
-			sl := left.coerceString()
-			sr := right.coerceString()
-
-			return Result(sl + sr)
+			sl, err := i.stringify(left.Value, expr.Operator)
+			if err != nil {
+				return Error(err)
+			}
+			sr, err := i.stringify(right.Value, expr.Operator)
+			if err != nil {
+				return Error(err)
+			}
+
+			// Checked right away, as a loop doubling a string runs out of
+			// memory within a few statements.
+			str := sl + sr
+			i.shared.memory.AddString(str)
+			if i.shared.memory.Exceeds(i.config.MaxMemory) {
+				return Error(i.memoryError(expr.Operator.Span()))
+			}
+			return Result(str)
 		}
 		return i.doArithmetic(expr, left, right, func(l float64, r float64) float64 { return l + r })
 	case TK_MINUS:
@@ -272,6 +407,10 @@ func (i *Interpreter) VisitUnary(expr *Unary) interface{} {
 	}
 
 	if expr.Operator.TokenType == TK_MINUS {
+		if overloaded, ok := i.overloadNegate(expr.Operator, result.Value); ok {
+			return overloaded
+		}
+
 		number, ok := result.ToNumber()
 		if !ok {
 			return i.error(E_UNEXPECTED_TYPE, expr.Operator, "Operand must be a number.")
@@ -377,10 +516,10 @@ func (i *Interpreter) VisitIfStmt(expr *IfStmt) interface{} {
 	}
 
 	if rCond.IsTruthy() {
-		return expr.ThenBranch.Accept(i)
+		return i.execute(expr.ThenBranch)
 	} else {
 		if expr.ElseBranch != nil {
-			return expr.ElseBranch.Accept(i)
+			return i.execute(expr.ElseBranch)
 		}
 	}
 
@@ -398,10 +537,21 @@ func (i *Interpreter) VisitWhileStmt(expr *WhileStmt) interface{} {
 			break
 		}
 
-		rBody := expr.Body.Accept(i).(*result)
-		if rBody.IsBlockBreaking() {
+		rBody := i.execute(expr.Body).(*result)
+		if rBody.IsStmtBreak {
+			break
+		}
+
+		if rBody.IsError() || rBody.IsStmtReturn {
 			return rBody
 		}
+
+		if expr.Increment != nil {
+			rIncr := expr.Increment.Accept(i).(*result)
+			if rIncr.IsError() {
+				return rIncr
+			}
+		}
 	}
 
 	return Void
@@ -423,7 +573,22 @@ func (i *Interpreter) VisitGet(expr *Get) interface{} {
 		return i.error(E_UNDEFINED_OBJECT_PROPERTY, expr.Name, "Property is not defined on object")
 	}
 
-	return Result(val)
+	return i.access(val, expr.Name)
+}
+
+// access returns val, or the value it computes if it is a bound getter.
+func (i *Interpreter) access(val interface{}, name Token) *result {
+	getter, ok := val.(*FunctionCallable)
+	if !ok || !getter.isGetter {
+		return Result(val)
+	}
+
+	i.callSite = name
+	value := getter.Call(i, []interface{}{})
+	if err, ok := value.(error); ok {
+		return Error(AtToken(err, name))
+	}
+	return Result(value)
 }
 
 func (i *Interpreter) VisitSuper(expr *Super) interface{} {
@@ -443,16 +608,11 @@ func (i *Interpreter) VisitSuper(expr *Super) interface{} {
 		return Error(err)
 	}
 
-	this, ok := thisInstance.(*KlassInstance)
-	if !ok {
-		panic("should never get here")
-	}
-
-	result, err := klass.GetSuperMethod(expr.Call, this)
+	result, err := klass.GetSuperMethod(expr.Call, thisInstance)
 	if err != nil {
 		return Error(err)
 	}
-	return Result(result)
+	return i.access(result, expr.Call)
 }
 
 func (i *Interpreter) VisitSet(expr *Set) interface{} {
@@ -466,11 +626,21 @@ func (i *Interpreter) VisitSet(expr *Set) interface{} {
 		return object
 	}
 
+	if settable, ok := object.Value.(Settable); ok {
+		if err := settable.SetProperty(expr.Name.Lexeme, value.Value); err != nil {
+			return Error(AtToken(err, expr.Name))
+		}
+		return value
+	}
+
 	instance, ok := object.Value.(*KlassInstance)
 	if !ok {
 		return i.error(E_UNDEFINED_OBJECT_PROPERTY, expr.Name, "Property is not defined on object")
 	}
 
+	if _, ok := instance.properties[expr.Name.Lexeme]; !ok {
+		i.shared.memory.AddProperty()
+	}
 	instance.Set(expr.Name.Lexeme, value.Value)
 
 	return value
@@ -502,13 +672,134 @@ func (i *Interpreter) VisitCall(expr *Call) interface{} {
 		argValues = append(argValues, argValue.Value)
 	}
 
+	i.callSite = expr.Paren
 	callResult := callable.Call(i, argValues)
 	if err, ok := callResult.(error); ok {
-		return Error(err)
+		return Error(AtToken(err, expr.Paren))
+	}
+	if str, ok := callResult.(string); ok {
+		i.shared.memory.AddString(str)
 	}
 	return Result(callResult)
 }
 
+func (i *Interpreter) VisitAwait(expr *Await) interface{} {
+	value := i.evaluateExpression(expr.Value)
+	if value.IsError() {
+		return value
+	}
+
+	// Awaiting anything but a future gives the value itself.
+	future, ok := value.Value.(*Future)
+	if !ok {
+		return value
+	}
+
+	result, err := i.await(future)
+	if err != nil {
+		return Error(AtToken(err, expr.Keyword))
+	}
+	return Result(result)
+}
+
+func (i *Interpreter) VisitListLiteral(expr *ListLiteral) interface{} {
+	elements := make([]interface{}, 0, len(expr.Elements))
+	for _, element := range expr.Elements {
+		value := element.Accept(i).(*result)
+		if value.IsError() {
+			return value
+		}
+
+		elements = append(elements, value.Value)
+	}
+
+	i.shared.memory.AddList(len(elements))
+	return Result(NewList(elements))
+}
+
+func (i *Interpreter) VisitMapLiteral(expr *MapLiteral) interface{} {
+	m := NewMap()
+	for idx, keyExpr := range expr.Keys {
+		key := keyExpr.Accept(i).(*result)
+		if key.IsError() {
+			return key
+		}
+
+		value := expr.Values[idx].Accept(i).(*result)
+		if value.IsError() {
+			return value
+		}
+
+		if err := m.Put(key.Value, value.Value); err != nil {
+			return Error(AtToken(err, expr.Brace))
+		}
+	}
+
+	i.shared.memory.AddMap(m.Len())
+	return Result(m)
+}
+
+func (i *Interpreter) VisitGetIndex(expr *GetIndex) interface{} {
+	object := i.evaluateExpression(expr.Object)
+	if object.IsError() {
+		return object
+	}
+
+	index := i.evaluateExpression(expr.Index)
+	if index.IsError() {
+		return index
+	}
+
+	indexable, ok := object.Value.(Indexable)
+	if !ok {
+		return i.error(E_NOT_INDEXABLE, expr.Bracket, "Expression cannot be indexed")
+	}
+
+	value, err := indexable.GetIndex(index.Value)
+	if err != nil {
+		return Error(AtToken(err, expr.Bracket))
+	}
+
+	return Result(value)
+}
+
+func (i *Interpreter) VisitSetIndex(expr *SetIndex) interface{} {
+	object := i.evaluateExpression(expr.Object)
+	if object.IsError() {
+		return object
+	}
+
+	index := i.evaluateExpression(expr.Index)
+	if index.IsError() {
+		return index
+	}
+
+	value := i.evaluateExpression(expr.Value)
+	if value.IsError() {
+		return value
+	}
+
+	indexable, ok := object.Value.(Indexable)
+	if !ok {
+		return i.error(E_NOT_INDEXABLE, expr.Bracket, "Expression cannot be indexed")
+	}
+
+	m, isMap := indexable.(*LoxMap)
+	entries := 0
+	if isMap {
+		entries = m.Len()
+	}
+
+	if err := indexable.SetIndex(index.Value, value.Value); err != nil {
+		return Error(AtToken(err, expr.Bracket))
+	}
+
+	if isMap && m.Len() > entries {
+		i.shared.memory.AddEntry()
+	}
+	return value
+}
+
 func (i *Interpreter) VisitExprStmt(stmt *ExprStmt) interface{} {
 	r := stmt.Expression.Accept(i)
 	if r.(*result).IsError() {
@@ -525,7 +816,11 @@ func (i *Interpreter) VisitPrintStmt(stmt *PrintStmt) interface{} {
 	}
 
 	if i.config.PrintFunc != nil {
-		i.config.PrintFunc(fmt.Sprintf("%v", value.Value))
+		str, err := i.stringify(value.Value, stmt.Keyword)
+		if err != nil {
+			return Error(err)
+		}
+		i.config.PrintFunc(str)
 	}
 
 	return Void
@@ -545,13 +840,25 @@ func (i *Interpreter) VisitVarStmt(stmt *VarStmt) interface{} {
 	return Void
 }
 
+func (i *Interpreter) VisitImportStmt(stmt *ImportStmt) interface{} {
+	module, err := i.importModule(stmt.Keyword, stmt.Path.Literal.(string))
+	if err != nil {
+		return Error(err)
+	}
+
+	i.environment.Define(stmt.Name.Lexeme, module)
+	return Void
+}
+
 func (i *Interpreter) VisitFunctionStmt(stmt *FunctionStmt) interface{} {
+	i.shared.memory.AddClosure()
 	callable := NewFunctionCallable(stmt, i.environment)
 	i.environment.Define(stmt.Name.Lexeme, callable)
 	return Void
 }
 
 func (i *Interpreter) VisitLambda(expr *Lambda) interface{} {
+	i.shared.memory.AddClosure()
 	return Result(NewLambdaCallable(expr, i.environment))
 }
 
@@ -567,8 +874,55 @@ func (i *Interpreter) executeGlobalBlock(stmts []Stmt) interface{} {
 	return i.executeBlock(stmts, nil)
 }
 
+// execute runs a statement of a block or the body of a control flow
+// statement, letting an attached debugger stop before it.
+func (i *Interpreter) execute(stmt Stmt) interface{} {
+	if i.debugger != nil {
+		i.debugger.BeforeStatement(stmt)
+	}
+	if i.limited {
+		if err := i.checkLimits(stmt); err != nil {
+			return Error(err)
+		}
+	}
+	return stmt.Accept(i)
+}
+
+// checkLimits counts stmt against the step budget and stops the program once
+// it is spent or its context is done.
+func (i *Interpreter) checkLimits(stmt Stmt) error {
+	i.shared.steps++
+	if i.config.MaxSteps > 0 && i.shared.steps > i.config.MaxSteps {
+		return LimitError(E_STEP_LIMIT_EXCEEDED, stmt.Span(), fmt.Sprintf("Exceeded the limit of %d steps", i.config.MaxSteps))
+	}
+
+	if i.shared.memory.Exceeds(i.config.MaxMemory) {
+		return i.memoryError(stmt.Span())
+	}
+
+	if i.config.Context != nil {
+		select {
+		case <-i.config.Context.Done():
+			return LimitError(E_CANCELLED, stmt.Span(), fmt.Sprintf("Cancelled: %v", i.config.Context.Err()))
+		default:
+		}
+	}
+	return nil
+}
+
+// evaluateIn evaluates expr with env as the current environment.
+func (i *Interpreter) evaluateIn(expr Expr, env *Environment) *result {
+	i.shared.memory.AddEnvironment()
+	previous := i.environment
+	defer func() { i.environment = previous }()
+
+	i.environment = env
+	return i.evaluateExpression(expr)
+}
+
 func (i *Interpreter) executeBlock(statements []Stmt, env *Environment) interface{} {
 	if env != nil {
+		i.shared.memory.AddEnvironment()
 		previous := i.environment
 		defer func() { i.environment = previous }()
 
@@ -576,7 +930,7 @@ func (i *Interpreter) executeBlock(statements []Stmt, env *Environment) interfac
 	}
 
 	for _, stmt := range statements {
-		r := stmt.Accept(i)
+		r := i.execute(stmt)
 		if r.(*result).IsBlockBreaking() {
 			return r
 		}
@@ -585,6 +939,44 @@ func (i *Interpreter) executeBlock(statements []Stmt, env *Environment) interfac
 	return Void
 }
 
+func (i *Interpreter) VisitBreakStmt(stmt *BreakStmt) interface{} {
+	return Break
+}
+
+func (i *Interpreter) VisitContinueStmt(stmt *ContinueStmt) interface{} {
+	return Continue
+}
+
+func (i *Interpreter) VisitThrowStmt(stmt *ThrowStmt) interface{} {
+	value := stmt.Expression.Accept(i).(*result)
+	if value.IsError() {
+		return value
+	}
+
+	return Error(NewThrownError(value.Value, stmt.Keyword))
+}
+
+func (i *Interpreter) VisitTryStmt(stmt *TryStmt) interface{} {
+	r := stmt.Body.Accept(i).(*result)
+
+	if r.IsError() && stmt.CatchBody != nil && !IsUncatchable(r.Err) {
+		environment := NewEnclosedEnvironment(i.environment)
+		environment.Define(stmt.CatchName.Lexeme, CaughtValue(r.Err))
+		r = i.executeBlock(stmt.CatchBody.Statements, environment).(*result)
+	}
+
+	// The finally block replaces the outcome of the try statement only when
+	// it leaves early itself.
+	if stmt.FinallyBody != nil {
+		rFinally := stmt.FinallyBody.Accept(i).(*result)
+		if rFinally.IsBlockBreaking() {
+			return rFinally
+		}
+	}
+
+	return r
+}
+
 func (i *Interpreter) VisitReturnStmt(stmt *ReturnStmt) interface{} {
 	if len(i.callstack) == 0 {
 		return i.error(E_UNEXPECTED_RETURN, stmt.Keyword, "unexpected return in current scope")
@@ -602,6 +994,27 @@ func (i *Interpreter) VisitReturnStmt(stmt *ReturnStmt) interface{} {
 	return Return(returnValue)
 }
 
+func (i *Interpreter) VisitYieldStmt(stmt *YieldStmt) interface{} {
+	if i.generator == nil {
+		return i.error(E_UNEXPECTED_YIELD, stmt.Keyword, "unexpected yield outside a generator")
+	}
+
+	var value interface{}
+	if stmt.Expression != nil {
+		stmtResult := stmt.Expression.Accept(i).(*result)
+		if stmtResult.IsError() {
+			return stmtResult
+		}
+
+		value = stmtResult.Value
+	}
+
+	if err := i.generator.yield(value); err != nil {
+		return Error(AtToken(err, stmt.Keyword))
+	}
+	return Result(nil)
+}
+
 func (i *Interpreter) VisitClassStmt(stmt *ClassStmt) interface{} {
 	var superKlass *Klass
 	if stmt.SuperClass != nil {
@@ -617,11 +1030,25 @@ func (i *Interpreter) VisitClassStmt(stmt *ClassStmt) interface{} {
 
 		superKlass = sKlass
 	}
-	i.environment.Define(stmt.Name.Lexeme, NewKlass(stmt.Name, stmt.Methods, i.environment, superKlass))
+	klass := NewKlass(stmt.Name, stmt.Fields, stmt.Methods, stmt.ClassMethods, i.environment, superKlass)
+	i.environment.Define(stmt.Name.Lexeme, klass)
+
+	for _, field := range stmt.ClassFields {
+		var value interface{}
+		if field.Initializer != nil {
+			r := i.evaluateExpression(field.Initializer)
+			if r.IsError() {
+				return r
+			}
+			value = r.Value
+		}
+
+		i.shared.memory.AddProperty()
+		klass.SetProperty(field.Name.Lexeme, value)
+	}
 	return Void
 }
 
 func (i *Interpreter) error(errType int32, token Token, message string) *result {
-	err := NewRuntimeError(errType, token.Line, token.Lexeme, message)
-	return Error(err)
+	return Error(token.ToRuntimeError(errType, message))
 }
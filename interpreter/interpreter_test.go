@@ -1,8 +1,12 @@
 package interpreter
 
 import (
+	"context"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func doTest(t *testing.T, expression string, expected interface{}, expectedErr int32) {
@@ -119,6 +123,26 @@ func TestPrograms(t *testing.T) {
 			`,
 			[]string{"1", "1", "3"},
 		},
+		{
+			`
+			var a = "global";
+			{
+				var a = "then";
+				if (true) print a;
+			}
+			{
+				var a = "else";
+				if (false) print "unreachable"; else {
+					fun show() {
+						print a;
+					}
+					a = a + "!";
+					show();
+				}
+			}
+			`,
+			[]string{"then", "else!"},
+		},
 		{
 			`
 			for (var i = 0; i < 3; i = i + 1) print i;
@@ -285,6 +309,20 @@ func TestPrograms(t *testing.T) {
 			`,
 			[]string{"global", "global"},
 		},
+		{
+			`
+				var a = "global";
+				{
+					var a = "local";
+					fun show() {
+						if (a == "global") print "then"; else print a;
+					}
+					a = "changed";
+					show();
+				}
+			`,
+			[]string{"changed"},
+		},
 	}
 
 	for _, test := range tests {
@@ -532,6 +570,979 @@ func TestClassPrograms(t *testing.T) {
 
 }
 
+// Class members, operator methods and toString are only supported by the
+// tree-walking interpreter, and the other backends reject them when compiling.
+func TestClassMemberPrograms(t *testing.T) {
+	tests := []struct {
+		program        string
+		expectedOutput []string
+		expectedErrors []int32
+	}{
+		{
+			`
+			class Math {
+				class var pi = 3;
+				class square(n) {
+					return n * n;
+				}
+				class circle(r) {
+					return this.pi * this.square(r);
+				}
+			}
+			print Math.square(3);
+			print Math.circle(2);
+			Math.pi = 4;
+			print Math.pi;
+			print Math.circle(1);
+			`,
+			[]string{"9", "12", "4", "4"},
+			[]int32{},
+		},
+		{
+			`
+			class Shape {
+				class var count = 0;
+				class create(name) {
+					this.count = this.count + 1;
+					return this(name);
+				}
+				class describe() {
+					return "shape";
+				}
+				fun init(name) {
+					this.name = name;
+				}
+			}
+			class Square < Shape {
+				class describe() {
+					return super.describe() + ":square";
+				}
+			}
+			var s = Square.create("a");
+			print s;
+			print s.name;
+			print Square.describe();
+			print Square.count;
+			print Shape.count;
+			`,
+			[]string{"Square instance", "a", "shape:square", "1", "0"},
+			[]int32{},
+		},
+		{
+			`
+			class Counter {
+				class var created = Counter.label();
+				class label() {
+					return "counter";
+				}
+			}
+			print Counter.created;
+			print Counter().label;
+			`,
+			[]string{"counter"},
+			[]int32{E_UNDEFINED_OBJECT_PROPERTY},
+		},
+		{
+			`
+			class Rect {
+				fun init(w, h) {
+					this.w = w;
+					this.h = h;
+				}
+				fun area {
+					return this.w * this.h;
+				}
+				fun describe() {
+					return "area " + this.area;
+				}
+				class unit {
+					return this(1, 1);
+				}
+			}
+			class Square < Rect {
+				fun init(size) {
+					super.init(size, size);
+				}
+				fun area {
+					print "computing";
+					return super.area;
+				}
+			}
+			var r = Rect(2, 3);
+			print r.area;
+			r.w = 4;
+			print r.describe();
+			print Rect.unit.area;
+			print Square(3).area;
+			`,
+			[]string{"6", "area 12", "1", "computing", "9"},
+			[]int32{},
+		},
+		{
+			`
+			class Broken {
+				fun value {
+					return this.missing;
+				}
+			}
+			print Broken().value;
+			`,
+			[]string{},
+			[]int32{E_UNDEFINED_OBJECT_PROPERTY},
+		},
+		{
+			`
+			class Counter {
+				var count = 0;
+				var step = this.defaultStep();
+				var items = [];
+				fun defaultStep() {
+					return 1;
+				}
+				fun add() {
+					this.count = this.count + this.step;
+					this.items.push(this.count);
+				}
+			}
+			class Double < Counter {
+				var step = 2;
+				var label = "double " + this.count;
+				fun init(start) {
+					this.count = start;
+				}
+			}
+			var a = Counter();
+			var b = Counter();
+			a.add();
+			a.add();
+			print a.count;
+			print a.items;
+			print b.items;
+			var d = Double(10);
+			d.add();
+			print d.count;
+			print d.label;
+			`,
+			[]string{"2", "[1, 2]", "[]", "12", "double 0"},
+			[]int32{},
+		},
+		{
+			`
+			class Broken {
+				var value = this.missing;
+			}
+			Broken();
+			`,
+			[]string{},
+			[]int32{E_UNDEFINED_OBJECT_PROPERTY},
+		},
+		{
+			`
+			class Vector {
+				fun init(x, y) {
+					this.x = x;
+					this.y = y;
+				}
+				fun __add__(other) {
+					return Vector(this.x + other.x, this.y + other.y);
+				}
+				fun __mul__(k) {
+					return Vector(this.x * k, this.y * k);
+				}
+				fun __rmul__(k) {
+					return this * k;
+				}
+				fun __neg__() {
+					return Vector(-this.x, -this.y);
+				}
+				fun __eq__(other) {
+					if (type(other) != "instance") {
+						return false;
+					}
+					return this.x == other.x and this.y == other.y;
+				}
+				fun __lt__(other) {
+					return this.x < other.x;
+				}
+			}
+			var v = Vector(1, 2) + Vector(3, 4);
+			print v.x + "," + v.y;
+			var w = 2 * -v;
+			print w.x + "," + w.y;
+			print Vector(1, 1) == Vector(1, 1);
+			print Vector(1, 1) != Vector(1, 2);
+			print Vector(1, 1) == nil;
+			print Vector(1, 0) < Vector(2, 0);
+			print Vector(3, 0) > Vector(2, 0);
+			`,
+			[]string{"4,6", "-8,-12", "true", "true", "false", "true", "true"},
+			[]int32{},
+		},
+		{
+			`
+			class Money {
+				fun __add__() {
+					return 1;
+				}
+			}
+			print Money() + Money();
+			`,
+			[]string{},
+			[]int32{E_INVALID_ARGUMENTS},
+		},
+		{
+			`
+			class Point {
+				fun init(x, y) {
+					this.x = x;
+					this.y = y;
+				}
+				fun toString() {
+					return "(" + this.x + ", " + this.y + ")";
+				}
+			}
+			class Plain {}
+			var p = Point(1, 2);
+			print p;
+			print "at " + p;
+			print p + "!";
+			print Plain();
+			`,
+			[]string{"(1, 2)", "at (1, 2)", "(1, 2)!", "Plain instance"},
+			[]int32{},
+		},
+		{
+			`
+			class Point {
+				fun init(x, y) {
+					this.x = x;
+					this.y = y;
+				}
+				fun toString() {
+					return "(" + this.x + ", " + this.y + ")";
+				}
+			}
+			var points = [Point(1, 2), [Point(3, 4)], 5];
+			print points;
+			print "all " + points;
+			print {"origin": Point(0, 0), "list": points};
+			print str(Point(5, 6)) + " " + str(points);
+			points.push(points);
+			print points;
+			`,
+			[]string{"[(1, 2), [(3, 4)], 5]", "all [(1, 2), [(3, 4)], 5]", "{origin: (0, 0), list: [(1, 2), [(3, 4)], 5]}", "(5, 6) [(1, 2), [(3, 4)], 5]", "[(1, 2), [(3, 4)], 5, [...]]"},
+			[]int32{},
+		},
+		{
+			`
+			class Broken {
+				fun toString() {
+					return 1;
+				}
+			}
+			print [Broken()];
+			`,
+			[]string{},
+			[]int32{E_UNEXPECTED_TYPE},
+		},
+		{
+			`
+			class Broken {
+				fun toString() {
+					throw "cannot format";
+				}
+			}
+			try {
+				print Broken();
+			} catch (e) {
+				print "caught " + e;
+			}
+			print "x" + Broken();
+			`,
+			[]string{"caught cannot format"},
+			[]int32{E_THROWN},
+		},
+		{
+			`
+			class Broken {
+				fun toString() {
+					return 1;
+				}
+			}
+			print Broken();
+			`,
+			[]string{},
+			[]int32{E_UNEXPECTED_TYPE},
+		},
+		{
+			`
+			class Broken {
+				fun init {}
+			}
+			`,
+			[]string{},
+			[]int32{E_INVALID_CLASS},
+		},
+	}
+
+	for _, test := range tests {
+		doProgramTestWith(t, ProgramRunners[0], test.program, test.expectedOutput, test.expectedErrors)
+
+		for _, runner := range ProgramRunners[1:] {
+			// Programs the resolver rejects fail the same way on every backend.
+			errs := runner.Run(InterpreterConfig{PrintFunc: func(string) {}}, test.program)
+			var loxError *LoxError
+			rejected := len(errs) > 0 && strings.Contains(errs[0].Error(), "not supported by the VM")
+			failed := len(errs) > 0 && len(test.expectedErrors) > 0 && errors.As(errs[0], &loxError) && loxError.Type() == test.expectedErrors[0]
+			if !rejected && !failed {
+				t.Errorf("%s: expected the program to be rejected, got %v", runner.Name, errs)
+			}
+		}
+	}
+}
+
+func TestListPrograms(t *testing.T) {
+	tests := []struct {
+		program        string
+		expectedOutput []string
+	}{
+		{
+			`
+			var xs = [1, 2, 3];
+			print xs;
+			print xs[0] + xs[2];
+			xs[1] = "two";
+			print xs[1];
+			print [];
+			`,
+			[]string{"[1, 2, 3]", "4", "two", "[]"},
+		},
+		{
+			`
+			var xs = [];
+			for (var i = 0; i < 4; i = i + 1) {
+				xs.push(i * i);
+			}
+			print xs.len();
+			print xs.pop();
+			print xs;
+			print xs.slice(1, 3);
+			`,
+			[]string{"4", "9", "[0, 1, 4]", "[1, 4]"},
+		},
+		{
+			`
+			var grid = [[1, 2], [3, 4]];
+			grid[1][0] = grid[0][1] * 10;
+			print grid;
+
+			var push = grid.push;
+			push(5);
+			print grid.len();
+			`,
+			[]string{"[[1, 2], [20, 4]]", "3"},
+		},
+		{
+			`
+			var xs = [1, 2];
+			xs.push(xs);
+			xs.push([xs]);
+			print str(xs);
+			print xs;
+			print "xs " + xs;
+			`,
+			[]string{"[1, 2, [...], [[...]]]", "[1, 2, [...], [[...]]]", "xs [1, 2, [...], [[...]]]"},
+		},
+	}
+
+	for _, test := range tests {
+		doProgramTest(t, test.program, test.expectedOutput, []int32{})
+	}
+}
+
+func TestMapPrograms(t *testing.T) {
+	tests := []struct {
+		program        string
+		expectedOutput []string
+	}{
+		{
+			`
+			var m = {"a": 1, "b": 2};
+			print m;
+			print m["a"] + m["b"];
+			m["c"] = 3;
+			m["a"] = 0;
+			print m;
+			print {};
+			`,
+			[]string{"{a: 1, b: 2}", "3", "{a: 0, b: 2, c: 3}", "{}"},
+		},
+		{
+			`
+			var m = {1: "one", true: "yes", nil: "nothing"};
+			print m[2 - 1];
+			print m[1 == 1];
+			print m[nil];
+			print m.has(1);
+			print m.has("1");
+			print m.len();
+			`,
+			[]string{"one", "yes", "nothing", "true", "false", "3"},
+		},
+		{
+			`
+			var m = {"x": 1, "y": 2, "z": 3};
+			print m.keys();
+			print m.values();
+			print m.remove("y");
+			print m.remove("y");
+			print m.keys();
+
+			var counts = {};
+			var words = ["a", "b", "a"];
+			for (var i = 0; i < words.len(); i = i + 1) {
+				var w = words[i];
+				counts[w] = counts.has(w) ? counts[w] + 1 : 1;
+			}
+			print counts;
+			`,
+			[]string{"[x, y, z]", "[1, 2, 3]", "2", "<nil>", "[x, z]", "{a: 2, b: 1}"},
+		},
+		{
+			`
+			var m = {"a": 1};
+			m["self"] = m;
+			m["list"] = [m];
+			print str(m);
+			print m;
+			`,
+			[]string{"{a: 1, self: {...}, list: [{...}]}", "{a: 1, self: {...}, list: [{...}]}"},
+		},
+	}
+
+	for _, test := range tests {
+		doProgramTest(t, test.program, test.expectedOutput, []int32{})
+	}
+}
+
+func TestLoopControlPrograms(t *testing.T) {
+	tests := []struct {
+		program        string
+		expectedOutput []string
+	}{
+		{
+			`
+			for (var i = 0; i < 10; i = i + 1) {
+				if (i == 3) break;
+				print i;
+			}
+			`,
+			[]string{"0", "1", "2"},
+		},
+		{
+			`
+			for (var i = 0; i < 5; i = i + 1) {
+				if (i == 1 or i == 3) continue;
+				print i;
+			}
+			`,
+			[]string{"0", "2", "4"},
+		},
+		{
+			`
+			var i = 0;
+			while (true) {
+				i = i + 1;
+				var skip = i == 2;
+				if (skip) continue;
+				if (i > 4) break;
+				print i;
+			}
+			print "done";
+			`,
+			[]string{"1", "3", "4", "done"},
+		},
+		{
+			`
+			for (var i = 0; i < 3; i = i + 1) {
+				for (var j = 0; j < 3; j = j + 1) {
+					if (j == 1) continue;
+					if (j > i) break;
+					print i * 10 + j;
+				}
+			}
+			`,
+			[]string{"0", "10", "20", "22"},
+		},
+		{
+			`
+			var fns = [];
+			for (var i = 0; i < 4; i = i + 1) {
+				var x = i;
+				fns.push(fun () { return x; });
+				if (i == 2) break;
+			}
+			for (var i = 0; i < fns.len(); i = i + 1) print fns[i]();
+			`,
+			[]string{"0", "1", "2"},
+		},
+		{
+			`
+			fun find(xs, value) {
+				var found = -1;
+				for (var i = 0; i < xs.len(); i = i + 1) {
+					if (xs[i] == value) {
+						found = i;
+						break;
+					}
+				}
+				return found;
+			}
+			print find([5, 6, 7], 6);
+			print find([5, 6, 7], 8);
+			`,
+			[]string{"1", "-1"},
+		},
+	}
+
+	for _, test := range tests {
+		doProgramTest(t, test.program, test.expectedOutput, []int32{})
+	}
+}
+
+func TestExceptionPrograms(t *testing.T) {
+	tests := []struct {
+		program        string
+		expectedOutput []string
+	}{
+		{
+			`
+			try {
+				print 1 / 0;
+			} catch (e) {
+				print e.type;
+				print e.message;
+				print e.line;
+			}
+			print "after";
+			`,
+			[]string{"E_DIVIDE_BY_ZERO", "Cannot divide by zero.", "3", "after"},
+		},
+		{
+			`
+			class Foo {}
+			fun lookup(obj) {
+				return obj.missing;
+			}
+			try {
+				lookup(Foo());
+			} catch (e) {
+				print e.type;
+			}
+			try {
+				var m = {"a": 1};
+				m["b"];
+			} catch (e) {
+				print e;
+			}
+			`,
+			[]string{"E_UNDEFINED_OBJECT_PROPERTY", "E_UNDEFINED_KEY: Key 'b' is not defined in map"},
+		},
+		{
+			`
+			try {
+				throw "boom";
+			} catch (e) {
+				print e;
+			} finally {
+				print "finally";
+			}
+
+			try {
+				print "no error";
+			} catch (e) {
+				print "unreachable";
+			} finally {
+				print "finally";
+			}
+			`,
+			[]string{"boom", "finally", "no error", "finally"},
+		},
+		{
+			`
+			fun inner() {
+				try {
+					throw 1;
+				} finally {
+					print "inner finally";
+				}
+			}
+
+			fun outer() {
+				try {
+					inner();
+				} catch (e) {
+					print "caught " + e;
+					throw e + 1;
+				} finally {
+					print "outer finally";
+				}
+			}
+
+			try {
+				outer();
+			} catch (e) {
+				print "rethrown " + e;
+			}
+			`,
+			[]string{"inner finally", "caught 1", "outer finally", "rethrown 2"},
+		},
+		{
+			`
+			try {
+				try {
+					nil.field;
+				} catch (e) {
+					throw e;
+				}
+			} catch (e) {
+				print e.type;
+			}
+			`,
+			[]string{"E_NOT_AN_OBJECT"},
+		},
+		{
+			`
+			fun f() {
+				try {
+					return "try";
+				} finally {
+					print "cleanup";
+				}
+			}
+			print f();
+
+			fun g() {
+				try {
+					return "try";
+				} finally {
+					return "finally";
+				}
+			}
+			print g();
+
+			for (var i = 0; i < 3; i = i + 1) {
+				try {
+					if (i == 1) continue;
+					if (i == 2) break;
+					print i;
+				} finally {
+					print "step " + i;
+				}
+			}
+			`,
+			[]string{"cleanup", "try", "finally", "0", "step 0", "step 1", "step 2"},
+		},
+		{
+			`
+			var fns = [];
+			fun capture(x) {
+				var local = x * 2;
+				fns.push(fun () { return local; });
+				throw local;
+			}
+			try {
+				capture(21);
+			} catch (e) {
+				print e;
+			}
+			print fns[0]();
+			`,
+			[]string{"42", "42"},
+		},
+	}
+
+	for _, test := range tests {
+		doProgramTest(t, test.program, test.expectedOutput, []int32{})
+	}
+}
+
+func TestStdlibPrograms(t *testing.T) {
+	tests := []struct {
+		program        string
+		expectedOutput []string
+	}{
+		{
+			`
+			var s = "  Hello, World  ";
+			var t = string.trim(s);
+			print t;
+			print string.len(t);
+			print string.upper(t);
+			print string.lower(t);
+			print string.substr(t, 7, 5);
+			print string.indexOf(t, "World");
+			print string.indexOf(t, "Moon");
+			print string.split("a,b,c", ",");
+			print string.len("héllo");
+			`,
+			[]string{"Hello, World", "12", "HELLO, WORLD", "hello, world", "World", "7", "-1", "[a, b, c]", "5"},
+		},
+		{
+			`
+			print math.floor(2.7);
+			print math.sqrt(16);
+			print math.pow(2, 10);
+			print math.abs(-3);
+			print math.min(1, 2);
+			print math.max(1, 2);
+
+			math.seed(42);
+			var a = math.random();
+			var b = math.random();
+			math.seed(42);
+			print a == math.random() and b == math.random();
+			print a >= 0 and a < 1;
+			`,
+			[]string{"2", "4", "1024", "3", "1", "2", "true", "true"},
+		},
+		{
+			`
+			class Foo {
+				fun bar() {}
+			}
+			print type(nil);
+			print type(true);
+			print type(1);
+			print type("s");
+			print type([]);
+			print type({});
+			print type(Foo);
+			print type(Foo());
+			print type(Foo().bar);
+			print type(fun () {});
+			print type(clock);
+			print type(math);
+			`,
+			[]string{"nil", "boolean", "number", "string", "list", "map", "class", "instance", "function", "function", "function", "module"},
+		},
+		{
+			`
+			print str(1.5) + "!";
+			print str(nil);
+			print num("  42 ") + 1;
+			print num(3);
+			try {
+				num("abc");
+			} catch (e) {
+				print e.message;
+			}
+			`,
+			[]string{"1.5!", "<nil>", "43", "3", "Cannot convert 'abc' to a number"},
+		},
+	}
+
+	for _, test := range tests {
+		doProgramTest(t, test.program, test.expectedOutput, []int32{})
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	program := `
+class Calc {
+	fun divide(a, b) {
+		return a / b;
+	}
+}
+fun run(calc) {
+	return calc.divide(1, 0);
+}
+var f = fun () { return run(Calc()); };
+f();
+`
+	expected := []StackFrame{
+		{Function: "divide", Class: "Calc", Line: 8, File: "main.lox"},
+		{Function: "run", Line: 10, File: "main.lox"},
+		{Function: "<lambda>", Line: 11, File: "main.lox"},
+	}
+
+	for _, runner := range ProgramRunners {
+		config := InterpreterConfig{ScriptPath: "main.lox"}
+		errs := runner.Run(config, program)
+		if len(errs) != 1 {
+			t.Errorf("%s: expected 1 error, got %v", runner.Name, errs)
+			continue
+		}
+
+		var loxError *LoxError
+		if !errors.As(errs[0], &loxError) {
+			t.Errorf("%s: expected a lox error, got %v", runner.Name, errs[0])
+			continue
+		}
+
+		if !reflect.DeepEqual(loxError.StackTrace(), expected) {
+			t.Errorf("%s: expected trace %v, got %v", runner.Name, expected, loxError.StackTrace())
+		}
+
+		if !strings.Contains(loxError.Error(), "\n    at Calc.divide, called from main.lox:8\n") {
+			t.Errorf("%s: trace missing from error message %q", runner.Name, loxError.Error())
+		}
+	}
+}
+
+// TestRethrownStackTraces checks that throwing a caught error again does not
+// repeat the calls it unwound through.
+func TestRethrownStackTraces(t *testing.T) {
+	program := `
+fun fail() {
+	return 1 / 0;
+}
+var saved;
+try { fail(); } catch (e) { saved = e; }
+fun rethrow() {
+	throw saved;
+}
+try { rethrow(); } catch (e) {}
+rethrow();
+`
+	expected := []StackFrame{
+		{Function: "fail", Line: 6, File: "main.lox"},
+		{Function: "rethrow", Line: 11, File: "main.lox"},
+	}
+
+	for _, runner := range ProgramRunners {
+		errs := runner.Run(InterpreterConfig{ScriptPath: "main.lox"}, program)
+		var loxError *LoxError
+		if len(errs) != 1 || !errors.As(errs[0], &loxError) {
+			t.Errorf("%s: expected 1 lox error, got %v", runner.Name, errs)
+			continue
+		}
+
+		if !reflect.DeepEqual(loxError.StackTrace(), expected) {
+			t.Errorf("%s: expected trace %v, got %v", runner.Name, expected, loxError.StackTrace())
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		program       string
+		config        InterpreterConfig
+		expectedError int32
+	}{
+		{"while (true) {}", InterpreterConfig{MaxSteps: 1000}, E_STEP_LIMIT_EXCEEDED},
+		{"fun f(n) { return f(n + 1); } f(0);", InterpreterConfig{MaxCallDepth: 100}, E_CALL_DEPTH_EXCEEDED},
+		// Without a limit, recursion fails before it exhausts the Go stack.
+		{"fun f(n) { return f(n + 1); } f(0);", InterpreterConfig{}, E_STACK_OVERFLOW},
+		{"while (true) {}", InterpreterConfig{Context: cancelled}, E_CANCELLED},
+		// Try statements cannot catch their way past a limit.
+		{"while (true) { try { while (true) {} } catch (e) {} }", InterpreterConfig{MaxSteps: 1000}, E_STEP_LIMIT_EXCEEDED},
+		{"fun f() { try { f(); } catch (e) { print e; } } f();", InterpreterConfig{MaxCallDepth: 10}, E_CALL_DEPTH_EXCEEDED},
+		{`var s = "x"; while (true) s = s + s;`, InterpreterConfig{MaxMemory: 1 << 20}, E_MEMORY_LIMIT_EXCEEDED},
+		{"class P {} while (true) P();", InterpreterConfig{MaxMemory: 1 << 16}, E_MEMORY_LIMIT_EXCEEDED},
+		{`var xs = []; while (true) xs.push("a");`, InterpreterConfig{MaxMemory: 1 << 16}, E_MEMORY_LIMIT_EXCEEDED},
+		{"while (true) [1, 2, 3];", InterpreterConfig{MaxMemory: 1 << 16}, E_MEMORY_LIMIT_EXCEEDED},
+		{"var m = {}; var n = 0; while (true) { m[n] = n; n = n + 1; }", InterpreterConfig{MaxMemory: 1 << 16}, E_MEMORY_LIMIT_EXCEEDED},
+		{`var s = "x"; try { while (true) s = s + s; } catch (e) { print e; }`, InterpreterConfig{MaxMemory: 1 << 20}, E_MEMORY_LIMIT_EXCEEDED},
+	}
+
+	for _, runner := range ProgramRunners {
+		for _, test := range tests {
+			printed := false
+			test.config.PrintFunc = func(value string) { printed = true }
+
+			errs := runner.Run(test.config, test.program)
+			var loxError *LoxError
+			if len(errs) != 1 || !errors.As(errs[0], &loxError) || loxError.Type() != test.expectedError {
+				t.Errorf("%s: %s: expected %s, got %v", runner.Name, test.program, ErrorTypeNames[test.expectedError], errs)
+			}
+			if printed {
+				t.Errorf("%s: %s: expected the error not to be caught", runner.Name, test.program)
+			}
+		}
+
+		// Programs within their limits run as usual.
+		config := InterpreterConfig{MaxSteps: 1000, MaxCallDepth: 10, Context: context.Background()}
+		if errs := runner.Run(config, "fun f(n) { if (n > 0) f(n - 1); } f(9);"); len(errs) > 0 {
+			t.Errorf("%s: unexpected errors %v", runner.Name, errs)
+		}
+	}
+}
+
+// TestForkedCallDepth checks that tasks, async calls and generators count the
+// calls that started them towards the call depth.
+func TestForkedCallDepth(t *testing.T) {
+	tests := []struct {
+		program       string
+		config        InterpreterConfig
+		expectedError int32
+	}{
+		{"fun f() { spawn(f); } f();", InterpreterConfig{MaxCallDepth: 20}, E_CALL_DEPTH_EXCEEDED},
+		{"async fun f() { await f(); } f();", InterpreterConfig{MaxCallDepth: 20}, E_CALL_DEPTH_EXCEEDED},
+		{"fun g() { yield g().next(); } g().next();", InterpreterConfig{MaxCallDepth: 20}, E_CALL_DEPTH_EXCEEDED},
+		{"fun f() { spawn(f); } f();", InterpreterConfig{}, E_STACK_OVERFLOW},
+		{"fun g() { yield g().next(); } g().next();", InterpreterConfig{}, E_STACK_OVERFLOW},
+	}
+
+	for _, test := range tests {
+		test.config.PrintFunc = func(string) {}
+		errs := RunProgram(test.config, test.program)
+		var loxError *LoxError
+		if len(errs) != 1 || !errors.As(errs[0], &loxError) || loxError.Type() != test.expectedError {
+			t.Errorf("%s: expected %s, got %v", test.program, ErrorTypeNames[test.expectedError], errs)
+		}
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	program := `
+var s = "ab" + "cd";
+class P {}
+var p = P();
+p.x = 1;
+p.x = 2;
+fun f() { return 1; }
+{ var a = 1; }
+f();
+var xs = [1, 2];
+xs.push(3);
+var m = {"a": 1};
+m["b"] = 2;
+m["b"] = 3;
+`
+	i := NewInterpreter(InterpreterConfig{})
+	stmts, errs := Compile(program, NewResolver(i))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	if _, err := i.Interpret(stmts); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := MemoryStats{Total: 484, Strings: 20, Instances: 80, Environments: 96, Closures: 64, Lists: 80, Maps: 144}
+	if i.MemoryStats() != expected {
+		t.Errorf("expected %+v, got %+v", expected, i.MemoryStats())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	for _, runner := range ProgramRunners {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		errs := runner.Run(InterpreterConfig{Context: ctx}, "while (true) {}")
+		cancel()
+
+		var loxError *LoxError
+		if len(errs) != 1 || !errors.As(errs[0], &loxError) || loxError.Type() != E_CANCELLED {
+			t.Errorf("%s: expected the program to time out, got %v", runner.Name, errs)
+		} else if !strings.Contains(loxError.Message(), "deadline exceeded") {
+			t.Errorf("%s: unexpected message %q", runner.Name, loxError.Message())
+		}
+	}
+}
+
 func TestBadPrograms(t *testing.T) {
 	tests := []struct {
 		program        string
@@ -603,13 +1614,153 @@ func TestBadPrograms(t *testing.T) {
 			[]string{},
 			[]int32{E_UNDEFINED_VARIABLE},
 		},
+		{
+			`
+			var xs = [1, 2];
+			print xs[2];
+			`,
+			[]string{},
+			[]int32{E_INDEX_OUT_OF_RANGE},
+		},
+		{
+			`
+			var xs = [1, 2];
+			xs[0.5] = 1;
+			`,
+			[]string{},
+			[]int32{E_UNEXPECTED_TYPE},
+		},
+		{
+			`
+			[].pop();
+			`,
+			[]string{},
+			[]int32{E_INDEX_OUT_OF_RANGE},
+		},
+		{
+			`
+			var a = 1;
+			print a[0];
+			`,
+			[]string{},
+			[]int32{E_NOT_INDEXABLE},
+		},
+		{
+			`
+			try {
+				throw "oops";
+			} finally {
+				print "cleanup";
+			}
+			`,
+			[]string{"cleanup"},
+			[]int32{E_THROWN},
+		},
+		{
+			`
+			print string.substr("abc", 2, 5);
+			`,
+			[]string{},
+			[]int32{E_INDEX_OUT_OF_RANGE},
+		},
+		{
+			`
+			print string.substr("abc", 1, 9223372036854775807);
+			`,
+			[]string{},
+			[]int32{E_INDEX_OUT_OF_RANGE},
+		},
+		{
+			`
+			print string.substr("abc", 4611686018427387904, 4611686018427387904);
+			`,
+			[]string{},
+			[]int32{E_INDEX_OUT_OF_RANGE},
+		},
+		{
+			`
+			print math.sqrt("4");
+			`,
+			[]string{},
+			[]int32{E_UNEXPECTED_TYPE},
+		},
+		{
+			`
+			break;
+			`,
+			[]string{},
+			[]int32{E_UNEXPECTED_BREAK},
+		},
+		{
+			`
+			while (true) {
+				fun f() {
+					continue;
+				}
+			}
+			`,
+			[]string{},
+			[]int32{E_UNEXPECTED_CONTINUE},
+		},
+		{
+			`
+			var m = {"a": 1};
+			print m["b"];
+			`,
+			[]string{},
+			[]int32{E_UNDEFINED_KEY},
+		},
+		{
+			`
+			var m = {[1]: 1};
+			`,
+			[]string{},
+			[]int32{E_UNEXPECTED_TYPE},
+		},
+		{
+			`
+			class Money {}
+			var a = Money();
+			print a == a;
+			print a != Money();
+			print a + 1;
+			`,
+			[]string{"true", "true"},
+			[]int32{E_UNEXPECTED_TYPE},
+		},
+		{
+			`
+			class Money {}
+			print -Money();
+			`,
+			[]string{},
+			[]int32{E_UNEXPECTED_TYPE},
+		},
 	}
 	for _, test := range tests {
 		doProgramTest(t, test.program, test.expectedOutput, test.expectedErrors)
 	}
 }
 
+// ProgramRunner is an execution backend that the program tests run against.
+// Backends living in other packages register themselves from an external
+// test package; see backends_test.go.
+type ProgramRunner struct {
+	Name string
+	Run  func(config InterpreterConfig, program string) []error
+}
+
+var ProgramRunners = []ProgramRunner{
+	{"interpreter", RunProgram},
+}
+
 func doProgramTest(t *testing.T, program string, expectedOutput []string, errorCount []int32) {
+	for _, runner := range ProgramRunners {
+		doProgramTestWith(t, runner, program, expectedOutput, errorCount)
+	}
+}
+
+func doProgramTestWith(t *testing.T, runner ProgramRunner, program string, expectedOutput []string, errorCount []int32) {
 	output := make([]string, 0)
 	clockIncr := 0
 	config := InterpreterConfig{
@@ -624,38 +1775,38 @@ func doProgramTest(t *testing.T, program string, expectedOutput []string, errorC
 		},
 	}
 
-	errs := RunProgram(config, program)
+	errs := runner.Run(config, program)
 	if len(errs) > 0 && len(errorCount) == 0 {
-		t.Errorf("in program '%v':\nunexpected error(s):\n%v", program, errs)
+		t.Errorf("%s: in program '%v':\nunexpected error(s):\n%v", runner.Name, program, errs)
 		return
 	}
 
 	if len(errs) >= 0 && len(errorCount) > 0 {
 		if len(errs) != len(errorCount) {
-			t.Errorf("expected %d errors; got %d errors", len(errorCount), len(errs))
+			t.Errorf("%s: expected %d errors; got %d errors", runner.Name, len(errorCount), len(errs))
 		} else {
 			for i, err := range errorCount {
 				var loxError *LoxError
 				ok := errors.As(errs[i], &loxError)
 				if ok {
 					if loxError.runtimeErrorType != err {
-						t.Errorf("%s: Error[%d] expected type %d, got type %d", program, i, err, loxError.runtimeErrorType)
+						t.Errorf("%s: %s: Error[%d] expected type %d, got type %d", runner.Name, program, i, err, loxError.runtimeErrorType)
 					}
 				} else {
-					t.Errorf("Expected a lox error, got %v", errs[i])
+					t.Errorf("%s: Expected a lox error, got %v", runner.Name, errs[i])
 				}
 			}
 		}
 	}
 
 	if len(output) != len(expectedOutput) {
-		t.Errorf("expected %d output lines, got %d", len(expectedOutput), len(output))
+		t.Errorf("%s: expected %d output lines, got %d", runner.Name, len(expectedOutput), len(output))
 		return
 	}
 
 	for i, line := range output {
 		if line != expectedOutput[i] {
-			t.Errorf("expected output idx %d to be %q, got %q", i, expectedOutput[i], line)
+			t.Errorf("%s: expected output idx %d to be %q, got %q", runner.Name, i, expectedOutput[i], line)
 		}
 	}
 }
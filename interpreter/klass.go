@@ -7,24 +7,38 @@ type Klass struct {
 	methods map[string]*FunctionStmt
 	env     *Environment
 	super   *Klass
+	fields  []*VarStmt
+	// meta is the metaclass, whose methods are the class methods, called with
+	// the class as this. properties holds the class fields.
+	meta       *Klass
+	properties map[string]interface{}
 }
 
-func NewKlass(name Token, methods []*FunctionStmt, env *Environment, super *Klass) *Klass {
-	methodMap := make(map[string]*FunctionStmt)
-	for _, method := range methods {
-		methodMap[method.Name.Lexeme] = method
-	}
-
+func NewKlass(name Token, fields []*VarStmt, methods []*FunctionStmt, classMethods []*FunctionStmt, env *Environment, super *Klass) *Klass {
 	if super != nil {
 		env = NewEnclosedEnvironment(env)
 		env.Define("super", super)
 	}
 
-	return &Klass{name: name, methods: methodMap, env: env, super: super}
+	var superMeta *Klass
+	if super != nil {
+		superMeta = super.meta
+	}
+	meta := &Klass{name: name, methods: methodMap(classMethods), env: env, super: superMeta}
+
+	return &Klass{name: name, methods: methodMap(methods), env: env, super: super, fields: fields, meta: meta, properties: make(map[string]interface{})}
+}
+
+func methodMap(methods []*FunctionStmt) map[string]*FunctionStmt {
+	methodMap := make(map[string]*FunctionStmt)
+	for _, method := range methods {
+		methodMap[method.Name.Lexeme] = method
+	}
+	return methodMap
 }
 
 func (k *Klass) Arity() int {
-	if m, ok := k.methods["init"]; ok {
+	if _, m := k.FindMethod("init"); m != nil {
 		return len(m.Params)
 	}
 
@@ -32,21 +46,82 @@ func (k *Klass) Arity() int {
 }
 
 func (k *Klass) Call(i *Interpreter, arguments []interface{}) interface{} {
+	i.shared.memory.AddInstance()
 	instance := NewInstance(k)
+	if err := k.initFields(i, instance); err != nil {
+		return err
+	}
 
 	klass, init := k.FindMethod("init")
 	if init != nil {
-		method := instance.bind("init", init, klass)
-		method.Call(i, arguments)
+		method := bind(instance, "init", init, klass)
+		if err, ok := method.Call(i, arguments).(error); ok {
+			return err
+		}
 	}
 
 	return instance
 }
 
+// initFields sets the fields declared by k and its superclasses on instance,
+// those of superclasses first. Their initializers run with instance as this.
+func (k *Klass) initFields(i *Interpreter, instance *KlassInstance) error {
+	if k.super != nil {
+		if err := k.super.initFields(i, instance); err != nil {
+			return err
+		}
+	}
+	if len(k.fields) == 0 {
+		return nil
+	}
+
+	env := NewEnclosedEnvironment(k.env)
+	env.Define("this", instance)
+	for _, field := range k.fields {
+		var value interface{}
+		if field.Initializer != nil {
+			r := i.evaluateIn(field.Initializer, env)
+			if r.IsError() {
+				return r.Err
+			}
+			value = r.Value
+		}
+
+		if _, ok := instance.properties[field.Name.Lexeme]; !ok {
+			i.shared.memory.AddProperty()
+		}
+		instance.Set(field.Name.Lexeme, value)
+	}
+	return nil
+}
+
 func (k *Klass) String() string {
 	return k.name.Lexeme
 }
 
+// Get returns a class field or a class method bound to k, looking through the
+// superclasses when k does not define it.
+func (k *Klass) Get(property string) (interface{}, bool) {
+	for klass := k; klass != nil; klass = klass.super {
+		if val, ok := klass.properties[property]; ok {
+			return val, true
+		}
+	}
+
+	klass, method := k.meta.FindMethod(property)
+	if method == nil {
+		return nil, false
+	}
+	return bind(k, property, method, klass), true
+}
+
+// SetProperty sets a class field on k, which hides any field of the same name
+// on its superclasses.
+func (k *Klass) SetProperty(property string, value interface{}) error {
+	k.properties[property] = value
+	return nil
+}
+
 type KlassInstance struct {
 	klass      *Klass
 	properties map[string]interface{}
@@ -56,6 +131,12 @@ type Gettable interface {
 	Get(property string) (interface{}, bool)
 }
 
+// Settable values other than class instances accept property assignments.
+// Errors are created with NewNativeError.
+type Settable interface {
+	SetProperty(property string, value interface{}) error
+}
+
 func NewInstance(klass *Klass) *KlassInstance {
 	return &KlassInstance{klass, make(map[string]interface{})}
 }
@@ -64,14 +145,21 @@ func (i *KlassInstance) String() string {
 	return fmt.Sprintf("%v instance", i.klass)
 }
 
-func (k *Klass) GetSuperMethod(method Token, instance *KlassInstance) (interface{}, error) {
-	klass, methodDef := k.FindMethod(method.Lexeme)
+// GetSuperMethod binds the method of k to this, which is an instance or, in
+// class methods, a class whose class methods are looked up instead.
+func (k *Klass) GetSuperMethod(method Token, this interface{}) (interface{}, error) {
+	lookup := k
+	if _, ok := this.(*Klass); ok {
+		lookup = k.meta
+	}
+
+	klass, methodDef := lookup.FindMethod(method.Lexeme)
 	if methodDef == nil {
-		return nil, NewRuntimeError(E_UNDEFINED_OBJECT_PROPERTY, method.Line, method.Lexeme, "Method does not exist on super")
+		return nil, method.ToRuntimeError(E_UNDEFINED_OBJECT_PROPERTY, "Method does not exist on super")
 	}
 
 	// Bind and cache the binding
-	boundMethod := instance.bind(method.Lexeme, methodDef, klass)
+	boundMethod := bind(this, method.Lexeme, methodDef, klass)
 	return boundMethod, nil
 
 }
@@ -102,20 +190,29 @@ func (i *KlassInstance) Get(property string) (interface{}, bool) {
 	}
 
 	// Bind and cache the binding
-	boundMethod := i.bind(property, method, klass)
+	boundMethod := bind(i, property, method, klass)
 	return boundMethod, true
 }
 
+// Properties returns the fields set on the instance.
+func (i *KlassInstance) Properties() map[string]interface{} {
+	properties := make(map[string]interface{}, len(i.properties))
+	for name, value := range i.properties {
+		properties[name] = value
+	}
+	return properties
+}
+
 func (i *KlassInstance) Set(property string, value interface{}) {
 	i.properties[property] = value
 }
 
-func (i *KlassInstance) bind(property string, f *FunctionStmt, klass *Klass) Callable {
+// bind returns method f of klass with this defined, which is an instance or a
+// class for class methods.
+func bind(this interface{}, property string, f *FunctionStmt, klass *Klass) Callable {
 	methodEnv := NewEnclosedEnvironment(klass.env)
-	methodEnv.Define("this", i)
+	methodEnv.Define("this", this)
 
-	if property == "init" {
-		return NewInitFunctionCallable(f, methodEnv)
-	}
-	return NewFunctionCallable(f, methodEnv)
+	_, isInstance := this.(*KlassInstance)
+	return NewMethodCallable(f, methodEnv, klass.name.Lexeme, isInstance && property == "init")
 }
@@ -0,0 +1,162 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Indexable values support the xs[i] and xs[i] = v expressions. Errors are
+// created with NewNativeError and positioned at the indexing expression.
+type Indexable interface {
+	GetIndex(index interface{}) (interface{}, error)
+	SetIndex(index interface{}, value interface{}) error
+}
+
+type LoxList struct {
+	elements []interface{}
+}
+
+func NewList(elements []interface{}) *LoxList {
+	return &LoxList{elements: elements}
+}
+
+func (l *LoxList) Elements() []interface{} {
+	return l.elements
+}
+
+func (l *LoxList) String() string {
+	seen := formatting{}
+	str, _ := l.format(seen, seen.value)
+	return str
+}
+
+// format writes the list with each element formatted by element, or "[...]"
+// if the list is already being formatted.
+func (l *LoxList) format(seen formatting, element func(value interface{}) (string, error)) (string, error) {
+	if _, ok := seen[l]; ok {
+		return "[...]", nil
+	}
+	seen[l] = struct{}{}
+	defer delete(seen, l)
+
+	builder := strings.Builder{}
+	builder.WriteString("[")
+
+	for i, value := range l.elements {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		str, err := element(value)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(str)
+	}
+
+	builder.WriteString("]")
+	return builder.String(), nil
+}
+
+// formatting holds the lists and maps being formatted, so that one containing
+// itself is not formatted forever.
+type formatting map[interface{}]struct{}
+
+func (seen formatting) value(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case *LoxList:
+		return value.format(seen, seen.value)
+	case *LoxMap:
+		return value.format(seen, seen.value)
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+func toInteger(value interface{}) (int, bool) {
+	number, ok := value.(float64)
+	if !ok || number != math.Trunc(number) {
+		return 0, false
+	}
+
+	return int(number), true
+}
+
+func (l *LoxList) index(value interface{}) (int, error) {
+	idx, ok := toInteger(value)
+	if !ok {
+		return 0, NewNativeError(E_UNEXPECTED_TYPE, "List index must be an integer")
+	}
+
+	if idx < 0 || idx >= len(l.elements) {
+		return 0, NewNativeError(E_INDEX_OUT_OF_RANGE, "List index out of range")
+	}
+
+	return idx, nil
+}
+
+func (l *LoxList) GetIndex(index interface{}) (interface{}, error) {
+	idx, err := l.index(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.elements[idx], nil
+}
+
+func (l *LoxList) SetIndex(index interface{}, value interface{}) error {
+	idx, err := l.index(index)
+	if err != nil {
+		return err
+	}
+
+	l.elements[idx] = value
+	return nil
+}
+
+func (l *LoxList) Get(property string) (interface{}, bool) {
+	switch property {
+	case "push":
+		return NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+			l.elements = append(l.elements, arguments[0])
+			i.shared.memory.AddElement()
+			return nil
+		}), true
+	case "pop":
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			if len(l.elements) == 0 {
+				return NewNativeError(E_INDEX_OUT_OF_RANGE, "Cannot pop from an empty list")
+			}
+
+			last := l.elements[len(l.elements)-1]
+			l.elements = l.elements[:len(l.elements)-1]
+			return last
+		}), true
+	case "len":
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			return float64(len(l.elements))
+		}), true
+	case "slice":
+		return NewNativeCallable(2, func(i *Interpreter, arguments []interface{}) interface{} {
+			start, ok := toInteger(arguments[0])
+			if !ok {
+				return NewNativeError(E_UNEXPECTED_TYPE, "Slice start must be an integer")
+			}
+
+			end, ok := toInteger(arguments[1])
+			if !ok {
+				return NewNativeError(E_UNEXPECTED_TYPE, "Slice end must be an integer")
+			}
+
+			if start < 0 || end > len(l.elements) || start > end {
+				return NewNativeError(E_INDEX_OUT_OF_RANGE, "Slice bounds out of range")
+			}
+
+			elements := make([]interface{}, end-start)
+			copy(elements, l.elements[start:end])
+			i.shared.memory.AddList(len(elements))
+			return NewList(elements)
+		}), true
+	}
+
+	return nil, false
+}
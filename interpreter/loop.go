@@ -0,0 +1,397 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time the event loop runs timers on.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel that receives the time once d has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// FakeClock is a Clock for tests. Its time only moves when it is advanced or
+// the event loop waits on it, which then jumps straight to the time waited
+// for.
+type FakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.Advance(d)
+	ready := make(chan time.Time, 1)
+	ready <- c.Now()
+	return ready
+}
+
+// callback is work the event loop runs on the task driving it.
+type callback func(i *Interpreter) error
+
+type timer struct {
+	when     time.Time
+	seq      int
+	callback callback
+}
+
+// eventLoop runs the callbacks of settled futures and expired timers, one at
+// a time, whenever Lox code awaits in the global scope and once a program
+// has finished. Only posted and pending are used from other goroutines, with
+// lock held; everything else is only used by the task holding the
+// interpreter lock.
+type eventLoop struct {
+	ready     []callback
+	timers    []*timer
+	seq       int
+	unhandled []*Future
+
+	lock sync.Mutex
+	// posted are callbacks posted by the host, and pending counts the
+	// futures the host has yet to settle.
+	posted  []callback
+	pending int
+	wake    chan struct{}
+}
+
+func newEventLoop() *eventLoop {
+	return &eventLoop{wake: make(chan struct{}, 1)}
+}
+
+// post queues callback from any goroutine and wakes the loop.
+func (l *eventLoop) post(callback callback) {
+	l.lock.Lock()
+	l.posted = append(l.posted, callback)
+	l.lock.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (l *eventLoop) addTimer(when time.Time, callback callback) {
+	l.seq++
+	t := &timer{when: when, seq: l.seq, callback: callback}
+	idx := sort.Search(len(l.timers), func(idx int) bool {
+		return l.timers[idx].when.After(when)
+	})
+	l.timers = append(l.timers, nil)
+	copy(l.timers[idx+1:], l.timers[idx:])
+	l.timers[idx] = t
+}
+
+func (i *Interpreter) clock() Clock {
+	if i.config.Clock == nil {
+		return systemClock{}
+	}
+	return i.config.Clock
+}
+
+// runOnce runs the next callback, waiting for a timer or the host if there
+// is none yet. It reports false once there is nothing left to wait for.
+func (i *Interpreter) runOnce() (bool, error) {
+	loop := i.shared.loop
+	loop.lock.Lock()
+	loop.ready = append(loop.ready, loop.posted...)
+	loop.posted = nil
+	pending := loop.pending
+	loop.lock.Unlock()
+
+	if len(loop.ready) > 0 {
+		next := loop.ready[0]
+		loop.ready = loop.ready[1:]
+		return true, next(i)
+	}
+
+	if len(loop.timers) > 0 {
+		next := loop.timers[0]
+		if wait := next.when.Sub(i.clock().Now()); wait > 0 {
+			// The host may settle a future before the timer expires.
+			return true, i.waitForLoop(i.clock().After(wait))
+		}
+
+		loop.timers = loop.timers[1:]
+		return true, next.callback(i)
+	}
+
+	if pending > 0 {
+		return true, i.waitForLoop(nil)
+	}
+	return false, nil
+}
+
+func (i *Interpreter) waitForLoop(timer <-chan time.Time) error {
+	var err error
+	i.unlocked(func() {
+		select {
+		case <-timer:
+		case <-i.shared.loop.wake:
+		case <-i.cancelled():
+			err = i.cancelledError()
+		}
+	})
+	return err
+}
+
+// runLoop runs the event loop until there is nothing left to do, and returns
+// the error of the first future that failed without being awaited.
+func (i *Interpreter) runLoop() error {
+	for {
+		ran, err := i.runOnce()
+		if err != nil {
+			return err
+		}
+		if !ran {
+			break
+		}
+	}
+
+	loop := i.shared.loop
+	unhandled := loop.unhandled
+	loop.unhandled = nil
+	for _, future := range unhandled {
+		if !future.awaited {
+			return future.err
+		}
+	}
+	return nil
+}
+
+// Future is the result of an async function or native, available once it is
+// settled with either a value or an error.
+type Future struct {
+	loop    *eventLoop
+	settled bool
+	value   interface{}
+	err     error
+	waiters []callback
+	awaited bool
+	// host is set for the futures created with NewFuture.
+	host bool
+}
+
+func (i *Interpreter) newFuture() *Future {
+	return &Future{loop: i.shared.loop}
+}
+
+// NewFuture returns a pending future for a native function to return. The
+// host settles it later with Resolve or Reject, from any goroutine, and the
+// event loop keeps waiting for it until then.
+func (i *Interpreter) NewFuture() *Future {
+	future := i.newFuture()
+	future.host = true
+	future.loop.lock.Lock()
+	future.loop.pending++
+	future.loop.lock.Unlock()
+	return future
+}
+
+// Resolve settles a future created with NewFuture with value, converted as
+// the results of functions registered with RegisterFunc are.
+func (f *Future) Resolve(value interface{}) {
+	f.loop.post(func(i *Interpreter) error {
+		converted, err := i.toLox(reflect.ValueOf(value))
+		if err != nil {
+			err = NewNativeError(E_HOST_ERROR, fmt.Sprintf("Cannot resolve future: %v", err))
+		}
+		f.settleFromHost(converted, err)
+		return nil
+	})
+}
+
+// Reject settles a future created with NewFuture with an error, which await
+// raises as an E_HOST_ERROR unless it is a *LoxError.
+func (f *Future) Reject(err error) {
+	var loxError *LoxError
+	if !errors.As(err, &loxError) {
+		err = NewNativeError(E_HOST_ERROR, err.Error())
+	}
+	f.loop.post(func(i *Interpreter) error {
+		f.settleFromHost(nil, err)
+		return nil
+	})
+}
+
+func (f *Future) settleFromHost(value interface{}, err error) {
+	if f.settled {
+		return
+	}
+
+	if f.host {
+		f.loop.lock.Lock()
+		f.loop.pending--
+		f.loop.lock.Unlock()
+	}
+	f.settle(value, err)
+}
+
+// settle completes the future and queues the callbacks waiting for it.
+func (f *Future) settle(value interface{}, err error) {
+	if f.settled {
+		return
+	}
+
+	f.settled, f.value, f.err = true, value, err
+	f.loop.ready = append(f.loop.ready, f.waiters...)
+	f.waiters = nil
+	if err != nil {
+		f.loop.unhandled = append(f.loop.unhandled, f)
+	}
+}
+
+func (f *Future) TypeName() string {
+	return "future"
+}
+
+func (f *Future) String() string {
+	return "<future>"
+}
+
+func (f *Future) Get(property string) (interface{}, bool) {
+	if property == "done" {
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			return f.settled
+		}), true
+	}
+	return nil, false
+}
+
+// coroutine is the goroutine an async function runs on. It only runs between
+// being resumed and yielding, while the task that resumed it waits, so it
+// runs as part of that task.
+type coroutine struct {
+	resume chan struct{}
+	yield  chan struct{}
+}
+
+// async starts running body as an async function, until it first awaits a
+// future that is not settled yet, and returns the future of its result.
+func (i *Interpreter) async(body func(state *Interpreter) interface{}) *Future {
+	future := i.newFuture()
+	state := i.fork()
+	state.callSite = i.callSite
+	state.coroutine = &coroutine{resume: make(chan struct{}), yield: make(chan struct{})}
+
+	go func() {
+		<-state.coroutine.resume
+		value := body(state)
+		if err, ok := value.(error); ok {
+			future.settle(nil, AtToken(err, state.callSite))
+		} else {
+			future.settle(value, nil)
+		}
+		state.coroutine.yield <- struct{}{}
+	}()
+
+	i.resume(state)
+	return future
+}
+
+// resume runs the coroutine of state until it yields.
+func (i *Interpreter) resume(state *Interpreter) {
+	state.locked = i.locked
+	state.coroutine.resume <- struct{}{}
+	<-state.coroutine.yield
+}
+
+// await returns the value of future once it is settled. An async function
+// yields until then, while code in the global scope runs the event loop.
+func (i *Interpreter) await(future *Future) (interface{}, error) {
+	future.awaited = true
+	if future.settled {
+		return future.value, future.err
+	}
+
+	if i.coroutine != nil {
+		future.waiters = append(future.waiters, func(driver *Interpreter) error {
+			driver.resume(i)
+			return nil
+		})
+		i.coroutine.yield <- struct{}{}
+		<-i.coroutine.resume
+		return future.value, future.err
+	}
+
+	for !future.settled {
+		ran, err := i.runOnce()
+		if err != nil {
+			return nil, err
+		}
+		if !ran {
+			return nil, NewNativeError(E_DEADLOCK, "Awaited future can never be settled")
+		}
+	}
+	return future.value, future.err
+}
+
+var SleepFunc = NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+	ms, ok := arguments[0].(float64)
+	if !ok || ms < 0 {
+		return NewNativeError(E_INVALID_ARGUMENTS, "Sleep duration must be a non-negative number of milliseconds")
+	}
+
+	future := i.newFuture()
+	i.shared.loop.addTimer(i.clock().Now().Add(milliseconds(ms)), func(i *Interpreter) error {
+		future.settle(nil, nil)
+		return nil
+	})
+	return future
+})
+
+var SetTimeoutFunc = NewNativeCallable(2, func(i *Interpreter, arguments []interface{}) interface{} {
+	callable, ok := arguments[0].(Callable)
+	if !ok || callable.Arity() != 0 {
+		return NewNativeError(E_INVALID_ARGUMENTS, "Timeout callback must be a function without parameters")
+	}
+
+	ms, ok := arguments[1].(float64)
+	if !ok || ms < 0 {
+		return NewNativeError(E_INVALID_ARGUMENTS, "Timeout must be a non-negative number of milliseconds")
+	}
+
+	site := i.callSite
+	i.shared.loop.addTimer(i.clock().Now().Add(milliseconds(ms)), func(i *Interpreter) error {
+		i.callSite = site
+		if err, ok := callable.Call(i, []interface{}{}).(error); ok {
+			return AtToken(err, site)
+		}
+		return nil
+	})
+	return nil
+})
+
+func milliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,203 @@
+package interpreter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// runLoopProgram runs program on an interpreter with clock, or the system
+// clock if it is nil, and returns what it printed.
+func runLoopProgram(program string, clock *FakeClock, natives map[string]Callable) ([]string, error) {
+	output := make([]string, 0)
+	config := InterpreterConfig{
+		PrintFunc:           func(value string) { output = append(output, value) },
+		GlobalFuncOverrides: natives,
+	}
+	if clock != nil {
+		config.Clock = clock
+	}
+
+	i := NewInterpreter(config)
+
+	stmts, errs := Compile(program, NewResolver(i))
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	_, err := i.Interpret(stmts)
+	return output, err
+}
+
+func TestAsync(t *testing.T) {
+	tests := []struct {
+		name     string
+		program  string
+		expected []string
+		elapsed  time.Duration
+	}{
+		{
+			"await sleeping functions",
+			`
+async fun fetch(name, ms) {
+	print "start " + name;
+	await sleep(ms);
+	print "done " + name;
+	return name;
+}
+var a = fetch("a", 200);
+var b = fetch("b", 100);
+print type(a);
+print await a;
+print await b;
+`,
+			[]string{"start a", "start b", "future", "done b", "done a", "a", "b"},
+			200 * time.Millisecond,
+		},
+		{
+			"timers",
+			`
+setTimeout(fun () { print "later"; }, 50);
+setTimeout(fun () { print "sooner"; }, 10);
+setTimeout(fun () { print "also sooner"; }, 10);
+print "now";
+`,
+			[]string{"now", "sooner", "also sooner", "later"},
+			50 * time.Millisecond,
+		},
+		{
+			"async methods and lambdas",
+			`
+class Counter {
+	fun init() {
+		this.count = 0;
+	}
+	async fun tick(ms) {
+		await sleep(ms);
+		this.count = this.count + 1;
+		return this.count;
+	}
+}
+var counter = Counter();
+var ticks = [counter.tick(30), counter.tick(10)];
+var twice = async fun () { return (await ticks[0]) * 2; };
+print await twice();
+print counter.count;
+`,
+			[]string{"4", "2"},
+			30 * time.Millisecond,
+		},
+		{
+			"errors",
+			`
+async fun fail() {
+	await sleep(10);
+	throw "failed";
+}
+try {
+	await fail();
+} catch (e) {
+	print e;
+}
+print await 5;
+`,
+			[]string{"failed", "5"},
+			10 * time.Millisecond,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			clock := NewFakeClock(start)
+			output, err := runLoopProgram(test.program, clock, nil)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(output, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, output)
+			}
+			if elapsed := clock.Now().Sub(start); elapsed != test.elapsed {
+				t.Errorf("expected %v to pass, got %v", test.elapsed, elapsed)
+			}
+		})
+	}
+}
+
+func TestAsyncErrors(t *testing.T) {
+	tests := []struct {
+		program   string
+		errorType int32
+	}{
+		{`fun f() { await 1; }`, E_UNEXPECTED_AWAIT},
+		{`class A { async fun init() {} }`, E_INVALID_CLASS},
+		{`async fun f() { throw "unhandled"; } f();`, E_THROWN},
+		{`setTimeout(fun () { return 1 + nil; }, 10);`, E_UNEXPECTED_TYPE},
+		{`var f; async fun g() { await sleep(1); await f; } f = g(); await f;`, E_DEADLOCK},
+		{`sleep(-1);`, E_INVALID_ARGUMENTS},
+	}
+
+	for _, test := range tests {
+		_, err := runLoopProgram(test.program, NewFakeClock(time.Now()), nil)
+		var loxError *LoxError
+		if !errors.As(err, &loxError) || loxError.Type() != test.errorType {
+			t.Errorf("%s: expected %s, got %v", test.program, ErrorTypeNames[test.errorType], err)
+		}
+	}
+}
+
+func TestHostFutures(t *testing.T) {
+	// fetch returns a future that another goroutine settles.
+	fetch := NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+		future := i.NewFuture()
+		key := arguments[0]
+		go func() {
+			time.Sleep(time.Millisecond)
+			if key == "missing" {
+				future.Reject(errors.New("not found"))
+			} else {
+				future.Resolve(map[string]interface{}{"key": key, "size": 3})
+			}
+		}()
+		return future
+	})
+
+	program := `
+async fun load(key) {
+	var response = await fetch(key);
+	return response["size"];
+}
+print await load("a");
+try {
+	await fetch("missing");
+} catch (e) {
+	print e.type + ": " + e.message;
+}
+`
+	output, err := runLoopProgram(program, nil, map[string]Callable{"fetch": fetch})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []string{"3", "E_HOST_ERROR: not found"}
+	if !reflect.DeepEqual(output, expected) {
+		t.Errorf("expected %v, got %v", expected, output)
+	}
+}
+
+func TestCallAsync(t *testing.T) {
+	i := NewInterpreter(InterpreterConfig{PrintFunc: func(string) {}, Clock: NewFakeClock(time.Now())})
+	stmts, errs := Compile("async fun double(n) { await sleep(100); return n * 2; }", NewResolver(i))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	if _, err := i.Interpret(stmts); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	value, err := i.CallGlobal("double", 21)
+	if err != nil || value != 42.0 {
+		t.Errorf("expected 42, got %v, %v", value, err)
+	}
+}
@@ -0,0 +1,165 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LoxMap is a hash map keyed by strings, numbers, booleans and nil. Keys are
+// compared the same way the '==' operator compares values, and iteration
+// follows insertion order.
+type LoxMap struct {
+	keys    []interface{}
+	entries map[interface{}]interface{}
+}
+
+func NewMap() *LoxMap {
+	return &LoxMap{keys: make([]interface{}, 0), entries: make(map[interface{}]interface{})}
+}
+
+func isValidKey(key interface{}) bool {
+	switch key.(type) {
+	case nil, string, float64, bool:
+		return true
+	}
+
+	return false
+}
+
+func (m *LoxMap) Len() int {
+	return len(m.keys)
+}
+
+func (m *LoxMap) Keys() []interface{} {
+	keys := make([]interface{}, len(m.keys))
+	copy(keys, m.keys)
+	return keys
+}
+
+func (m *LoxMap) Values() []interface{} {
+	values := make([]interface{}, 0, len(m.keys))
+	for _, key := range m.keys {
+		values = append(values, m.entries[key])
+	}
+	return values
+}
+
+func (m *LoxMap) Lookup(key interface{}) (interface{}, bool) {
+	if !isValidKey(key) {
+		return nil, false
+	}
+
+	value, ok := m.entries[key]
+	return value, ok
+}
+
+func (m *LoxMap) Put(key interface{}, value interface{}) error {
+	if !isValidKey(key) {
+		return NewNativeError(E_UNEXPECTED_TYPE, "Map keys must be strings, numbers, booleans or nil")
+	}
+
+	if _, ok := m.entries[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+
+	m.entries[key] = value
+	return nil
+}
+
+func (m *LoxMap) Remove(key interface{}) (interface{}, bool) {
+	value, ok := m.Lookup(key)
+	if !ok {
+		return nil, false
+	}
+
+	delete(m.entries, key)
+	for idx, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:idx], m.keys[idx+1:]...)
+			break
+		}
+	}
+
+	return value, true
+}
+
+func (m *LoxMap) String() string {
+	seen := formatting{}
+	str, _ := m.format(seen, seen.value)
+	return str
+}
+
+// format writes the map with each value formatted by element, or "{...}" if
+// the map is already being formatted.
+func (m *LoxMap) format(seen formatting, element func(value interface{}) (string, error)) (string, error) {
+	if _, ok := seen[m]; ok {
+		return "{...}", nil
+	}
+	seen[m] = struct{}{}
+	defer delete(seen, m)
+
+	builder := strings.Builder{}
+	builder.WriteString("{")
+
+	for idx, key := range m.keys {
+		if idx > 0 {
+			builder.WriteString(", ")
+		}
+		str, err := element(m.entries[key])
+		if err != nil {
+			return "", err
+		}
+		builder.WriteString(fmt.Sprintf("%v: %s", key, str))
+	}
+
+	builder.WriteString("}")
+	return builder.String(), nil
+}
+
+func (m *LoxMap) GetIndex(index interface{}) (interface{}, error) {
+	if !isValidKey(index) {
+		return nil, NewNativeError(E_UNEXPECTED_TYPE, "Map keys must be strings, numbers, booleans or nil")
+	}
+
+	value, ok := m.entries[index]
+	if !ok {
+		return nil, NewNativeError(E_UNDEFINED_KEY, fmt.Sprintf("Key '%v' is not defined in map", index))
+	}
+
+	return value, nil
+}
+
+func (m *LoxMap) SetIndex(index interface{}, value interface{}) error {
+	return m.Put(index, value)
+}
+
+func (m *LoxMap) Get(property string) (interface{}, bool) {
+	switch property {
+	case "keys":
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			i.shared.memory.AddList(m.Len())
+			return NewList(m.Keys())
+		}), true
+	case "values":
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			i.shared.memory.AddList(m.Len())
+			return NewList(m.Values())
+		}), true
+	case "has":
+		return NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+			_, ok := m.Lookup(arguments[0])
+			return ok
+		}), true
+	case "remove":
+		return NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+			value, _ := m.Remove(arguments[0])
+			return value
+		}), true
+	case "len":
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			return float64(m.Len())
+		}), true
+	}
+
+	return nil, false
+}
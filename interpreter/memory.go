@@ -0,0 +1,125 @@
+package interpreter
+
+import "fmt"
+
+// Approximate sizes of the values a program allocates, in bytes.
+const (
+	stringHeaderBytes = 16
+	instanceBytes     = 48
+	propertyBytes     = 32
+	environmentBytes  = 48
+	closureBytes      = 64
+	channelBytes      = 96
+	channelSlotBytes  = 16
+	listBytes         = 32
+	elementBytes      = 16
+	mapBytes          = 48
+	entryBytes        = 48
+)
+
+// MemoryStats is the memory a program allocated, in approximate bytes, by the
+// kind of value allocated. Memory is counted when it is allocated and never
+// given back, so Total measures how much a program allocated rather than how
+// much it holds at once.
+type MemoryStats struct {
+	Total        int
+	Strings      int
+	Instances    int
+	Environments int
+	Closures     int
+	Channels     int
+	Lists        int
+	Maps         int
+}
+
+func (s *MemoryStats) AddString(value string) {
+	s.add(&s.Strings, stringHeaderBytes+len(value))
+}
+
+func (s *MemoryStats) AddInstance() {
+	s.add(&s.Instances, instanceBytes)
+}
+
+// AddProperty counts a property added to an instance.
+func (s *MemoryStats) AddProperty() {
+	s.add(&s.Instances, propertyBytes)
+}
+
+func (s *MemoryStats) AddEnvironment() {
+	s.add(&s.Environments, environmentBytes)
+}
+
+func (s *MemoryStats) AddClosure() {
+	s.add(&s.Closures, closureBytes)
+}
+
+// AddList counts a list created with the given number of elements.
+func (s *MemoryStats) AddList(elements int) {
+	s.add(&s.Lists, listBytes+elements*elementBytes)
+}
+
+func (s *MemoryStats) AddElement() {
+	s.add(&s.Lists, elementBytes)
+}
+
+// AddMap counts a map created with the given number of entries.
+func (s *MemoryStats) AddMap(entries int) {
+	s.add(&s.Maps, mapBytes+entries*entryBytes)
+}
+
+func (s *MemoryStats) AddEntry() {
+	s.add(&s.Maps, entryBytes)
+}
+
+// Add counts the memory in other as well.
+func (s *MemoryStats) Add(other MemoryStats) {
+	s.Total += other.Total
+	s.Strings += other.Strings
+	s.Instances += other.Instances
+	s.Environments += other.Environments
+	s.Closures += other.Closures
+	s.Channels += other.Channels
+	s.Lists += other.Lists
+	s.Maps += other.Maps
+}
+
+// Since returns the memory allocated between before and s.
+func (s MemoryStats) Since(before MemoryStats) MemoryStats {
+	return MemoryStats{
+		Total:        s.Total - before.Total,
+		Strings:      s.Strings - before.Strings,
+		Instances:    s.Instances - before.Instances,
+		Environments: s.Environments - before.Environments,
+		Closures:     s.Closures - before.Closures,
+		Channels:     s.Channels - before.Channels,
+		Lists:        s.Lists - before.Lists,
+		Maps:         s.Maps - before.Maps,
+	}
+}
+
+// AddChannel counts a channel and the buffer for its capacity of values.
+func (s *MemoryStats) AddChannel(capacity int) {
+	s.add(&s.Channels, channelBytes+capacity*channelSlotBytes)
+}
+
+func (s *MemoryStats) add(kind *int, bytes int) {
+	*kind += bytes
+	s.Total += bytes
+}
+
+// Exceeds reports whether more than limit bytes were allocated. A limit of
+// zero means no limit.
+func (s *MemoryStats) Exceeds(limit int) bool {
+	return limit > 0 && s.Total > limit
+}
+
+// MemoryStats reports the memory allocated by the last call to Interpret or
+// Call.
+func (i *Interpreter) MemoryStats() MemoryStats {
+	return i.shared.memory
+}
+
+// memoryError is raised once a program allocated more than its limit.
+func (i *Interpreter) memoryError(span Span) error {
+	return LimitError(E_MEMORY_LIMIT_EXCEEDED, span, fmt.Sprintf("Exceeded the memory limit of %d bytes", i.config.MaxMemory))
+}
@@ -0,0 +1,134 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Module is the value bound by an import statement. Its properties are the
+// globals defined by the module, rather than the builtins it starts with.
+type Module struct {
+	path        string
+	environment *Environment
+	// exports are the names the module defines, or nil if every global is
+	// exported.
+	exports map[string]struct{}
+}
+
+func (m *Module) Get(property string) (interface{}, bool) {
+	if _, ok := m.exports[property]; m.exports != nil && !ok {
+		return nil, false
+	}
+
+	value, ok := m.environment.Values[property]
+	return value, ok
+}
+
+func (m *Module) String() string {
+	return fmt.Sprintf("<module %s>", m.path)
+}
+
+func (c InterpreterConfig) readModule(path string) (string, error) {
+	if c.ReadModule != nil {
+		return c.ReadModule(path)
+	}
+
+	contents, err := os.ReadFile(path)
+	return string(contents), err
+}
+
+// importModule runs the module at path, relative to the module currently
+// executing, in its own global environment. Modules run once and are cached;
+// a nil entry marks a module that is still being imported.
+func (i *Interpreter) importModule(keyword Token, path string) (*Module, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(i.modulePath), path)
+	}
+	path = filepath.Clean(path)
+
+	if module, ok := i.modules[path]; ok {
+		if module == nil {
+			return nil, keyword.ToRuntimeError(E_CYCLIC_IMPORT, fmt.Sprintf("Cyclic import of module '%s'", path))
+		}
+		return module, nil
+	}
+
+	source, err := i.config.readModule(path)
+	if err != nil {
+		return nil, keyword.ToRuntimeError(E_IMPORT_FAILED, fmt.Sprintf("Could not read module '%s'", path))
+	}
+
+	stmts, errs := i.parseModule(source)
+	if len(errs) > 0 {
+		return nil, keyword.ToRuntimeError(E_IMPORT_FAILED, fmt.Sprintf("Could not import module '%s': %s", path, strings.TrimSpace(errs[0].Error())))
+	}
+
+	environment := newGlobalEnvironment(i.config)
+	for name, value := range i.shared.host {
+		environment.Define(name, value)
+	}
+
+	module := &Module{path: path, environment: environment, exports: declaredNames(stmts)}
+	i.files[module.environment] = path
+	i.sources[path] = source
+
+	i.modules[path] = nil
+	r := i.executeModule(module, stmts).(*result)
+	if r.IsError() {
+		delete(i.modules, path)
+		return nil, inFile(r.Err, path, source)
+	}
+
+	i.modules[path] = module
+	return module, nil
+}
+
+// declaredNames returns the globals that stmts, the top level of a module,
+// declare.
+func declaredNames(stmts []Stmt) map[string]struct{} {
+	names := make(map[string]struct{})
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *VarStmt:
+			names[stmt.Name.Lexeme] = struct{}{}
+		case *FunctionStmt:
+			names[stmt.Name.Lexeme] = struct{}{}
+		case *ClassStmt:
+			names[stmt.Name.Lexeme] = struct{}{}
+		case *ImportStmt:
+			names[stmt.Name.Lexeme] = struct{}{}
+		}
+	}
+	return names
+}
+
+func (i *Interpreter) parseModule(source string) ([]Stmt, []error) {
+	stmts, errs := Compile(source, NewResolver(i))
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return stmts, nil
+}
+
+// enterModule makes globals, and the file that defines them, current until
+// the returned function is called.
+func (i *Interpreter) enterModule(globals *Environment) func() {
+	previousGlobals, previousPath := i.globalEnvironment, i.modulePath
+	i.globalEnvironment, i.modulePath = globals, i.files[globals]
+	return func() {
+		i.globalEnvironment, i.modulePath = previousGlobals, previousPath
+	}
+}
+
+func (i *Interpreter) executeModule(module *Module, stmts []Stmt) interface{} {
+	previousEnvironment, previousGlobals, previousPath := i.environment, i.globalEnvironment, i.modulePath
+	defer func() {
+		i.environment, i.globalEnvironment, i.modulePath = previousEnvironment, previousGlobals, previousPath
+	}()
+
+	i.environment, i.globalEnvironment, i.modulePath = module.environment, module.environment, module.path
+	return i.executeGlobalBlock(stmts)
+}
@@ -0,0 +1,243 @@
+package interpreter
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func runModuleProgram(files map[string]string, main string) ([]string, []error) {
+	output := make([]string, 0)
+	config := InterpreterConfig{
+		PrintFunc: func(value string) {
+			output = append(output, value)
+		},
+		ScriptPath: main,
+		ReadModule: func(path string) (string, error) {
+			source, ok := files[path]
+			if !ok {
+				return "", os.ErrNotExist
+			}
+			return source, nil
+		},
+	}
+
+	return output, RunProgram(config, files[main])
+}
+
+func TestModulePrograms(t *testing.T) {
+	tests := []struct {
+		files          map[string]string
+		expectedOutput []string
+	}{
+		{
+			map[string]string{
+				"main.lox": `
+				import "lib/shapes.lox" as shapes;
+				print shapes.area(shapes.Square(3));
+				print shapes.count;
+				print shapes.describe();
+				`,
+				"lib/shapes.lox": `
+				import "util.lox" as util;
+				var count = 0;
+				class Square {
+					fun init(side) {
+						this.side = side;
+						count = count + 1;
+					}
+				}
+				fun area(square) {
+					return util.times(square.side, square.side);
+				}
+				fun describe() {
+					return "squares: " + count;
+				}
+				`,
+				"lib/util.lox": `
+				fun times(a, b) { return a * b; }
+				`,
+			},
+			[]string{"9", "1", "squares: 1"},
+		},
+		{
+			map[string]string{
+				"main.lox": `
+				import "counter.lox" as a;
+				import "./counter.lox" as b;
+				a.increment();
+				print b.value();
+				print a == b;
+				print a;
+				`,
+				"counter.lox": `
+				print "loading counter";
+				var n = 0;
+				fun increment() { n = n + 1; }
+				fun value() { return n; }
+				`,
+			},
+			[]string{"loading counter", "1", "true", "<module counter.lox>"},
+		},
+		{
+			map[string]string{
+				"main.lox": `
+				try {
+					import "broken.lox" as broken;
+				} catch (e) {
+					print e.type;
+				}
+				fun load() {
+					import "ok.lox" as ok;
+					return ok.name;
+				}
+				print load();
+				`,
+				"broken.lox": `
+				var x = 1 / 0;
+				`,
+				"ok.lox": `
+				var name = "ok";
+				`,
+			},
+			[]string{"E_DIVIDE_BY_ZERO", "ok"},
+		},
+	}
+
+	for _, test := range tests {
+		output, errs := runModuleProgram(test.files, "main.lox")
+		if len(errs) > 0 {
+			t.Errorf("unexpected error(s): %v", errs)
+			continue
+		}
+
+		if len(output) != len(test.expectedOutput) {
+			t.Errorf("expected output %v, got %v", test.expectedOutput, output)
+			continue
+		}
+
+		for i, line := range output {
+			if line != test.expectedOutput[i] {
+				t.Errorf("expected output idx %d to be %q, got %q", i, test.expectedOutput[i], line)
+			}
+		}
+	}
+}
+
+func TestBadModulePrograms(t *testing.T) {
+	tests := []struct {
+		files         map[string]string
+		expectedError int32
+	}{
+		{
+			map[string]string{
+				"main.lox": `import "a.lox" as a;`,
+				"a.lox":    `import "b.lox" as b;`,
+				"b.lox":    `import "a.lox" as a;`,
+			},
+			E_CYCLIC_IMPORT,
+		},
+		{
+			map[string]string{
+				"main.lox": `import "main.lox" as self;`,
+			},
+			E_CYCLIC_IMPORT,
+		},
+		{
+			map[string]string{
+				"main.lox": `import "missing.lox" as missing;`,
+			},
+			E_IMPORT_FAILED,
+		},
+		{
+			map[string]string{
+				"main.lox":   `import "syntax.lox" as syntax;`,
+				"syntax.lox": `var = 1;`,
+			},
+			E_IMPORT_FAILED,
+		},
+		{
+			map[string]string{
+				"main.lox": `
+				import "lib.lox" as lib;
+				print lib.missing;
+				`,
+				"lib.lox": `var present = 1;`,
+			},
+			E_UNDEFINED_OBJECT_PROPERTY,
+		},
+		{
+			map[string]string{
+				"main.lox": `
+				import "lib.lox" as lib;
+				print lib.clock;
+				`,
+				"lib.lox": `var present = clock();`,
+			},
+			E_UNDEFINED_OBJECT_PROPERTY,
+		},
+	}
+
+	for _, test := range tests {
+		_, errs := runModuleProgram(test.files, "main.lox")
+		if len(errs) != 1 {
+			t.Errorf("expected 1 error, got %v", errs)
+			continue
+		}
+
+		var loxError *LoxError
+		if !errors.As(errs[0], &loxError) || loxError.runtimeErrorType != test.expectedError {
+			t.Errorf("expected error type %d, got %v", test.expectedError, errs[0])
+		}
+	}
+}
+
+func TestModuleHostGlobals(t *testing.T) {
+	files := map[string]string{
+		"lib.lox": `
+		var origin = Point();
+		fun scaled(n) {
+			return double(n);
+		}
+		`,
+	}
+
+	output := make([]string, 0)
+	i := NewInterpreter(InterpreterConfig{
+		PrintFunc: func(value string) {
+			output = append(output, value)
+		},
+		ScriptPath: "main.lox",
+		ReadModule: func(path string) (string, error) {
+			return files[path], nil
+		},
+	})
+	if err := i.RegisterFunc("double", func(n float64) float64 { return n * 2 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.RegisterType("Point", point{}); err != nil {
+		t.Fatal(err)
+	}
+
+	stmts, errs := Compile(`
+	import "lib.lox" as lib;
+	print lib.scaled(4);
+	print type(lib.origin);
+	print lib.double;
+	`, NewResolver(i))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	_, err := i.Interpret(stmts)
+	var loxError *LoxError
+	if !errors.As(err, &loxError) || loxError.runtimeErrorType != E_UNDEFINED_OBJECT_PROPERTY {
+		t.Errorf("expected host globals not to be exported, got %v", err)
+	}
+
+	expected := []string{"8", "Point"}
+	if !reflect.DeepEqual(output, expected) {
+		t.Errorf("expected %v, got %v", expected, output)
+	}
+}
@@ -0,0 +1,132 @@
+package interpreter
+
+import "fmt"
+
+// operatorMethods names the methods a class defines to overload a binary
+// operator, and those of the right operand tried when the left operand does
+// not support it.
+var operatorMethods = map[TokenType]struct{ method, reflected string }{
+	TK_PLUS:          {"__add__", "__radd__"},
+	TK_MINUS:         {"__sub__", "__rsub__"},
+	TK_STAR:          {"__mul__", "__rmul__"},
+	TK_SLASH:         {"__div__", "__rdiv__"},
+	TK_LESS:          {"__lt__", "__gt__"},
+	TK_LESS_EQUAL:    {"__le__", "__ge__"},
+	TK_GREATER:       {"__gt__", "__lt__"},
+	TK_GREATER_EQUAL: {"__ge__", "__le__"},
+	TK_EQUAL_EQUAL:   {"__eq__", "__eq__"},
+	TK_BANG_EQUAL:    {"__ne__", "__ne__"},
+}
+
+// IsOperatorMethod reports whether a method named name overloads an operator.
+func IsOperatorMethod(name string) bool {
+	if name == "__neg__" {
+		return true
+	}
+	for _, methods := range operatorMethods {
+		if name == methods.method || name == methods.reflected {
+			return true
+		}
+	}
+	return false
+}
+
+// findMethod returns the method name of value bound to it, or nil if value is
+// not an instance defining it.
+func findMethod(value interface{}, name string) Callable {
+	instance, ok := value.(*KlassInstance)
+	if !ok {
+		return nil
+	}
+
+	klass, method := instance.klass.FindMethod(name)
+	if method == nil {
+		return nil
+	}
+	return bind(instance, name, method, klass)
+}
+
+func (i *Interpreter) callOperator(operator Token, method Callable, arguments ...interface{}) *result {
+	if method.Arity() != len(arguments) {
+		message := fmt.Sprintf("Method %s overloading '%s' must take %d arguments", method, operator.Lexeme, len(arguments))
+		return i.error(E_INVALID_ARGUMENTS, operator, message)
+	}
+
+	i.callSite = operator
+	value := method.Call(i, arguments)
+	if err, ok := value.(error); ok {
+		return Error(AtToken(err, operator))
+	}
+	return Result(value)
+}
+
+// overloadBinary applies a binary operator overloaded by an instance operand.
+// It reports false when neither operand is an instance, so the operator
+// applies to them as usual.
+func (i *Interpreter) overloadBinary(expr *Binary, left interface{}, right interface{}) (*result, bool) {
+	_, leftInstance := left.(*KlassInstance)
+	_, rightInstance := right.(*KlassInstance)
+	methods, ok := operatorMethods[expr.Operator.TokenType]
+	if !ok || !leftInstance && !rightInstance {
+		return nil, false
+	}
+
+	if method := findMethod(left, methods.method); method != nil {
+		return i.callOperator(expr.Operator, method, right), true
+	}
+	if method := findMethod(right, methods.reflected); method != nil {
+		return i.callOperator(expr.Operator, method, left), true
+	}
+
+	switch expr.Operator.TokenType {
+	case TK_EQUAL_EQUAL:
+		return Result(left == right), true
+	case TK_BANG_EQUAL:
+		// != negates __eq__ when __ne__ is not defined.
+		eq, other := findMethod(left, "__eq__"), right
+		if eq == nil {
+			eq, other = findMethod(right, "__eq__"), left
+		}
+		if eq == nil {
+			return Result(left != right), true
+		}
+
+		r := i.callOperator(expr.Operator, eq, other)
+		if r.IsError() {
+			return r, true
+		}
+		return Result(!r.IsTruthy()), true
+	case TK_PLUS:
+		// Strings still concatenate with instances.
+		if _, ok := left.(string); ok {
+			return nil, false
+		}
+		if _, ok := right.(string); ok {
+			return nil, false
+		}
+	}
+
+	message := fmt.Sprintf("Operator '%s' is not supported between %s and %s", expr.Operator.Lexeme, describeOperand(left), describeOperand(right))
+	return i.error(E_UNEXPECTED_TYPE, expr.Operator, message), true
+}
+
+func describeOperand(value interface{}) string {
+	if instance, ok := value.(*KlassInstance); ok {
+		return instance.String()
+	}
+	return TypeOf(value)
+}
+
+// overloadNegate applies unary minus overloaded by an instance with __neg__.
+func (i *Interpreter) overloadNegate(operator Token, value interface{}) (*result, bool) {
+	if _, ok := value.(*KlassInstance); !ok {
+		return nil, false
+	}
+
+	if method := findMethod(value, "__neg__"); method != nil {
+		return i.callOperator(operator, method), true
+	}
+
+	message := fmt.Sprintf("Operator '-' is not supported on %s", describeOperand(value))
+	return i.error(E_UNEXPECTED_TYPE, operator, message), true
+}
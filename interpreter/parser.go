@@ -5,6 +5,8 @@ type Parser struct {
 	errors []error
 
 	current int
+	// yielded is set once the function being parsed yields.
+	yielded bool
 }
 
 const MaxArguments = 255
@@ -15,22 +17,28 @@ Grammar:
 
 program        → declaration* EOF ;
 
-declaration    → funDecl | varDecl | classDecl | statement ;
+declaration    → funDecl | varDecl | classDecl | importDecl | statement ;
 
 varDecl        → "var" IDENTIFIER ( "=" expression )? ";" ;
 funDecl        → "fun" IDENTIFIER "(" parameters? ")" blockStmt ;
-classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" ( varDecl | funDecl )* "}";
+classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" ( varDecl | "fun" method | "class" ( varDecl | method ) )* "}";
+method         → IDENTIFIER ( "(" parameters? ")" )? blockStmt ;
+importDecl     → "import" STRING "as" IDENTIFIER ";" ;
 
-statement			 → exprStmt | printStmt | blockStmt | ifStmt | forStmt | whileStmt | returnStmt;
+statement			 → exprStmt | printStmt | blockStmt | ifStmt | forStmt | whileStmt | returnStmt | breakStmt | continueStmt | throwStmt | tryStmt;
 exprStmt       → expression ";" ;
 printStmt      → "print" expression ";" ;
 ifStmt				 → "if" "(" expression ")" statement ( "else" statement )? ;
 whileStmt			 → "while" "(" expression ")" statement ;
 forStmt				 → "for" "(" ( varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement ;
 returnStmt     → "return" ( expression? ) ";" ;
+breakStmt      → "break" ";" ;
+continueStmt   → "continue" ";" ;
+throwStmt      → "throw" expression ";" ;
+tryStmt        → "try" blockStmt ( "catch" "(" IDENTIFIER ")" blockStmt )? ( "finally" blockStmt )? ;
 
 expression     → ternary ;
-assignment 	   → ( call "." )? IDENTIFIER "=" assignment | ternary;
+assignment 	   → ( call "." )? IDENTIFIER "=" assignment | call "[" expression "]" "=" assignment | ternary;
 ternary				 → logical_or ( "?" expression ":" expression )? ;
 logical_or		 → logical_and ( "or" logical_and )* ;
 logical_and		 → equality ( "and" equality )* ;
@@ -39,9 +47,12 @@ comparison     → term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
 term 					 → factor ( ( "-" | "+" ) factor )* ;
 factor  			 → unary ( ( "/" | "*" ) unary )* ;
 unary          → ( "!" | "-" ) unary | call ;
-call           → primary ( ( "(" arguments? ")" ) | ( "." IDENTIFIER ) ) * ;
-primary        → IDENTIFIER | NUMBER | STRING | "true" | "false" | "nil" | lambda | ( "(" expression ")" ) ;
+call           → primary ( ( "(" arguments? ")" ) | ( "." IDENTIFIER ) | ( "[" expression "]" ) ) * ;
+primary        → IDENTIFIER | NUMBER | STRING | "true" | "false" | "nil" | lambda | list | map | ( "(" expression ")" ) ;
 
+list           → "[" arguments? "]" ;
+map            → "{" ( entry ( "," entry )* )? "}" ;
+entry          → expression ":" expression ;
 lambda         → "fun" "(" parameters? ")" blockStmt ;
 arguments      → expression ( "," expression )* ;
 parameters     → IDENTIFIER ( "," IDENTIFIER )* ;
@@ -53,6 +64,12 @@ func NewParser(tokens []Token) *Parser {
 }
 
 func (p *Parser) statement() (Stmt, error) {
+	start := p.current
+	stmt, err := p.parseStatement()
+	return p.stmtAt(start, stmt), err
+}
+
+func (p *Parser) parseStatement() (Stmt, error) {
 	if p.match(TK_PRINT) {
 		return p.printStmt()
 	}
@@ -77,6 +94,26 @@ func (p *Parser) statement() (Stmt, error) {
 		return p.returnStmt()
 	}
 
+	if p.match(TK_YIELD) {
+		return p.yieldStmt()
+	}
+
+	if p.match(TK_BREAK) {
+		return p.breakStmt()
+	}
+
+	if p.match(TK_CONTINUE) {
+		return p.continueStmt()
+	}
+
+	if p.match(TK_THROW) {
+		return p.throwStmt()
+	}
+
+	if p.match(TK_TRY) {
+		return p.tryStmt()
+	}
+
 	return p.exprStmt()
 }
 
@@ -100,6 +137,122 @@ func (p *Parser) returnStmt() (Stmt, error) {
 	return &ReturnStmt{Keyword: retToken, Expression: expression}, nil
 }
 
+// yieldStmt parses a yield, which makes the function it is in a generator.
+func (p *Parser) yieldStmt() (Stmt, error) {
+	keyword := p.previous()
+	p.yielded = true
+
+	var expression Expr
+	var err error
+	if !p.check(TK_SEMICOLON) {
+		expression, err = p.expression()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = p.consume(TK_SEMICOLON, "expected semicolon after yield")
+	if err != nil {
+		return nil, err
+	}
+
+	return &YieldStmt{Keyword: keyword, Expression: expression}, nil
+}
+
+func (p *Parser) breakStmt() (Stmt, error) {
+	keyword := p.previous()
+	_, err := p.consume(TK_SEMICOLON, "expected semicolon after break")
+	if err != nil {
+		return nil, err
+	}
+
+	return &BreakStmt{Keyword: keyword}, nil
+}
+
+func (p *Parser) continueStmt() (Stmt, error) {
+	keyword := p.previous()
+	_, err := p.consume(TK_SEMICOLON, "expected semicolon after continue")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContinueStmt{Keyword: keyword}, nil
+}
+
+func (p *Parser) throwStmt() (Stmt, error) {
+	keyword := p.previous()
+	expression, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(TK_SEMICOLON, "expected semicolon after throw")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThrowStmt{Keyword: keyword, Expression: expression}, nil
+}
+
+func (p *Parser) block(message string) (*BlockStmt, error) {
+	_, err := p.consume(TK_LEFT_BRACE, message)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := p.blockStmt()
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.(*BlockStmt), nil
+}
+
+func (p *Parser) tryStmt() (Stmt, error) {
+	stmt := &TryStmt{Keyword: p.previous()}
+
+	var err error
+	stmt.Body, err = p.block("expected block after try")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.match(TK_CATCH) {
+		_, err = p.consume(TK_LEFT_PAREN, "expected left parenthesis after catch")
+		if err != nil {
+			return nil, err
+		}
+
+		stmt.CatchName, err = p.consume(TK_IDENTIFIER, "expected identifier in catch clause")
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = p.consume(TK_RIGHT_PAREN, "expected right parenthesis after catch identifier")
+		if err != nil {
+			return nil, err
+		}
+
+		stmt.CatchBody, err = p.block("expected block after catch")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.match(TK_FINALLY) {
+		stmt.FinallyBody, err = p.block("expected block after finally")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.CatchBody == nil && stmt.FinallyBody == nil {
+		return nil, p.error(p.peek(), "expected catch or finally after try block")
+	}
+
+	return stmt, nil
+}
+
 func (p *Parser) ifStmt() (Stmt, error) {
 	_, errPL := p.consume(TK_LEFT_PAREN, "expected left parenthesis")
 	if errPL != nil {
@@ -158,6 +311,7 @@ func (p *Parser) whileStmt() (Stmt, error) {
 }
 
 func (p *Parser) forStmt() (Stmt, error) {
+	start := p.current - 1
 	_, errPL := p.consume(TK_LEFT_PAREN, "expected left parenthesis")
 	if errPL != nil {
 		return nil, errPL
@@ -205,15 +359,13 @@ func (p *Parser) forStmt() (Stmt, error) {
 		return nil, err
 	}
 
-	if incrExpr != nil {
-		stmt = &BlockStmt{Statements: []Stmt{stmt, &ExprStmt{Expression: incrExpr}}}
-	}
-
 	if condExpr == nil {
-		condExpr = &Literal{Value: true}
+		condExpr = p.exprAt(start, &Literal{Value: true})
 	}
 
-	stmt = &WhileStmt{Condition: condExpr, Body: stmt}
+	// The increment is kept apart from the body so that 'continue' still
+	// runs it before the next iteration.
+	stmt = p.stmtAt(start, &WhileStmt{Condition: condExpr, Body: stmt, Increment: incrExpr})
 
 	if initStmt != nil {
 		stmt = &BlockStmt{Statements: []Stmt{initStmt, stmt}}
@@ -232,6 +384,7 @@ func (p *Parser) exprStmt() (Stmt, error) {
 }
 
 func (p *Parser) blockStmt() (Stmt, error) {
+	start := p.current - 1
 	stmts := make([]Stmt, 0)
 	for !p.isAtEnd() && p.peek().TokenType != TK_RIGHT_BRACE {
 		stmt, err := p.declaration()
@@ -245,19 +398,26 @@ func (p *Parser) blockStmt() (Stmt, error) {
 
 	p.consume(TK_RIGHT_BRACE, "Expect '}' after block.")
 
-	return &BlockStmt{Statements: stmts}, nil
+	return p.stmtAt(start, &BlockStmt{Statements: stmts}), nil
 }
 
 func (p *Parser) printStmt() (Stmt, error) {
+	keyword := p.previous()
 	expr, err := p.expression()
 	if err != nil {
 		return nil, err
 	}
 	p.consume(TK_SEMICOLON, "Expect ';' after value.")
-	return &PrintStmt{Expression: expr}, nil
+	return &PrintStmt{Keyword: keyword, Expression: expr}, nil
 }
 
 func (p *Parser) declaration() (Stmt, error) {
+	start := p.current
+	stmt, err := p.parseDeclaration()
+	return p.stmtAt(start, stmt), err
+}
+
+func (p *Parser) parseDeclaration() (Stmt, error) {
 	if p.match(TK_VAR) {
 		return p.varDecl()
 	}
@@ -267,14 +427,26 @@ func (p *Parser) declaration() (Stmt, error) {
 		return p.functionDecl()
 	}
 
+	if p.match(TK_ASYNC) {
+		return p.asyncFunctionDecl()
+	}
+
 	if p.match(TK_CLASS) {
 		return p.classDecl()
 	}
 
+	if p.match(TK_IMPORT) {
+		return p.importDecl()
+	}
+
 	return p.statement()
 }
 
-func (p *Parser) lambda() (Expr, error) {
+func (p *Parser) lambda(isAsync bool) (Expr, error) {
+	start := p.current - 1
+	if isAsync {
+		start--
+	}
 	token := p.previous()
 
 	stmt, err := p.finishFunction(token)
@@ -283,7 +455,7 @@ func (p *Parser) lambda() (Expr, error) {
 	}
 
 	fStmt := stmt.(*FunctionStmt)
-	return &Lambda{Name: fStmt.Name, Params: fStmt.Params, Body: fStmt.Body}, nil
+	return p.exprAt(start, &Lambda{Name: fStmt.Name, Params: fStmt.Params, Body: fStmt.Body, IsAsync: isAsync, IsGenerator: fStmt.IsGenerator}), nil
 }
 
 func (p *Parser) finishFunction(token Token) (Stmt, error) {
@@ -321,12 +493,22 @@ final:
 		return nil, err
 	}
 
+	return p.functionBody(token, tokList)
+}
+
+// functionBody parses the body of a function once its opening brace has been
+// consumed.
+func (p *Parser) functionBody(token Token, tokList []Token) (*FunctionStmt, error) {
+	enclosingYielded := p.yielded
+	p.yielded = false
+	defer func() { p.yielded = enclosingYielded }()
+
 	block, err := p.blockStmt()
 	if err != nil {
 		return nil, err
 	}
 
-	return &FunctionStmt{Name: token, Params: tokList, Body: block.(*BlockStmt).Statements}, nil
+	return &FunctionStmt{Name: token, Params: tokList, Body: block.(*BlockStmt).Statements, IsGenerator: p.yielded}, nil
 }
 
 func (p *Parser) classDecl() (Stmt, error) {
@@ -343,6 +525,7 @@ func (p *Parser) classDecl() (Stmt, error) {
 		}
 
 		superToken = &Variable{Name: tok}
+		superToken.SetSpan(tok.Span())
 	}
 
 	_, err = p.consume(TK_LEFT_BRACE, "Expected '{' to open class definition")
@@ -350,23 +533,126 @@ func (p *Parser) classDecl() (Stmt, error) {
 		return nil, err
 	}
 
-	functions := make([]*FunctionStmt, 0)
+	class := &ClassStmt{
+		Name:         idToken,
+		SuperClass:   superToken,
+		Fields:       make([]*VarStmt, 0),
+		Methods:      make([]*FunctionStmt, 0),
+		ClassMethods: make([]*FunctionStmt, 0),
+		ClassFields:  make([]*VarStmt, 0),
+	}
 
-	for p.match(TK_FUN) {
-		fStmt, err := p.functionDecl()
+	for !p.check(TK_RIGHT_BRACE) && !p.isAtEnd() {
+		// A bad member is skipped so the rest of the class body still parses.
+		if err := p.classMember(class); err != nil {
+			p.synchronizeMember()
+		}
+	}
+
+	_, err = p.consume(TK_RIGHT_BRACE, "Expected '}' to close class definition")
+	if err != nil {
+		return nil, err
+	}
+
+	return class, nil
+}
+
+// classMember parses a field or method of a class body and adds it to class.
+func (p *Parser) classMember(class *ClassStmt) error {
+	start := p.current
+	if p.match(TK_VAR) {
+		vStmt, err := p.varDecl()
 		if err != nil {
-			return nil, err
+			return err
 		}
+		p.stmtAt(start, vStmt)
 
-		functions = append(functions, fStmt.(*FunctionStmt))
+		class.Fields = append(class.Fields, vStmt.(*VarStmt))
+		return nil
 	}
 
-	_, err = p.consume(TK_RIGHT_BRACE, "Expected '}' to close class definition")
+	if p.match(TK_CLASS) {
+		// Class members belong to the class itself rather than its instances.
+		if p.match(TK_VAR) {
+			vStmt, err := p.varDecl()
+			if err != nil {
+				return err
+			}
+			p.stmtAt(start, vStmt)
+
+			class.ClassFields = append(class.ClassFields, vStmt.(*VarStmt))
+			return nil
+		}
+
+		fStmt, err := p.methodDecl()
+		if err != nil {
+			return err
+		}
+		p.stmtAt(start, fStmt)
+
+		class.ClassMethods = append(class.ClassMethods, fStmt.(*FunctionStmt))
+		return nil
+	}
+
+	var fStmt Stmt
+	var err error
+	if p.match(TK_ASYNC) {
+		fStmt, err = p.asyncFunctionDecl()
+	} else if p.match(TK_FUN) {
+		fStmt, err = p.methodDecl()
+	} else {
+		err = p.error(p.peek(), "Expected field or method declaration")
+	}
+	if err != nil {
+		return err
+	}
+	p.stmtAt(start, fStmt)
+
+	class.Methods = append(class.Methods, fStmt.(*FunctionStmt))
+	return nil
+}
+
+// synchronizeMember skips to the next member of a class body, or the '}'
+// closing it, after an error in a member.
+func (p *Parser) synchronizeMember() {
+	depth := 0
+	for !p.isAtEnd() {
+		if depth == 0 && p.check(TK_RIGHT_BRACE) {
+			return
+		}
+
+		switch p.advance().TokenType {
+		case TK_LEFT_BRACE:
+			depth++
+		case TK_RIGHT_BRACE:
+			depth--
+		}
+
+		if depth == 0 && (p.check(TK_VAR) || p.check(TK_FUN) || p.check(TK_ASYNC) || p.check(TK_CLASS)) {
+			return
+		}
+	}
+}
+
+// methodDecl parses a method, which is a getter when its name is not followed
+// by a parameter list.
+func (p *Parser) methodDecl() (Stmt, error) {
+	idToken, err := p.consume(TK_IDENTIFIER, "Expected method name")
 	if err != nil {
 		return nil, err
 	}
 
-	return &ClassStmt{Name: idToken, Methods: functions, SuperClass: superToken}, nil
+	if p.match(TK_LEFT_BRACE) {
+		stmt, err := p.functionBody(idToken, make([]Token, 0))
+		if err != nil {
+			return nil, err
+		}
+
+		stmt.IsGetter = true
+		return stmt, nil
+	}
+
+	return p.finishFunction(idToken)
 }
 
 func (p *Parser) functionDecl() (Stmt, error) {
@@ -378,6 +664,42 @@ func (p *Parser) functionDecl() (Stmt, error) {
 	return p.finishFunction(idToken)
 }
 
+// asyncFunctionDecl parses a function declared with 'async fun'.
+func (p *Parser) asyncFunctionDecl() (Stmt, error) {
+	if _, err := p.consume(TK_FUN, "Expected 'fun' after 'async'"); err != nil {
+		return nil, err
+	}
+
+	stmt, err := p.functionDecl()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt.(*FunctionStmt).IsAsync = true
+	return stmt, nil
+}
+
+func (p *Parser) importDecl() (Stmt, error) {
+	keyword := p.previous()
+	path, err := p.consume(TK_STRING, "Expect module path after 'import'.")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.consume(TK_AS, "Expect 'as' after module path.")
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := p.consume(TK_IDENTIFIER, "Expect module name after 'as'.")
+	if err != nil {
+		return nil, err
+	}
+
+	p.consume(TK_SEMICOLON, "Expect ';' after import.")
+	return &ImportStmt{Keyword: keyword, Path: path, Name: name}, nil
+}
+
 func (p *Parser) varDecl() (Stmt, error) {
 	token, err := p.consume(TK_IDENTIFIER, "Expect variable name.")
 	if err != nil {
@@ -401,6 +723,7 @@ func (p *Parser) expression() (Expr, error) {
 }
 
 func (p *Parser) assignment() (Expr, error) {
+	start := p.current
 	expr, err := p.ternary()
 	if err != nil {
 		return nil, err
@@ -414,9 +737,11 @@ func (p *Parser) assignment() (Expr, error) {
 		}
 
 		if variable, ok := expr.(*Variable); ok {
-			return &Assign{Name: variable.Name, Value: value}, nil
+			return p.exprAt(start, &Assign{Name: variable.Name, Value: value}), nil
 		} else if get, ok := expr.(*Get); ok {
-			return &Set{Object: get.Object, Name: get.Name, Value: value}, nil
+			return p.exprAt(start, &Set{Object: get.Object, Name: get.Name, Value: value}), nil
+		} else if getIndex, ok := expr.(*GetIndex); ok {
+			return p.exprAt(start, &SetIndex{Object: getIndex.Object, Bracket: getIndex.Bracket, Index: getIndex.Index, Value: value}), nil
 		}
 
 		return nil, p.error(equals, "Invalid assignment target.")
@@ -426,6 +751,7 @@ func (p *Parser) assignment() (Expr, error) {
 }
 
 func (p *Parser) ternary() (Expr, error) {
+	start := p.current
 	expr, err := p.logicalOr()
 	if err != nil {
 		return nil, err
@@ -444,13 +770,14 @@ func (p *Parser) ternary() (Expr, error) {
 			return nil, err
 		}
 
-		return &TernaryCondition{Condition: expr, TrueBranch: trueExpr, FalseBranch: falseExpr}, nil
+		return p.exprAt(start, &TernaryCondition{Condition: expr, TrueBranch: trueExpr, FalseBranch: falseExpr}), nil
 	}
 
 	return expr, nil
 }
 
 func (p *Parser) logicalOr() (Expr, error) {
+	start := p.current
 	expr, err := p.logicalAnd()
 	if err != nil {
 		return nil, err
@@ -462,13 +789,14 @@ func (p *Parser) logicalOr() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = &Logical{Left: expr, Operator: op, Right: right}
+		expr = p.exprAt(start, &Logical{Left: expr, Operator: op, Right: right})
 	}
 
 	return expr, nil
 }
 
 func (p *Parser) logicalAnd() (Expr, error) {
+	start := p.current
 	expr, err := p.equality()
 	if err != nil {
 		return nil, err
@@ -480,13 +808,14 @@ func (p *Parser) logicalAnd() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = &Logical{Left: expr, Operator: op, Right: right}
+		expr = p.exprAt(start, &Logical{Left: expr, Operator: op, Right: right})
 	}
 
 	return expr, nil
 }
 
 func (p *Parser) equality() (Expr, error) {
+	start := p.current
 	expr, err := p.comparison()
 	if err != nil {
 		return nil, err
@@ -499,13 +828,14 @@ func (p *Parser) equality() (Expr, error) {
 			return nil, err
 		}
 
-		expr = &Binary{Left: expr, Operator: operator, Right: right}
+		expr = p.exprAt(start, &Binary{Left: expr, Operator: operator, Right: right})
 	}
 
 	return expr, nil
 }
 
 func (p *Parser) comparison() (Expr, error) {
+	start := p.current
 	expr, err := p.term()
 	if err != nil {
 		return nil, err
@@ -519,13 +849,14 @@ func (p *Parser) comparison() (Expr, error) {
 			return nil, err
 		}
 
-		expr = &Binary{Left: expr, Operator: operator, Right: right}
+		expr = p.exprAt(start, &Binary{Left: expr, Operator: operator, Right: right})
 	}
 
 	return expr, nil
 }
 
 func (p *Parser) term() (Expr, error) {
+	start := p.current
 	expr, err := p.factor()
 	if err != nil {
 		return nil, err
@@ -538,13 +869,14 @@ func (p *Parser) term() (Expr, error) {
 			return nil, err
 		}
 
-		expr = &Binary{Left: expr, Operator: operator, Right: right}
+		expr = p.exprAt(start, &Binary{Left: expr, Operator: operator, Right: right})
 	}
 
 	return expr, nil
 }
 
 func (p *Parser) factor() (Expr, error) {
+	start := p.current
 	expr, err := p.unary()
 	if err != nil {
 		return nil, err
@@ -556,27 +888,40 @@ func (p *Parser) factor() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		expr = &Binary{Left: expr, Operator: operator, Right: right}
+		expr = p.exprAt(start, &Binary{Left: expr, Operator: operator, Right: right})
 	}
 
 	return expr, nil
 }
 
 func (p *Parser) unary() (Expr, error) {
+	if p.match(TK_AWAIT) {
+		start := p.current - 1
+		keyword := p.previous()
+		value, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return p.exprAt(start, &Await{Keyword: keyword, Value: value}), nil
+	}
+
 	if p.match(TK_BANG, TK_MINUS) {
+		start := p.current - 1
 		operator := p.previous()
 		right, err := p.unary()
 		if err != nil {
 			return nil, err
 		}
 
-		return &Unary{Operator: operator, Right: right}, nil
+		return p.exprAt(start, &Unary{Operator: operator, Right: right}), nil
 	}
 
 	return p.call()
 }
 
 func (p *Parser) call() (Expr, error) {
+	start := p.current
 	primary, err := p.primary()
 	if err != nil {
 		return nil, err
@@ -588,13 +933,27 @@ func (p *Parser) call() (Expr, error) {
 			if err != nil {
 				return nil, err
 			}
+			primary = p.exprAt(start, primary)
 		} else if p.match(TK_DOT) {
 			identifier, err := p.consume(TK_IDENTIFIER, "Expected identifier in a dot expression")
 			if err != nil {
 				return nil, err
 			}
 
-			primary = &Get{Object: primary, Name: identifier}
+			primary = p.exprAt(start, &Get{Object: primary, Name: identifier})
+		} else if p.match(TK_LEFT_BRACKET) {
+			bracket := p.previous()
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = p.consume(TK_RIGHT_BRACKET, "Expected ']' after index")
+			if err != nil {
+				return nil, err
+			}
+
+			primary = p.exprAt(start, &GetIndex{Object: primary, Bracket: bracket, Index: index})
 		} else {
 			break
 		}
@@ -632,7 +991,90 @@ finish:
 	return &Call{Callee: expr, Arguments: exprList, Paren: p.previous()}, nil
 }
 
+func (p *Parser) list() (Expr, error) {
+	start := p.current - 1
+	bracket := p.previous()
+	elements := make([]Expr, 0)
+
+	if p.check(TK_RIGHT_BRACKET) {
+		goto finish
+	}
+
+	for {
+		element, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+
+		elements = append(elements, element)
+
+		if !p.match(TK_COMMA) {
+			break
+		}
+	}
+
+finish:
+	_, err := p.consume(TK_RIGHT_BRACKET, "Expected ']' after list elements")
+	if err != nil {
+		return nil, err
+	}
+
+	return p.exprAt(start, &ListLiteral{Bracket: bracket, Elements: elements}), nil
+}
+
+func (p *Parser) mapLiteral() (Expr, error) {
+	start := p.current - 1
+	brace := p.previous()
+	keys := make([]Expr, 0)
+	values := make([]Expr, 0)
+
+	if p.check(TK_RIGHT_BRACE) {
+		goto finish
+	}
+
+	for {
+		key, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = p.consume(TK_COLON, "Expected ':' after map key")
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+		values = append(values, value)
+
+		if !p.match(TK_COMMA) {
+			break
+		}
+	}
+
+finish:
+	_, err := p.consume(TK_RIGHT_BRACE, "Expected '}' after map entries")
+	if err != nil {
+		return nil, err
+	}
+
+	return p.exprAt(start, &MapLiteral{Brace: brace, Keys: keys, Values: values}), nil
+}
+
 func (p *Parser) primary() (Expr, error) {
+	start := p.current
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return p.exprAt(start, expr), nil
+}
+
+func (p *Parser) parsePrimary() (Expr, error) {
 	if p.match(TK_FALSE) {
 		return &Literal{Value: false}, nil
 	} else if p.match(TK_TRUE) {
@@ -659,7 +1101,16 @@ func (p *Parser) primary() (Expr, error) {
 
 		return &Super{Super: superTok, Call: call}, nil
 	} else if p.match(TK_FUN) {
-		return p.lambda()
+		return p.lambda(false)
+	} else if p.match(TK_ASYNC) {
+		if _, err := p.consume(TK_FUN, "Expected 'fun' after 'async'"); err != nil {
+			return nil, err
+		}
+		return p.lambda(true)
+	} else if p.match(TK_LEFT_BRACKET) {
+		return p.list()
+	} else if p.match(TK_LEFT_BRACE) {
+		return p.mapLiteral()
 	} else if p.match(TK_LEFT_PAREN) {
 		expr, err := p.expression()
 		if err != nil {
@@ -673,12 +1124,40 @@ func (p *Parser) primary() (Expr, error) {
 	return nil, p.error(p.peek(), "Expected expression.")
 }
 
+// exprAt sets the span of expr, unless it already has one, to run from the
+// token at start to the last token consumed.
+func (p *Parser) exprAt(start int, expr Expr) Expr {
+	if expr != nil && expr.Span().IsZero() {
+		p.setSpan(start, expr.(spanned))
+	}
+	return expr
+}
+
+func (p *Parser) stmtAt(start int, stmt Stmt) Stmt {
+	if stmt != nil && stmt.Span().IsZero() {
+		p.setSpan(start, stmt.(spanned))
+	}
+	return stmt
+}
+
+func (p *Parser) setSpan(start int, node spanned) {
+	end := p.tokens[start]
+	if p.current > start {
+		end = p.previous()
+	}
+	node.SetSpan(Span{Start: p.tokens[start].Span().Start, End: end.Span().End})
+}
+
 func (p *Parser) error(t Token, msg string) error {
-	var err error
+	where := " at '" + t.Lexeme + "'"
 	if t.TokenType == TK_EOF {
-		err = NewTokenError(t.Line, " at end", msg)
-	} else {
-		err = NewTokenError(t.Line, " at '"+t.Lexeme+"'", msg)
+		where = " at end"
+	}
+	err := &LoxError{line: t.Line, message: msg, where: where, runtimeErrorType: E_NO_ERROR, span: t.Span()}
+
+	// Only the first error at a token is reported, the others follow from it.
+	if len(p.errors) > 0 && p.errors[len(p.errors)-1].(*LoxError).span == err.span {
+		return err
 	}
 
 	p.errors = append(p.errors, err)
@@ -740,12 +1219,44 @@ func (p *Parser) peek() Token {
 	return p.tokens[p.current]
 }
 
+// synchronize discards tokens until the start of the next statement so that
+// one syntax error is not reported again for the rest of the statement.
+// Blocks opened by the discarded tokens are skipped whole, and a closing brace
+// is left for the enclosing block to consume.
 func (p *Parser) synchronize() {
+	depth := 0
 	for !p.isAtEnd() {
+		if p.check(TK_RIGHT_BRACE) {
+			if depth == 0 {
+				return
+			}
+
+			p.advance()
+			depth--
+			if depth == 0 {
+				return
+			}
+			continue
+		}
+
 		token := p.advance()
+		if token.TokenType == TK_LEFT_BRACE {
+			depth++
+		}
+
+		if depth > 0 {
+			continue
+		}
+
 		if token.TokenType == TK_SEMICOLON {
 			return
 		}
+
+		switch p.peek().TokenType {
+		case TK_CLASS, TK_FUN, TK_ASYNC, TK_VAR, TK_FOR, TK_IF, TK_WHILE, TK_PRINT, TK_RETURN,
+			TK_IMPORT, TK_TRY, TK_THROW, TK_BREAK, TK_CONTINUE, TK_YIELD:
+			return
+		}
 	}
 }
 
@@ -769,6 +1280,9 @@ func (p *Parser) Parse() []Stmt {
 		stmt, err := p.declaration()
 		if err != nil {
 			p.synchronize()
+
+			// A stray closing brace has no block to end it, skip it.
+			p.match(TK_RIGHT_BRACE)
 		}
 		if stmt != nil {
 			stmts = append(stmts, stmt)
@@ -93,6 +93,12 @@ func TestParseExpressions(t *testing.T) {
 		{"foo()", "(call (var foo) (arg))"},
 		{"foo()()", "(call (call (var foo) (arg)) (arg))"},
 		{"foo(1+2, a)", "(call (var foo) (arg (+ 1 2) (var a)))"},
+		{"[]", "(list)"},
+		{"[1, a]", "(list 1 (var a))"},
+		{"a[1][b]", "(index (index (var a) 1) (var b))"},
+		{"a.b[0] = 2", "(set-index (get \"b\" (var a)) 0 2)"},
+		{"{}", "(map)"},
+		{"{\"a\": 1, b: c ? 1 : 2}", "(map \"a\" 1 (var b) (?: (var c) 1 2))"},
 	}
 
 	for _, test := range tests {
@@ -130,6 +136,10 @@ func TestParseControlFlowStatements(t *testing.T) {
 		{"for (;;) {1;}", "(scope (while true (scope 1)))"},
 		{"for (var i = 0; i < 10; i = i + 1) print i;", "(scope (scope (def i 0) (while (< (var i) 10) (scope (print (var i)) (= (var i) (+ (var i) 1))))))"},
 		{"for (var i = 0; i < 10;) print i;", "(scope (scope (def i 0) (while (< (var i) 10) (print (var i)))))"},
+		{"while (true) { break; continue; }", "(scope (while true (scope (break) (continue))))"},
+		{"try { throw 1; } catch (e) { print e; }", "(scope (try (scope (throw 1)) (catch e (scope (print (var e))))))"},
+		{"try {} finally {}", "(scope (try (scope) (finally (scope))))"},
+		{"import \"lib/util.lox\" as util;", "(scope (import \"lib/util.lox\" util))"},
 	}
 
 	for _, test := range tests {
@@ -150,6 +160,25 @@ func TestParseFunctionStatements(t *testing.T) {
 		{"return 2 + 2;", "(scope (return (+ 2 2)))"},
 		{"var a = fun () {};", "(scope (def a (def () (scope))))"},
 		{"fun () {};", "(scope (def () (scope)))"},
+		{"async fun a(b) {return await b;}", "(scope (def async a(b) (scope (return (await (var b))))))"},
+		{"var a = async fun () {};", "(scope (def a (def async () (scope))))"},
+		{"fun a() {yield 1; yield;}", "(scope (def a() (scope (yield 1) (yield))))"},
+	}
+
+	for _, test := range tests {
+		runParseStmt(t, test.expression, test.expected)
+	}
+}
+
+func TestParseClassStatements(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"class A {}", "(scope (class A))"},
+		{"class A < B { fun m() {} }", "(scope (class A < B (def m() (scope))))"},
+		{"class A { var count = 0; var name; fun size { return 1; } }", "(scope (class A (def count 0) (def name) (get size (scope (return 1)))))"},
+		{"class A { class var pi = 3; class square(n) {} }", "(scope (class A (class (def pi 3)) (class (def square(n) (scope)))))"},
 	}
 
 	for _, test := range tests {
@@ -166,12 +195,61 @@ func TestParseErrors(t *testing.T) {
 		{"1;1 != 2;", 0, 2},
 		{"=;1 != 2;", 1, 1},
 		{"a=b; < != 2;print 3;", 1, 2},
-		{"for () print 1;", 1, 0},
-		{"for (;) print 1;", 1, 0},
+		{"for () print 1;", 1, 1},
+		{"for (;) print 1;", 1, 1},
 		{"for (;;) print 1;", 0, 1},
+		{"fun f( { print 1; } print 2;", 1, 1},
+		{"{ print 1 + ; print 2; } print 3;", 1, 2},
+		{"print 1 } print 2;", 1, 2},
+		{"if (a) { var = 1; } else { print ; } print 3;", 2, 2},
+		{"var a = 1 class B { fun m() { return 1 } } var c = 2;", 2, 3},
+		{"class A { fun 1() { print 1; } fun b() { return 1; } var c = 2; } print 3;", 1, 2},
+		{"class A { fun a(x { print x; } class b() {} } print 3;", 1, 2},
+		{"class A { b() { return 1; } fun c() { return 2; } } print 3;", 1, 2},
 	}
 
 	for _, test := range tests {
 		runParseErrors(t, test.expression, test.expectedErrors, test.expectedStmts)
 	}
 }
+
+func TestParseSpans(t *testing.T) {
+	source := "var x = a.b(1, 2) + -c;\nfor (;;) { print [x, {\"k\": x}][0]; }"
+	parser := NewParser(NewScanner(source).ScanTokens())
+	stmts := parser.Parse()
+	if parser.HasError() {
+		t.Fatalf("parser error: %v", parser.Errors())
+	}
+
+	text := func(node interface{ Span() Span }) string {
+		span := node.Span()
+		return source[span.Start.Offset:span.End.Offset]
+	}
+
+	varStmt := stmts[0].(*VarStmt)
+	sum := varStmt.Initializer.(*Binary)
+	printStmt := stmts[1].(*WhileStmt).Body.(*BlockStmt).Statements[0].(*PrintStmt)
+	tests := []struct {
+		node     interface{ Span() Span }
+		expected string
+	}{
+		{varStmt, "var x = a.b(1, 2) + -c;"},
+		{sum, "a.b(1, 2) + -c"},
+		{sum.Left, "a.b(1, 2)"},
+		{sum.Left.(*Call).Callee, "a.b"},
+		{sum.Right, "-c"},
+		{stmts[1], "for (;;) { print [x, {\"k\": x}][0]; }"},
+		{printStmt, "print [x, {\"k\": x}][0];"},
+		{printStmt.Expression.(*GetIndex).Object, "[x, {\"k\": x}]"},
+	}
+
+	for _, test := range tests {
+		if actual := text(test.node); actual != test.expected {
+			t.Errorf("expected span %q, got %q", test.expected, actual)
+		}
+	}
+
+	if span := stmts[1].Span(); span.Start.Line != 2 || span.Start.Column != 1 {
+		t.Errorf("expected for loop to start at 2:1, got %v", span)
+	}
+}
@@ -13,17 +13,68 @@ const (
 	CALL_TYPE_INIT
 )
 
+// Resolver performs the static checks on a program and records how far away
+// each local variable is declared. A nil interpreter runs only the checks.
 type Resolver struct {
 	scopes                  *util.Stack[map[string]bool]
 	i                       *Interpreter
 	errs                    []error
 	currentFunctionCallType FunctionCallType
+	inAsyncFunction         bool
+	inGenerator             bool
+	loopDepth               int
+
+	// Only maintained when the resolver is indexing symbols.
+	index   *SymbolIndex
+	symbols *util.Stack[map[string]*Symbol]
+	parent  *Symbol
 }
 
 func NewResolver(i *Interpreter) *Resolver {
 	return &Resolver{scopes: util.NewStack[map[string]bool](), i: i, errs: make([]error, 0), currentFunctionCallType: CALL_TYPE_NONE}
 }
 
+// IndexSymbols makes the resolver record the declarations and references it
+// resolves from now on in the returned index.
+func (r *Resolver) IndexSymbols() *SymbolIndex {
+	r.index = &SymbolIndex{
+		Symbols:    make([]*Symbol, 0),
+		References: make([]Reference, 0),
+		globals:    make(map[string]*Symbol),
+		pending:    make(map[string][]int),
+	}
+	r.symbols = util.NewStack[map[string]*Symbol]()
+	for idx := 0; idx < r.scopes.Length(); idx++ {
+		r.symbols.Push(make(map[string]*Symbol))
+	}
+	return r.index
+}
+
+// declareSymbol declares name and records it in the index, if there is one.
+func (r *Resolver) declareSymbol(name Token, kind SymbolKind, declaration Stmt) *Symbol {
+	r.declare(name)
+	if r.index == nil {
+		return nil
+	}
+
+	symbol := r.recordSymbol(name, kind, declaration)
+	if !r.symbols.IsEmpty() {
+		r.symbols.Peek()[name.Lexeme] = symbol
+	}
+	return symbol
+}
+
+// recordSymbol adds a symbol to the index without bringing it into scope.
+func (r *Resolver) recordSymbol(name Token, kind SymbolKind, declaration Stmt) *Symbol {
+	if r.index == nil {
+		return nil
+	}
+
+	symbol := &Symbol{Name: name, Kind: kind, Declaration: declaration, Parent: r.parent, Depth: r.scopes.Length()}
+	r.index.declare(symbol)
+	return symbol
+}
+
 func (r *Resolver) define(name string) {
 	if r.scopes.IsEmpty() {
 		return
@@ -49,15 +100,31 @@ func (r *Resolver) resolveLocal(expr Expr, name Token) {
 	if name.TokenType == TK_SUPER {
 		println("test")
 	}
+	r.indexReference(name)
 	r.scopes.ForEach(func(i int, val map[string]bool) bool {
 		if _, exists := val[name.Lexeme]; exists {
-			r.i.resolve(expr, r.scopes.Length()-1-i)
+			if r.i != nil {
+				r.i.resolve(expr, r.scopes.Length()-1-i)
+			}
 			return false
 		}
 		return true
 	})
 }
 
+func (r *Resolver) indexReference(name Token) {
+	if r.index == nil || name.TokenType == TK_THIS || name.TokenType == TK_SUPER {
+		return
+	}
+
+	var symbol *Symbol
+	r.symbols.ForEach(func(i int, val map[string]*Symbol) bool {
+		symbol = val[name.Lexeme]
+		return symbol == nil
+	})
+	r.index.reference(name, symbol)
+}
+
 func (r *Resolver) VisitSuper(expr *Super) interface{} {
 	r.resolveLocal(expr, expr.Super)
 	return nil
@@ -65,10 +132,16 @@ func (r *Resolver) VisitSuper(expr *Super) interface{} {
 
 func (r *Resolver) pushScope() {
 	r.scopes.Push(make(map[string]bool))
+	if r.index != nil {
+		r.symbols.Push(make(map[string]*Symbol))
+	}
 }
 
 func (r *Resolver) popScope() {
 	r.scopes.Pop()
+	if r.index != nil {
+		r.symbols.Pop()
+	}
 }
 
 func (r *Resolver) ResolveExpr(expr Expr) {
@@ -139,7 +212,7 @@ func (r *Resolver) VisitLogical(expr *Logical) interface{} {
 }
 
 func (r *Resolver) VisitVarStmt(stmt *VarStmt) interface{} {
-	r.declare(stmt.Name)
+	r.declareSymbol(stmt.Name, SYMBOL_VARIABLE, stmt)
 	if stmt.Initializer != nil {
 		r.ResolveExpr(stmt.Initializer)
 	}
@@ -147,11 +220,20 @@ func (r *Resolver) VisitVarStmt(stmt *VarStmt) interface{} {
 	return nil
 }
 
+func (r *Resolver) VisitImportStmt(stmt *ImportStmt) interface{} {
+	r.declareSymbol(stmt.Name, SYMBOL_MODULE, stmt)
+	r.define(stmt.Name.Lexeme)
+	return nil
+}
+
 func (r *Resolver) VisitFunctionStmt(stmt *FunctionStmt) interface{} {
-	r.declare(stmt.Name)
+	symbol := r.declareSymbol(stmt.Name, SYMBOL_FUNCTION, stmt)
 	r.define(stmt.Name.Lexeme)
 
-	r.resolveFunction(stmt.Params, stmt.Body, CALL_TYPE_FUNCTION)
+	enclosing := r.parent
+	r.parent = symbol
+	r.resolveFunction(stmt.Params, stmt.Body, CALL_TYPE_FUNCTION, stmt.IsAsync, stmt.IsGenerator)
+	r.parent = enclosing
 
 	return nil
 }
@@ -159,25 +241,28 @@ func (r *Resolver) VisitFunctionStmt(stmt *FunctionStmt) interface{} {
 var ThisToken = Token{TokenType: TK_THIS, Lexeme: "this", Literal: nil, Line: 0}
 var SuperToken = Token{TokenType: TK_SUPER, Lexeme: "super", Literal: nil, Line: 0}
 
-func (r *Resolver) resolveMethod(params []Token, body []Stmt, callType FunctionCallType) {
+func (r *Resolver) resolveMethod(params []Token, body []Stmt, callType FunctionCallType, isAsync bool, isGenerator bool) {
 	r.pushScope()
 
 	r.declare(ThisToken)
 	r.define("this")
 
-	r.resolveFunction(params, body, callType)
+	r.resolveFunction(params, body, callType, isAsync, isGenerator)
 
 	r.popScope()
 }
 
-func (r *Resolver) resolveFunction(params []Token, body []Stmt, callType FunctionCallType) {
-	enclosingFunction := r.currentFunctionCallType
-	r.currentFunctionCallType = callType
+func (r *Resolver) resolveFunction(params []Token, body []Stmt, callType FunctionCallType, isAsync bool, isGenerator bool) {
+	enclosingFunction, enclosingAsync, enclosingGenerator := r.currentFunctionCallType, r.inAsyncFunction, r.inGenerator
+	r.currentFunctionCallType, r.inAsyncFunction, r.inGenerator = callType, isAsync, isGenerator
+
+	enclosingLoopDepth := r.loopDepth
+	r.loopDepth = 0
 
 	r.pushScope()
 
 	for _, param := range params {
-		r.declare(param)
+		r.declareSymbol(param, SYMBOL_PARAMETER, nil)
 		r.define(param.Lexeme)
 	}
 
@@ -185,11 +270,12 @@ func (r *Resolver) resolveFunction(params []Token, body []Stmt, callType Functio
 
 	r.popScope()
 
-	r.currentFunctionCallType = enclosingFunction
+	r.currentFunctionCallType, r.inAsyncFunction, r.inGenerator = enclosingFunction, enclosingAsync, enclosingGenerator
+	r.loopDepth = enclosingLoopDepth
 }
 
 func (r *Resolver) VisitLambda(expr *Lambda) interface{} {
-	r.resolveFunction(expr.Params, expr.Body, CALL_TYPE_FUNCTION)
+	r.resolveFunction(expr.Params, expr.Body, CALL_TYPE_FUNCTION, expr.IsAsync, expr.IsGenerator)
 
 	return nil
 }
@@ -225,7 +311,7 @@ func (r *Resolver) VisitIfStmt(stmt *IfStmt) interface{} {
 	r.ResolveExpr(stmt.Condition)
 	r.ResolveStmt(stmt.ThenBranch)
 	if stmt.ElseBranch != nil {
-		r.ResolveStmt(stmt.ThenBranch)
+		r.ResolveStmt(stmt.ElseBranch)
 	}
 
 	return nil
@@ -233,11 +319,32 @@ func (r *Resolver) VisitIfStmt(stmt *IfStmt) interface{} {
 
 func (r *Resolver) VisitWhileStmt(stmt *WhileStmt) interface{} {
 	r.ResolveExpr(stmt.Condition)
+
+	r.loopDepth++
 	r.ResolveStmt(stmt.Body)
+	r.loopDepth--
+
+	if stmt.Increment != nil {
+		r.ResolveExpr(stmt.Increment)
+	}
 
 	return nil
 }
 
+func (r *Resolver) VisitBreakStmt(stmt *BreakStmt) interface{} {
+	if r.loopDepth == 0 {
+		r.errs = append(r.errs, stmt.Keyword.ToRuntimeError(E_UNEXPECTED_BREAK, "Cannot use 'break' outside of a loop"))
+	}
+	return nil
+}
+
+func (r *Resolver) VisitContinueStmt(stmt *ContinueStmt) interface{} {
+	if r.loopDepth == 0 {
+		r.errs = append(r.errs, stmt.Keyword.ToRuntimeError(E_UNEXPECTED_CONTINUE, "Cannot use 'continue' outside of a loop"))
+	}
+	return nil
+}
+
 func (r *Resolver) VisitCall(expr *Call) interface{} {
 	r.ResolveExpr(expr.Callee)
 
@@ -259,6 +366,57 @@ func (r *Resolver) VisitSet(expr *Set) interface{} {
 	return nil
 }
 
+func (r *Resolver) VisitListLiteral(expr *ListLiteral) interface{} {
+	for _, element := range expr.Elements {
+		r.ResolveExpr(element)
+	}
+	return nil
+}
+
+func (r *Resolver) VisitMapLiteral(expr *MapLiteral) interface{} {
+	for idx, key := range expr.Keys {
+		r.ResolveExpr(key)
+		r.ResolveExpr(expr.Values[idx])
+	}
+	return nil
+}
+
+func (r *Resolver) VisitGetIndex(expr *GetIndex) interface{} {
+	r.ResolveExpr(expr.Object)
+	r.ResolveExpr(expr.Index)
+	return nil
+}
+
+func (r *Resolver) VisitSetIndex(expr *SetIndex) interface{} {
+	r.ResolveExpr(expr.Object)
+	r.ResolveExpr(expr.Index)
+	r.ResolveExpr(expr.Value)
+	return nil
+}
+
+func (r *Resolver) VisitThrowStmt(stmt *ThrowStmt) interface{} {
+	r.ResolveExpr(stmt.Expression)
+	return nil
+}
+
+func (r *Resolver) VisitTryStmt(stmt *TryStmt) interface{} {
+	r.ResolveStmt(stmt.Body)
+
+	if stmt.CatchBody != nil {
+		r.pushScope()
+		r.declareSymbol(stmt.CatchName, SYMBOL_VARIABLE, nil)
+		r.define(stmt.CatchName.Lexeme)
+		r.ResolveStmts(stmt.CatchBody.Statements)
+		r.popScope()
+	}
+
+	if stmt.FinallyBody != nil {
+		r.ResolveStmt(stmt.FinallyBody)
+	}
+
+	return nil
+}
+
 func (r *Resolver) VisitReturnStmt(stmt *ReturnStmt) interface{} {
 	if r.currentFunctionCallType == CALL_TYPE_NONE {
 		return stmt.Keyword.ToRuntimeError(E_UNEXPECTED_RETURN, "Unexpected return in global scope")
@@ -267,6 +425,10 @@ func (r *Resolver) VisitReturnStmt(stmt *ReturnStmt) interface{} {
 	if stmt.Expression != nil {
 		r.ResolveExpr(stmt.Expression)
 
+		if r.inGenerator {
+			r.errs = append(r.errs, stmt.Keyword.ToRuntimeError(E_UNEXPECTED_RETURN, "Unexpected return expression in a generator"))
+		}
+
 		if r.currentFunctionCallType == CALL_TYPE_INIT {
 			if v, ok := stmt.Expression.(*Variable); !ok || v.Name.TokenType != TK_THIS {
 				r.errs = append(r.errs, stmt.Keyword.ToRuntimeError(E_UNEXPECTED_RETURN, "Unexpected return expression in `init`"))
@@ -277,10 +439,50 @@ func (r *Resolver) VisitReturnStmt(stmt *ReturnStmt) interface{} {
 	return nil
 }
 
+// VisitYieldStmt allows yield in functions, which makes them generators, but
+// not in `init` or async functions.
+func (r *Resolver) VisitYieldStmt(stmt *YieldStmt) interface{} {
+	switch {
+	case r.currentFunctionCallType == CALL_TYPE_NONE:
+		r.errs = append(r.errs, stmt.Keyword.ToRuntimeError(E_UNEXPECTED_YIELD, "Unexpected yield in global scope"))
+	case r.currentFunctionCallType == CALL_TYPE_INIT:
+		r.errs = append(r.errs, stmt.Keyword.ToRuntimeError(E_UNEXPECTED_YIELD, "`init` cannot be a generator"))
+	case r.inAsyncFunction:
+		r.errs = append(r.errs, stmt.Keyword.ToRuntimeError(E_UNEXPECTED_YIELD, "Async functions cannot be generators"))
+	}
+
+	if stmt.Expression != nil {
+		r.ResolveExpr(stmt.Expression)
+	}
+
+	return nil
+}
+
+// VisitAwait allows await in async functions and in the global scope, where
+// it runs the event loop until the awaited value is ready.
+func (r *Resolver) VisitAwait(expr *Await) interface{} {
+	if r.currentFunctionCallType != CALL_TYPE_NONE && !r.inAsyncFunction {
+		r.errs = append(r.errs, expr.Keyword.ToRuntimeError(E_UNEXPECTED_AWAIT, "Can only await in async functions"))
+	}
+	r.ResolveExpr(expr.Value)
+
+	return nil
+}
+
 func (r *Resolver) VisitClassStmt(stmt *ClassStmt) interface{} {
-	r.declare(stmt.Name)
+	symbol := r.declareSymbol(stmt.Name, SYMBOL_CLASS, stmt)
 	r.define(stmt.Name.Lexeme)
 
+	// Class fields are evaluated in the scope the class is declared in.
+	enclosing := r.parent
+	r.parent = symbol
+	for _, field := range stmt.ClassFields {
+		r.recordSymbol(field.Name, SYMBOL_FIELD, field)
+		if field.Initializer != nil {
+			r.ResolveExpr(field.Initializer)
+		}
+	}
+
 	if stmt.SuperClass != nil {
 		r.ResolveExpr(stmt.SuperClass)
 		r.pushScope()
@@ -288,13 +490,44 @@ func (r *Resolver) VisitClassStmt(stmt *ClassStmt) interface{} {
 		r.define("super")
 	}
 
+	// Fields are evaluated for each new instance, which they see as this.
+	enclosingFunction := r.currentFunctionCallType
+	r.currentFunctionCallType = CALL_TYPE_METHOD
+	for _, field := range stmt.Fields {
+		r.recordSymbol(field.Name, SYMBOL_FIELD, field)
+		if field.Initializer != nil {
+			r.pushScope()
+			r.declare(ThisToken)
+			r.define("this")
+			r.ResolveExpr(field.Initializer)
+			r.popScope()
+		}
+	}
+	r.currentFunctionCallType = enclosingFunction
+	r.parent = enclosing
+
 	for _, m := range stmt.Methods {
 		callType := CALL_TYPE_METHOD
 		if m.Name.Lexeme == "init" {
 			callType = CALL_TYPE_INIT
+			if m.IsAsync {
+				r.errs = append(r.errs, m.Name.ToRuntimeError(E_INVALID_CLASS, "`init` cannot be async"))
+			}
+			if m.IsGetter {
+				r.errs = append(r.errs, m.Name.ToRuntimeError(E_INVALID_CLASS, "`init` cannot be a getter"))
+			}
 		}
-		r.resolveMethod(m.Params, m.Body, callType)
+
+		r.parent = symbol
+		r.parent = r.recordSymbol(m.Name, SYMBOL_METHOD, m)
+		r.resolveMethod(m.Params, m.Body, callType, m.IsAsync, m.IsGenerator)
+	}
+	for _, m := range stmt.ClassMethods {
+		r.parent = symbol
+		r.parent = r.recordSymbol(m.Name, SYMBOL_METHOD, m)
+		r.resolveMethod(m.Params, m.Body, CALL_TYPE_METHOD, m.IsAsync, m.IsGenerator)
 	}
+	r.parent = enclosing
 
 	if stmt.SuperClass != nil {
 		r.popScope()
@@ -1,24 +1,17 @@
 package interpreter
 
-func RunProgram(config InterpreterConfig, program string) []error {
-	scanner := NewScanner(program)
-	tokens := scanner.ScanTokens()
-	if scanner.HasError() {
-		return scanner.Errors()
-	}
-
-	parser := NewParser(tokens)
-	stmts := parser.Parse()
-	if parser.HasError() {
-		return parser.Errors()
-	}
+import (
+	"fmt"
+	"sort"
+)
 
+func RunProgram(config InterpreterConfig, program string) []error {
 	i := NewInterpreter(config)
+	defer i.Close()
 
-	resolver := NewResolver(i)
-	resolver.ResolveStmts(stmts)
-	if resolver.HasError() {
-		return resolver.Errors()
+	stmts, errs := Compile(program, NewResolver(i))
+	if len(errs) > 0 {
+		return errs
 	}
 
 	_, err := i.Interpret(stmts)
@@ -28,3 +21,55 @@ func RunProgram(config InterpreterConfig, program string) []error {
 
 	return nil
 }
+
+// Compile scans, parses and resolves a program. Every phase runs even when an
+// earlier one fails so that all errors are reported at once, ordered by
+// line.
+func Compile(program string, resolver *Resolver) ([]Stmt, []error) {
+	scanner := NewScanner(program)
+	tokens := scanner.ScanTokens()
+
+	parser := NewParser(tokens)
+	stmts := parser.Parse()
+
+	resolved := len(resolver.Errors())
+	resolver.ResolveStmts(stmts)
+
+	errs := make([]error, 0)
+	errs = append(errs, scanner.Errors()...)
+
+	// The scanner drops the characters it reports, so syntax errors on the
+	// same line usually follow from them.
+	scanned := make(map[int]bool)
+	for _, err := range scanner.Errors() {
+		scanned[errorLine(err)] = true
+	}
+	for _, err := range parser.Errors() {
+		if !scanned[errorLine(err)] {
+			errs = append(errs, err)
+		}
+	}
+
+	errs = append(errs, resolver.Errors()[resolved:]...)
+	sort.SliceStable(errs, func(a, b int) bool {
+		return errorLine(errs[a]) < errorLine(errs[b])
+	})
+
+	return stmts, errs
+}
+
+func errorLine(err error) int {
+	line := 0
+	IfLoxError(err, func(loxError *LoxError) {
+		line = loxError.line
+	})
+	return line
+}
+
+// ErrorCount summarizes how many errors a program has.
+func ErrorCount(errs []error) string {
+	if len(errs) == 1 {
+		return "1 error"
+	}
+	return fmt.Sprintf("%d errors", len(errs))
+}
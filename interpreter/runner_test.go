@@ -0,0 +1,34 @@
+package interpreter
+
+import "testing"
+
+func TestCompileReportsAllErrors(t *testing.T) {
+	program := `
+var a = 1 +;
+fun f() {
+	var b = 1;
+	var b = 2;
+}
+var c = #;
+break;
+`
+	expectedLines := []int{2, 5, 7, 8}
+
+	for _, runner := range ProgramRunners {
+		errs := runner.Run(InterpreterConfig{}, program)
+		if len(errs) != len(expectedLines) {
+			t.Errorf("%s: expected %d errors, got %v", runner.Name, len(expectedLines), errs)
+			continue
+		}
+
+		for idx, err := range errs {
+			if line := errorLine(err); line != expectedLines[idx] {
+				t.Errorf("%s: expected error %d on line %d, got %v", runner.Name, idx, expectedLines[idx], err)
+			}
+		}
+
+		if summary := ErrorCount(errs); summary != "4 errors" {
+			t.Errorf("%s: unexpected summary %q", runner.Name, summary)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package interpreter
 import (
 	"fmt"
 	"strconv"
+	"unicode/utf8"
 )
 
 type Scanner struct {
@@ -13,6 +14,16 @@ type Scanner struct {
 	start   int
 	current int
 	line    int
+
+	// offset is the byte offset of current and lineStart the index of the
+	// first character of the current line.
+	offset    int
+	lineStart int
+
+	// Position of the token being scanned.
+	startLine   int
+	startColumn int
+	startOffset int
 }
 
 func NewScanner(source string) *Scanner {
@@ -35,10 +46,18 @@ func (scanner *Scanner) ScanTokens() []Token {
 
 	for !scanner.isAtEnd() {
 		scanner.start = scanner.current
+		scanner.startLine = scanner.line
+		scanner.startColumn = scanner.current - scanner.lineStart + 1
+		scanner.startOffset = scanner.offset
 		scanner.scanToken()
 	}
 
-	scanner.tokens = append(scanner.tokens, Token{TK_EOF, "", nil, scanner.line})
+	scanner.tokens = append(scanner.tokens, Token{
+		TokenType: TK_EOF,
+		Line:      scanner.line,
+		Column:    scanner.current - scanner.lineStart + 1,
+		Offset:    scanner.offset,
+	})
 	return scanner.tokens
 }
 
@@ -47,7 +66,26 @@ func (scanner *Scanner) isAtEnd() bool {
 }
 
 func (scanner *Scanner) addToken(tokType TokenType, literal interface{}) {
-	scanner.tokens = append(scanner.tokens, NewToken(tokType, string(scanner.source[scanner.start:scanner.current]), literal, scanner.line))
+	scanner.tokens = append(scanner.tokens, Token{
+		TokenType: tokType,
+		Lexeme:    string(scanner.source[scanner.start:scanner.current]),
+		Literal:   literal,
+		Line:      scanner.startLine,
+		Column:    scanner.startColumn,
+		Offset:    scanner.startOffset,
+	})
+}
+
+// error reports an error spanning the token being scanned.
+func (scanner *Scanner) error(message string) {
+	lexeme := string(scanner.source[scanner.start:scanner.current])
+	token := Token{Lexeme: lexeme, Line: scanner.startLine, Column: scanner.startColumn, Offset: scanner.startOffset}
+	scanner.errors = append(scanner.errors, withSpan(NewError(scanner.line, message), token.Span()))
+}
+
+func (scanner *Scanner) newline() {
+	scanner.line++
+	scanner.lineStart = scanner.current
 }
 
 func (scanner *Scanner) scanToken() {
@@ -65,6 +103,12 @@ func (scanner *Scanner) scanToken() {
 	case "}":
 		scanner.addToken(TK_RIGHT_BRACE, nil)
 		break
+	case "[":
+		scanner.addToken(TK_LEFT_BRACKET, nil)
+		break
+	case "]":
+		scanner.addToken(TK_RIGHT_BRACKET, nil)
+		break
 	case ",":
 		scanner.addToken(TK_COMMA, nil)
 		break
@@ -131,7 +175,7 @@ func (scanner *Scanner) scanToken() {
 	case " ", "\r", "\t":
 		break
 	case "\n":
-		scanner.line++
+		scanner.newline()
 		break
 	default:
 		if isDigit(c) {
@@ -139,7 +183,7 @@ func (scanner *Scanner) scanToken() {
 		} else if isAlpha(c) {
 			scanner.identifier()
 		} else {
-			scanner.errors = append(scanner.errors, NewError(scanner.line, fmt.Sprintf("Unexpected character '%s'", c)))
+			scanner.error(fmt.Sprintf("Unexpected character '%s'", c))
 		}
 	}
 }
@@ -175,11 +219,7 @@ func (scanner *Scanner) number() {
 
 	value, err := strconv.ParseFloat(string(scanner.source[scanner.start:scanner.current]), 64)
 	if err != nil {
-		scanner.errors = append(
-			scanner.errors,
-			NewError(
-				scanner.line,
-				fmt.Sprintf("Invalid number '%s'.", string(scanner.source[scanner.start:scanner.current]))))
+		scanner.error(fmt.Sprintf("Invalid number '%s'.", string(scanner.source[scanner.start:scanner.current])))
 	} else {
 		scanner.addToken(TK_NUMBER, value)
 	}
@@ -195,15 +235,13 @@ func (scanner *Scanner) peekNext() string {
 
 func (scanner *Scanner) string() {
 	for scanner.peek() != "\"" && !scanner.isAtEnd() {
-		if scanner.peek() == "\n" {
-			scanner.line++
+		if scanner.advance() == "\n" {
+			scanner.newline()
 		}
-
-		scanner.advance()
 	}
 
 	if scanner.isAtEnd() {
-		scanner.errors = append(scanner.errors, NewError(scanner.line, fmt.Sprintf("Unterminated string '%s'.", string(scanner.source[scanner.start:scanner.current]))))
+		scanner.error(fmt.Sprintf("Unterminated string '%s'.", string(scanner.source[scanner.start:scanner.current])))
 		return
 	}
 
@@ -242,13 +280,14 @@ func (scanner *Scanner) match(expected string) bool {
 		return false
 	}
 
-	scanner.current++
+	scanner.advance()
 	return true
 }
 
 func (scanner *Scanner) advance() string {
 	current := scanner.current
 	scanner.current++
+	scanner.offset += utf8.RuneLen(scanner.source[current])
 
 	return string(scanner.source[current])
 }
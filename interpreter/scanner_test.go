@@ -122,3 +122,32 @@ func TestScanComment(t *testing.T) {
 
 	AssertScansEqual(t, expected, tokens)
 }
+
+func TestScanPositions(t *testing.T) {
+	scanner := NewScanner("var s = \"héllo\";\n  s = \"a\nb\" + s;")
+	expected := []Position{
+		{1, 1, 0}, {1, 5, 4}, {1, 7, 6}, {1, 9, 8}, {1, 16, 16},
+		{2, 3, 20}, {2, 5, 22}, {2, 7, 24}, {3, 4, 30}, {3, 6, 32}, {3, 7, 33},
+		{3, 8, 34},
+	}
+
+	tokens := scanner.ScanTokens()
+	if scanner.HasError() {
+		t.Fatalf("Encountered error: %v", scanner.Errors())
+	}
+
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d", len(expected), len(tokens))
+	}
+
+	for idx, token := range tokens {
+		position := Position{token.Line, token.Column, token.Offset}
+		if position != expected[idx] {
+			t.Errorf("Expected token %v at %v, got %v", token, expected[idx], position)
+		}
+	}
+
+	if end := tokens[7].Span().End; end != (Position{3, 3, 29}) {
+		t.Errorf("Expected multi-line string to end at 3:3, got %v", end)
+	}
+}
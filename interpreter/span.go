@@ -0,0 +1,92 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Position is a location in the source. Lines and columns start at 1 and
+// columns count characters; Offset counts bytes from the start of the source.
+type Position struct {
+	Line   int
+	Column int
+	Offset int
+}
+
+// Span is the source text from Start up to, but not including, End.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+func (s Span) IsZero() bool {
+	return s.Start.Line == 0
+}
+
+// Contains reports whether offset falls within the span.
+func (s Span) Contains(offset int) bool {
+	return offset >= s.Start.Offset && offset < s.End.Offset
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%d:%d-%d:%d", s.Start.Line, s.Start.Column, s.End.Line, s.End.Column)
+}
+
+// spanned is implemented by every AST node.
+type spanned interface {
+	SetSpan(span Span)
+}
+
+// Diagnostic renders err the way the CLI reports it: the error, the offending
+// source line with the span underlined, and the stack trace. source is the
+// text of path; errors raised in an imported module are rendered against the
+// text of that module.
+func Diagnostic(source string, path string, err error) string {
+	var loxError *LoxError
+	if !errors.As(err, &loxError) || loxError.span.IsZero() {
+		return err.Error()
+	}
+	if loxError.file != "" && loxError.file != path {
+		if loxError.source == "" {
+			return loxError.header(path) + loxError.traceString()
+		}
+		source = loxError.source
+	}
+
+	lines := strings.Split(source, "\n")
+	span := loxError.span
+	if span.Start.Line > len(lines) {
+		return loxError.header(path) + loxError.traceString()
+	}
+
+	text := strings.TrimRight(lines[span.Start.Line-1], "\r")
+	width := utf8.RuneCountInString(text) - span.Start.Column + 1
+	if span.End.Line == span.Start.Line {
+		width = span.End.Column - span.Start.Column
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	indent := strings.Builder{}
+	for idx, c := range []rune(text) {
+		if idx >= span.Start.Column-1 {
+			break
+		}
+		if c == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+
+	gutter := fmt.Sprint(span.Start.Line)
+	builder := strings.Builder{}
+	builder.WriteString(loxError.header(path))
+	builder.WriteString(fmt.Sprintf("  %s | %s\n", gutter, text))
+	builder.WriteString(fmt.Sprintf("  %s | %s%s\n", strings.Repeat(" ", len(gutter)), indent.String(), strings.Repeat("^", width)))
+	builder.WriteString(loxError.traceString())
+	return builder.String()
+}
@@ -0,0 +1,105 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		program  string
+		expected string
+	}{
+		{
+			"var a = 1;\nprint a +\n\t\"x\" - undefined;",
+			"[line 3] Errorundefined: Undefined variable\n" +
+				"  3 | \t\"x\" - undefined;\n" +
+				"    | \t      ^^^^^^^^^\n",
+		},
+		{
+			"fun f(n) {\n  return n / nil;\n}\nf(1);",
+			"[line 2] Error/: Right operand must be a number.\n" +
+				"  2 |   return n / nil;\n" +
+				"    |            ^\n" +
+				"    at f, called from main.lox:4\n",
+		},
+		{
+			"var s = \"é\" + #;",
+			"[line 1] Error: Unexpected character '#'\n" +
+				"  1 | var s = \"é\" + #;\n" +
+				"    |               ^\n",
+		},
+		{
+			"print (1 + 2;",
+			"[line 1] Error at ';': Expect ')' after expression.\n" +
+				"  1 | print (1 + 2;\n" +
+				"    |             ^\n",
+		},
+	}
+
+	for _, runner := range ProgramRunners {
+		for _, test := range tests {
+			errs := runner.Run(InterpreterConfig{ScriptPath: "main.lox"}, test.program)
+			if len(errs) != 1 {
+				t.Errorf("%s: expected 1 error, got %v", runner.Name, errs)
+				continue
+			}
+
+			if actual := Diagnostic(test.program, "main.lox", errs[0]); actual != test.expected {
+				t.Errorf("%s: expected diagnostic\n%s\ngot\n%s", runner.Name, test.expected, actual)
+			}
+		}
+	}
+}
+
+func TestDiagnosticOtherFile(t *testing.T) {
+	tests := []struct {
+		files    map[string]string
+		expected string
+	}{
+		{
+			map[string]string{
+				"main.lox": "import \"lib.lox\" as lib;\nlib.f();",
+				"lib.lox":  "fun f() { return -\"x\"; }",
+			},
+			"[line 1] Error-: Operand must be a number.\n" +
+				"    in lib.lox:1\n" +
+				"  1 | fun f() { return -\"x\"; }\n" +
+				"    |                  ^\n" +
+				"    at f, called from main.lox:2\n",
+		},
+		{
+			map[string]string{
+				"main.lox": "print 1;\nimport \"lib.lox\" as lib;",
+				"lib.lox":  "var a = 1;\nvar b = 0;\nprint a / b;",
+			},
+			"[line 3] Error/: Cannot divide by zero.\n" +
+				"    in lib.lox:3\n" +
+				"  3 | print a / b;\n" +
+				"    |         ^\n",
+		},
+	}
+
+	for _, test := range tests {
+		_, errs := runModuleProgram(test.files, "main.lox")
+		if len(errs) != 1 {
+			t.Errorf("expected 1 error, got %v", errs)
+			continue
+		}
+
+		if !strings.Contains(errs[0].Error(), "in lib.lox:") {
+			t.Errorf("expected the error to name the module, got\n%s", errs[0].Error())
+		}
+
+		if actual := Diagnostic(test.files["main.lox"], "main.lox", errs[0]); actual != test.expected {
+			t.Errorf("expected diagnostic\n%s\ngot\n%s", test.expected, actual)
+		}
+
+		// Rendered against the module itself, the location is left out.
+		lines := strings.SplitAfter(test.expected, "\n")
+		expected := lines[0] + strings.Join(lines[2:], "")
+		if actual := Diagnostic(test.files["lib.lox"], "lib.lox", errs[0]); actual != expected {
+			t.Errorf("expected diagnostic\n%s\ngot\n%s", expected, actual)
+		}
+	}
+}
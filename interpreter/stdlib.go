@@ -0,0 +1,238 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TypeNamer lets values defined outside this package report their type to
+// the type() native.
+type TypeNamer interface {
+	TypeName() string
+}
+
+// NewNativeModule creates a module whose properties are the given members.
+func NewNativeModule(name string, members map[string]interface{}) *Module {
+	environment := NewEnvironment()
+	for key, value := range members {
+		environment.Define(key, value)
+	}
+
+	return &Module{path: name, environment: environment}
+}
+
+// StandardLibrary returns the globals every program starts with, besides
+// clock.
+func StandardLibrary() map[string]interface{} {
+	return map[string]interface{}{
+		"type":   TypeFunc,
+		"str":    StrFunc,
+		"num":    NumFunc,
+		"string": StringModule,
+		"math":   MathModule,
+	}
+}
+
+func TypeOf(value interface{}) string {
+	switch value := value.(type) {
+	case TypeNamer:
+		return value.TypeName()
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *LoxList:
+		return "list"
+	case *LoxMap:
+		return "map"
+	case *Module:
+		return "module"
+	case *ErrorObject:
+		return "error"
+	case *Klass:
+		return "class"
+	case *KlassInstance:
+		return "instance"
+	case Callable:
+		return "function"
+	}
+
+	return "unknown"
+}
+
+var TypeFunc = NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+	return TypeOf(arguments[0])
+})
+
+var StrFunc = NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+	str, err := i.stringify(arguments[0], i.callSite)
+	if err != nil {
+		return err
+	}
+	return str
+})
+
+var NumFunc = NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+	switch value := arguments[0].(type) {
+	case float64:
+		return value
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return NewNativeError(E_UNEXPECTED_TYPE, fmt.Sprintf("Cannot convert '%s' to a number", value))
+		}
+		return number
+	}
+
+	return NewNativeError(E_UNEXPECTED_TYPE, "Only strings and numbers can be converted to a number")
+})
+
+func stringArgument(arguments []interface{}, idx int) (string, error) {
+	s, ok := arguments[idx].(string)
+	if !ok {
+		return "", NewNativeError(E_UNEXPECTED_TYPE, fmt.Sprintf("Argument %d must be a string", idx+1))
+	}
+	return s, nil
+}
+
+func numberArgument(arguments []interface{}, idx int) (float64, error) {
+	number, ok := arguments[idx].(float64)
+	if !ok {
+		return 0, NewNativeError(E_UNEXPECTED_TYPE, fmt.Sprintf("Argument %d must be a number", idx+1))
+	}
+	return number, nil
+}
+
+// stringFunc adapts a function of string arguments to a native callable.
+func stringFunc(arity int, f func(arguments []string) interface{}) Callable {
+	return NewNativeCallable(arity, func(i *Interpreter, arguments []interface{}) interface{} {
+		strs := make([]string, arity)
+		for idx := range arguments {
+			s, err := stringArgument(arguments, idx)
+			if err != nil {
+				return err
+			}
+			strs[idx] = s
+		}
+		return f(strs)
+	})
+}
+
+// mathFunc adapts a function of number arguments to a native callable.
+func mathFunc(arity int, f func(arguments []float64) interface{}) Callable {
+	return NewNativeCallable(arity, func(i *Interpreter, arguments []interface{}) interface{} {
+		numbers := make([]float64, arity)
+		for idx := range arguments {
+			number, err := numberArgument(arguments, idx)
+			if err != nil {
+				return err
+			}
+			numbers[idx] = number
+		}
+		return f(numbers)
+	})
+}
+
+// String positions are counted in characters rather than bytes.
+var StringModule = NewNativeModule("string", map[string]interface{}{
+	"len": stringFunc(1, func(arguments []string) interface{} {
+		return float64(utf8.RuneCountInString(arguments[0]))
+	}),
+	"substr": NewNativeCallable(3, func(i *Interpreter, arguments []interface{}) interface{} {
+		s, err := stringArgument(arguments, 0)
+		if err != nil {
+			return err
+		}
+
+		start, ok := toInteger(arguments[1])
+		if !ok {
+			return NewNativeError(E_UNEXPECTED_TYPE, "Substring start must be an integer")
+		}
+
+		length, ok := toInteger(arguments[2])
+		if !ok {
+			return NewNativeError(E_UNEXPECTED_TYPE, "Substring length must be an integer")
+		}
+
+		runes := []rune(s)
+		if start < 0 || length < 0 || start > len(runes) || length > len(runes)-start {
+			return NewNativeError(E_INDEX_OUT_OF_RANGE, "Substring out of range")
+		}
+
+		return string(runes[start : start+length])
+	}),
+	"indexOf": stringFunc(2, func(arguments []string) interface{} {
+		idx := strings.Index(arguments[0], arguments[1])
+		if idx < 0 {
+			return float64(-1)
+		}
+		return float64(utf8.RuneCountInString(arguments[0][:idx]))
+	}),
+	"upper": stringFunc(1, func(arguments []string) interface{} {
+		return strings.ToUpper(arguments[0])
+	}),
+	"lower": stringFunc(1, func(arguments []string) interface{} {
+		return strings.ToLower(arguments[0])
+	}),
+	"split": stringFunc(2, func(arguments []string) interface{} {
+		parts := strings.Split(arguments[0], arguments[1])
+		elements := make([]interface{}, len(parts))
+		for idx, part := range parts {
+			elements[idx] = part
+		}
+		return NewList(elements)
+	}),
+	"trim": stringFunc(1, func(arguments []string) interface{} {
+		return strings.TrimSpace(arguments[0])
+	}),
+})
+
+// random returns the interpreter's random source, seeded from the time unless
+// math.seed was called.
+func (i *Interpreter) random() *rand.Rand {
+	if i.shared.rand == nil {
+		i.shared.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return i.shared.rand
+}
+
+var MathModule = NewNativeModule("math", map[string]interface{}{
+	"floor": mathFunc(1, func(arguments []float64) interface{} {
+		return math.Floor(arguments[0])
+	}),
+	"sqrt": mathFunc(1, func(arguments []float64) interface{} {
+		return math.Sqrt(arguments[0])
+	}),
+	"pow": mathFunc(2, func(arguments []float64) interface{} {
+		return math.Pow(arguments[0], arguments[1])
+	}),
+	"abs": mathFunc(1, func(arguments []float64) interface{} {
+		return math.Abs(arguments[0])
+	}),
+	"min": mathFunc(2, func(arguments []float64) interface{} {
+		return math.Min(arguments[0], arguments[1])
+	}),
+	"max": mathFunc(2, func(arguments []float64) interface{} {
+		return math.Max(arguments[0], arguments[1])
+	}),
+	"random": NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+		return i.random().Float64()
+	}),
+	"seed": NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+		seed, ok := toInteger(arguments[0])
+		if !ok {
+			return NewNativeError(E_UNEXPECTED_TYPE, "Seed must be an integer")
+		}
+		i.shared.rand = rand.New(rand.NewSource(int64(seed)))
+		return nil
+	}),
+})
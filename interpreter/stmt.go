@@ -2,6 +2,7 @@ package interpreter
 
 type Stmt interface {
   Accept(visitor StmtVisitor) interface{}
+  Span() Span
 }
 
 type StmtVisitor interface {
@@ -14,10 +15,17 @@ type StmtVisitor interface {
   VisitClassStmt(expr *ClassStmt) interface{}
   VisitBlockStmt(expr *BlockStmt) interface{}
   VisitReturnStmt(expr *ReturnStmt) interface{}
+  VisitYieldStmt(expr *YieldStmt) interface{}
+  VisitBreakStmt(expr *BreakStmt) interface{}
+  VisitContinueStmt(expr *ContinueStmt) interface{}
+  VisitThrowStmt(expr *ThrowStmt) interface{}
+  VisitImportStmt(expr *ImportStmt) interface{}
+  VisitTryStmt(expr *TryStmt) interface{}
 }
 
 type IfStmt struct {
   Expr
+  span Span
   Condition Expr
   ThenBranch Stmt
   ElseBranch Stmt
@@ -27,18 +35,37 @@ func (e *IfStmt) Accept(visitor StmtVisitor) interface{} {
   return visitor.VisitIfStmt(e)
 }
 
+func (e *IfStmt) Span() Span {
+  return e.span
+}
+
+func (e *IfStmt) SetSpan(span Span) {
+  e.span = span
+}
+
 type WhileStmt struct {
   Expr
+  span Span
   Condition Expr
   Body Stmt
+  Increment Expr
 }
 
 func (e *WhileStmt) Accept(visitor StmtVisitor) interface{} {
   return visitor.VisitWhileStmt(e)
 }
 
+func (e *WhileStmt) Span() Span {
+  return e.span
+}
+
+func (e *WhileStmt) SetSpan(span Span) {
+  e.span = span
+}
+
 type ExprStmt struct {
   Expr
+  span Span
   Expression Expr
 }
 
@@ -46,8 +73,18 @@ func (e *ExprStmt) Accept(visitor StmtVisitor) interface{} {
   return visitor.VisitExprStmt(e)
 }
 
+func (e *ExprStmt) Span() Span {
+  return e.span
+}
+
+func (e *ExprStmt) SetSpan(span Span) {
+  e.span = span
+}
+
 type PrintStmt struct {
   Expr
+  span Span
+  Keyword Token
   Expression Expr
 }
 
@@ -55,8 +92,17 @@ func (e *PrintStmt) Accept(visitor StmtVisitor) interface{} {
   return visitor.VisitPrintStmt(e)
 }
 
+func (e *PrintStmt) Span() Span {
+  return e.span
+}
+
+func (e *PrintStmt) SetSpan(span Span) {
+  e.span = span
+}
+
 type VarStmt struct {
   Expr
+  span Span
   Name Token
   Initializer Expr
 }
@@ -65,30 +111,63 @@ func (e *VarStmt) Accept(visitor StmtVisitor) interface{} {
   return visitor.VisitVarStmt(e)
 }
 
+func (e *VarStmt) Span() Span {
+  return e.span
+}
+
+func (e *VarStmt) SetSpan(span Span) {
+  e.span = span
+}
+
 type FunctionStmt struct {
   Expr
+  span Span
   Name Token
   Params []Token
   Body []Stmt
+  IsAsync bool
+  IsGenerator bool
+  IsGetter bool
 }
 
 func (e *FunctionStmt) Accept(visitor StmtVisitor) interface{} {
   return visitor.VisitFunctionStmt(e)
 }
 
+func (e *FunctionStmt) Span() Span {
+  return e.span
+}
+
+func (e *FunctionStmt) SetSpan(span Span) {
+  e.span = span
+}
+
 type ClassStmt struct {
   Expr
+  span Span
   Name Token
   SuperClass *Variable
+  Fields []*VarStmt
   Methods []*FunctionStmt
+  ClassMethods []*FunctionStmt
+  ClassFields []*VarStmt
 }
 
 func (e *ClassStmt) Accept(visitor StmtVisitor) interface{} {
   return visitor.VisitClassStmt(e)
 }
 
+func (e *ClassStmt) Span() Span {
+  return e.span
+}
+
+func (e *ClassStmt) SetSpan(span Span) {
+  e.span = span
+}
+
 type BlockStmt struct {
   Expr
+  span Span
   Statements []Stmt
 }
 
@@ -96,8 +175,17 @@ func (e *BlockStmt) Accept(visitor StmtVisitor) interface{} {
   return visitor.VisitBlockStmt(e)
 }
 
+func (e *BlockStmt) Span() Span {
+  return e.span
+}
+
+func (e *BlockStmt) SetSpan(span Span) {
+  e.span = span
+}
+
 type ReturnStmt struct {
   Expr
+  span Span
   Keyword Token
   Expression Expr
 }
@@ -106,4 +194,128 @@ func (e *ReturnStmt) Accept(visitor StmtVisitor) interface{} {
   return visitor.VisitReturnStmt(e)
 }
 
+func (e *ReturnStmt) Span() Span {
+  return e.span
+}
+
+func (e *ReturnStmt) SetSpan(span Span) {
+  e.span = span
+}
+
+type YieldStmt struct {
+  Expr
+  span Span
+  Keyword Token
+  Expression Expr
+}
+
+func (e *YieldStmt) Accept(visitor StmtVisitor) interface{} {
+  return visitor.VisitYieldStmt(e)
+}
+
+func (e *YieldStmt) Span() Span {
+  return e.span
+}
+
+func (e *YieldStmt) SetSpan(span Span) {
+  e.span = span
+}
+
+type BreakStmt struct {
+  Expr
+  span Span
+  Keyword Token
+}
+
+func (e *BreakStmt) Accept(visitor StmtVisitor) interface{} {
+  return visitor.VisitBreakStmt(e)
+}
+
+func (e *BreakStmt) Span() Span {
+  return e.span
+}
+
+func (e *BreakStmt) SetSpan(span Span) {
+  e.span = span
+}
+
+type ContinueStmt struct {
+  Expr
+  span Span
+  Keyword Token
+}
+
+func (e *ContinueStmt) Accept(visitor StmtVisitor) interface{} {
+  return visitor.VisitContinueStmt(e)
+}
+
+func (e *ContinueStmt) Span() Span {
+  return e.span
+}
+
+func (e *ContinueStmt) SetSpan(span Span) {
+  e.span = span
+}
+
+type ThrowStmt struct {
+  Expr
+  span Span
+  Keyword Token
+  Expression Expr
+}
+
+func (e *ThrowStmt) Accept(visitor StmtVisitor) interface{} {
+  return visitor.VisitThrowStmt(e)
+}
+
+func (e *ThrowStmt) Span() Span {
+  return e.span
+}
+
+func (e *ThrowStmt) SetSpan(span Span) {
+  e.span = span
+}
+
+type ImportStmt struct {
+  Expr
+  span Span
+  Keyword Token
+  Path Token
+  Name Token
+}
+
+func (e *ImportStmt) Accept(visitor StmtVisitor) interface{} {
+  return visitor.VisitImportStmt(e)
+}
+
+func (e *ImportStmt) Span() Span {
+  return e.span
+}
+
+func (e *ImportStmt) SetSpan(span Span) {
+  e.span = span
+}
+
+type TryStmt struct {
+  Expr
+  span Span
+  Keyword Token
+  Body *BlockStmt
+  CatchName Token
+  CatchBody *BlockStmt
+  FinallyBody *BlockStmt
+}
+
+func (e *TryStmt) Accept(visitor StmtVisitor) interface{} {
+  return visitor.VisitTryStmt(e)
+}
+
+func (e *TryStmt) Span() Span {
+  return e.span
+}
+
+func (e *TryStmt) SetSpan(span Span) {
+  e.span = span
+}
+
 
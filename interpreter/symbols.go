@@ -0,0 +1,136 @@
+package interpreter
+
+import "sort"
+
+type SymbolKind int32
+
+const (
+	SYMBOL_VARIABLE SymbolKind = iota
+	SYMBOL_PARAMETER
+	SYMBOL_FUNCTION
+	SYMBOL_CLASS
+	SYMBOL_METHOD
+	SYMBOL_MODULE
+	SYMBOL_FIELD
+)
+
+// Symbol is a name declared in a program.
+type Symbol struct {
+	Name Token
+	Kind SymbolKind
+	// Declaration is the statement that declares the symbol. It is nil for
+	// parameters and caught errors.
+	Declaration Stmt
+	// Parent is the function or class the symbol is declared in.
+	Parent *Symbol
+	// Depth is the number of scopes enclosing the declaration, 0 for globals.
+	Depth int
+}
+
+// Span covers the whole declaration of the symbol.
+func (s *Symbol) Span() Span {
+	if s.Declaration != nil {
+		return s.Declaration.Span()
+	}
+	return s.Name.Span()
+}
+
+// Reference is a use of a name. Symbol is nil when the name is not declared
+// in the program, as for natives.
+type Reference struct {
+	Name   Token
+	Symbol *Symbol
+}
+
+// SymbolIndex records the declarations a resolver sees and the references to
+// them, for editor tooling.
+type SymbolIndex struct {
+	Symbols    []*Symbol
+	References []Reference
+
+	// Globals may be referenced before they are declared, those references
+	// are bound once the declaration is seen.
+	globals map[string]*Symbol
+	pending map[string][]int
+}
+
+// At returns the symbol declared or referenced at offset.
+func (index *SymbolIndex) At(offset int) (*Symbol, bool) {
+	for _, symbol := range index.Symbols {
+		if touches(symbol.Name.Span(), offset) {
+			return symbol, true
+		}
+	}
+
+	for _, reference := range index.References {
+		if reference.Symbol != nil && touches(reference.Name.Span(), offset) {
+			return reference.Symbol, true
+		}
+	}
+
+	return nil, false
+}
+
+// ReferenceAt returns the reference at offset, even if it is to a name that is
+// not declared in the program.
+func (index *SymbolIndex) ReferenceAt(offset int) (Reference, bool) {
+	for _, reference := range index.References {
+		if touches(reference.Name.Span(), offset) {
+			return reference, true
+		}
+	}
+	return Reference{}, false
+}
+
+// ReferencesTo lists the uses of symbol in source order, excluding its
+// declaration.
+func (index *SymbolIndex) ReferencesTo(symbol *Symbol) []Token {
+	tokens := make([]Token, 0)
+	for _, reference := range index.References {
+		if reference.Symbol == symbol {
+			tokens = append(tokens, reference.Name)
+		}
+	}
+
+	// Assignments resolve their value before their name.
+	sort.Slice(tokens, func(a, b int) bool {
+		return tokens[a].Offset < tokens[b].Offset
+	})
+	return tokens
+}
+
+// touches reports whether offset is within span or right after it, where an
+// editor's cursor sits after typing a name.
+func touches(span Span, offset int) bool {
+	return offset >= span.Start.Offset && offset <= span.End.Offset
+}
+
+func (index *SymbolIndex) declare(symbol *Symbol) {
+	index.Symbols = append(index.Symbols, symbol)
+	if symbol.Depth > 0 || symbol.Kind == SYMBOL_METHOD || symbol.Kind == SYMBOL_FIELD {
+		return
+	}
+
+	name := symbol.Name.Lexeme
+	if _, ok := index.globals[name]; ok {
+		return
+	}
+
+	index.globals[name] = symbol
+	for _, idx := range index.pending[name] {
+		index.References[idx].Symbol = symbol
+	}
+	delete(index.pending, name)
+}
+
+func (index *SymbolIndex) reference(name Token, symbol *Symbol) {
+	if symbol == nil {
+		symbol = index.globals[name.Lexeme]
+	}
+
+	if symbol == nil {
+		index.pending[name.Lexeme] = append(index.pending[name.Lexeme], len(index.References))
+	}
+
+	index.References = append(index.References, Reference{Name: name, Symbol: symbol})
+}
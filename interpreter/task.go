@@ -0,0 +1,287 @@
+package interpreter
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// shared is the state an interpreter shares with the tasks it spawns. Tasks
+// run on their own goroutines, but only the one holding lock runs Lox code;
+// it is released while a task blocks on a channel, waits for another task or
+// the event loop, or calls a Go function registered with RegisterFunc.
+// Everything but globals, which never changes, is only used with lock held.
+type shared struct {
+	lock    sync.Mutex
+	globals *Environment
+	tasks   []*Task
+	loop    *eventLoop
+	steps   int
+	memory  MemoryStats
+	rand    *rand.Rand
+	// generators are those started and not finished yet.
+	generators map[*Generator]struct{}
+	// running counts the runs the host has entered and not yet left.
+	running int
+	// host holds the globals defined with RegisterFunc and RegisterType,
+	// which imported modules see too.
+	host map[string]interface{}
+}
+
+// fork returns the state of a new task, which starts with an empty callstack
+// in the global scope of the script and shares everything else with i. The
+// calls in progress in i count towards its call depth. An attached debugger
+// only follows the main task.
+func (i *Interpreter) fork() *Interpreter {
+	return &Interpreter{
+		config:            i.config,
+		globalEnvironment: i.shared.globals,
+		environment:       i.shared.globals,
+		callstack:         make([]Activation, 0),
+		depth:             i.depth + len(i.callstack),
+		locals:            i.locals,
+		modulePath:        i.config.ScriptPath,
+		modules:           i.modules,
+		files:             i.files,
+		sources:           i.sources,
+		limited:           i.limited,
+		types:             i.types,
+		shared:            i.shared,
+	}
+}
+
+func (i *Interpreter) lock() {
+	i.shared.lock.Lock()
+	i.locked = true
+}
+
+func (i *Interpreter) unlock() {
+	i.locked = false
+	i.shared.lock.Unlock()
+}
+
+// unlocked calls wait, which blocks, with the lock released so that other
+// tasks run in the meantime.
+func (i *Interpreter) unlocked(wait func()) {
+	if !i.locked {
+		wait()
+		return
+	}
+
+	i.unlock()
+	defer i.lock()
+	wait()
+}
+
+// cancelled is closed once the program is cancelled through its context.
+func (i *Interpreter) cancelled() <-chan struct{} {
+	if i.config.Context == nil {
+		return nil
+	}
+	return i.config.Context.Done()
+}
+
+func (i *Interpreter) cancelledError() error {
+	return NewNativeError(E_CANCELLED, fmt.Sprintf("Cancelled: %v", i.config.Context.Err()))
+}
+
+// finish runs the event loop and waits for the tasks spawned once the host's
+// code is done, returning the first error it leaves unhandled.
+func (i *Interpreter) finish() error {
+	loopErr := i.runLoop()
+	if err := i.waitForTasks(); err != nil && loopErr == nil {
+		return err
+	}
+	return loopErr
+}
+
+// waitForTasks waits for every task spawned so far, including those spawned
+// while waiting, and returns the error of the first one that failed without
+// being joined.
+func (i *Interpreter) waitForTasks() error {
+	var err error
+	for len(i.shared.tasks) > 0 {
+		task := i.shared.tasks[0]
+		i.shared.tasks = i.shared.tasks[1:]
+
+		i.unlocked(func() { <-task.done })
+		if task.err != nil && !task.joined && err == nil {
+			err = task.err
+		}
+	}
+	return err
+}
+
+// Task is a function running concurrently with the code that spawned it.
+type Task struct {
+	name   string
+	done   chan struct{}
+	value  interface{}
+	err    error
+	joined bool
+}
+
+// spawn calls callable on a new task.
+func (i *Interpreter) spawn(callable Callable) *Task {
+	task := &Task{name: callable.String(), done: make(chan struct{})}
+	i.shared.tasks = append(i.shared.tasks, task)
+
+	state := i.fork()
+	state.callSite = i.callSite
+	go func() {
+		defer close(task.done)
+		state.lock()
+		defer state.unlock()
+
+		value := callable.Call(state, []interface{}{})
+		if err, ok := value.(error); ok {
+			task.err = AtToken(err, state.callSite)
+		} else {
+			task.value = value
+		}
+	}()
+	return task
+}
+
+func (t *Task) TypeName() string {
+	return "task"
+}
+
+func (t *Task) String() string {
+	return fmt.Sprintf("<task %s>", t.name)
+}
+
+func (t *Task) Get(property string) (interface{}, bool) {
+	switch property {
+	case "join":
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			var cancelled bool
+			i.unlocked(func() {
+				select {
+				case <-t.done:
+				case <-i.cancelled():
+					cancelled = true
+				}
+			})
+			if cancelled {
+				return i.cancelledError()
+			}
+
+			t.joined = true
+			if t.err != nil {
+				return t.err
+			}
+			return t.value
+		}), true
+	case "done":
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			select {
+			case <-t.done:
+				return true
+			default:
+				return false
+			}
+		}), true
+	}
+
+	return nil, false
+}
+
+var SpawnFunc = NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+	callable, ok := arguments[0].(Callable)
+	if !ok || callable.Arity() != 0 {
+		return NewNativeError(E_INVALID_ARGUMENTS, "Can only spawn a function without parameters")
+	}
+	return i.spawn(callable)
+})
+
+// Channel passes values between tasks. It holds up to its capacity of values
+// before send blocks.
+type Channel struct {
+	values chan interface{}
+}
+
+func NewChannel(capacity int) *Channel {
+	return &Channel{values: make(chan interface{}, capacity)}
+}
+
+func (c *Channel) TypeName() string {
+	return "channel"
+}
+
+func (c *Channel) String() string {
+	return "<channel>"
+}
+
+// send blocks until value is sent, failing if the channel is closed.
+func (c *Channel) send(i *Interpreter, value interface{}) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = NewNativeError(E_CHANNEL_CLOSED, "Cannot send on a closed channel")
+		}
+	}()
+
+	i.unlocked(func() {
+		select {
+		case c.values <- value:
+		case <-i.cancelled():
+			err = i.cancelledError()
+		}
+	})
+	return err
+}
+
+func (c *Channel) Get(property string) (interface{}, bool) {
+	switch property {
+	case "send":
+		return NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+			return c.send(i, arguments[0])
+		}), true
+	case "recv":
+		// recv returns nil once the channel is closed and empty.
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) interface{} {
+			var value interface{}
+			var err error
+			i.unlocked(func() {
+				select {
+				case value = <-c.values:
+				case <-i.cancelled():
+					err = i.cancelledError()
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return value
+		}), true
+	case "close":
+		return NewNativeCallable(0, func(i *Interpreter, arguments []interface{}) (err interface{}) {
+			defer func() {
+				if recover() != nil {
+					err = NewNativeError(E_CHANNEL_CLOSED, "Channel is already closed")
+				}
+			}()
+			close(c.values)
+			return nil
+		}), true
+	}
+
+	return nil, false
+}
+
+// maxChannelCapacity bounds the values a channel created by a program can
+// hold, as its buffer is allocated up front.
+const maxChannelCapacity = 1 << 16
+
+var ChannelFunc = NewNativeCallable(1, func(i *Interpreter, arguments []interface{}) interface{} {
+	capacity, ok := toInteger(arguments[0])
+	if !ok || capacity < 0 || capacity > maxChannelCapacity {
+		return NewNativeError(E_INVALID_ARGUMENTS, fmt.Sprintf("Channel capacity must be an integer from 0 to %d", maxChannelCapacity))
+	}
+
+	i.shared.memory.AddChannel(capacity)
+	if i.shared.memory.Exceeds(i.config.MaxMemory) {
+		return i.memoryError(i.callSite.Span())
+	}
+	return NewChannel(capacity)
+})
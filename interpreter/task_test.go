@@ -0,0 +1,236 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTasks(t *testing.T) {
+	tests := []struct {
+		name     string
+		program  string
+		expected []string
+	}{
+		{
+			"join",
+			`
+fun add() { return 1 + 2; }
+var task = spawn(add);
+print task;
+print type(task);
+print task.join();
+print task.done();
+`,
+			[]string{"<task add>", "task", "3", "true"},
+		},
+		{
+			"producer and consumer",
+			`
+var ch = channel(0);
+spawn(fun () {
+	for (var i = 0; i < 3; i = i + 1) {
+		ch.send(i);
+	}
+	ch.close();
+});
+var value = ch.recv();
+while (value != nil) {
+	print value;
+	value = ch.recv();
+}
+`,
+			[]string{"0", "1", "2"},
+		},
+		{
+			"fan out",
+			`
+var results = channel(10);
+fun worker(n) {
+	return fun () {
+		var total = 0;
+		for (var i = 1; i <= n; i = i + 1) {
+			total = total + i;
+		}
+		results.send(total);
+	};
+}
+var tasks = [];
+for (var n = 1; n <= 10; n = n + 1) {
+	tasks.push(spawn(worker(n * 10)));
+}
+for (var n = 0; n < tasks.len(); n = n + 1) {
+	tasks[n].join();
+}
+var sum = 0;
+for (var n = 0; n < 10; n = n + 1) {
+	sum = sum + results.recv();
+}
+print sum;
+`,
+			[]string{"19525"},
+		},
+		{
+			"shared state",
+			`
+var count = 0;
+var tasks = [];
+for (var n = 0; n < 8; n = n + 1) {
+	tasks.push(spawn(fun () {
+		for (var i = 0; i < 100; i = i + 1) {
+			count = count + 1;
+		}
+	}));
+}
+for (var n = 0; n < tasks.len(); n = n + 1) {
+	tasks[n].join();
+}
+print count;
+`,
+			[]string{"800"},
+		},
+		{
+			"unjoined tasks finish",
+			`
+spawn(fun () { print "in task"; });
+`,
+			[]string{"in task"},
+		},
+		{
+			"joined errors are caught",
+			`
+var task = spawn(fun () { throw "failed"; });
+try {
+	task.join();
+} catch (e) {
+	print e;
+}
+`,
+			[]string{"failed"},
+		},
+		{
+			"closed channels",
+			`
+var ch = channel(1);
+ch.send(1);
+ch.close();
+print ch.recv();
+print ch.recv();
+try {
+	ch.send(2);
+} catch (e) {
+	print e.type;
+}
+try {
+	ch.close();
+} catch (e) {
+	print e.type;
+}
+`,
+			[]string{"1", "<nil>", "E_CHANNEL_CLOSED", "E_CHANNEL_CLOSED"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := runEmbedded(t, test.program, func(i *Interpreter) error { return nil })
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(output, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestTaskErrors(t *testing.T) {
+	tests := []struct {
+		program   string
+		errorType int32
+	}{
+		{`spawn(1);`, E_INVALID_ARGUMENTS},
+		{`spawn(fun (a) {});`, E_INVALID_ARGUMENTS},
+		{`channel(-1);`, E_INVALID_ARGUMENTS},
+		{`channel(4611686018427387904);`, E_INVALID_ARGUMENTS},
+		{`spawn(fun () { return 1 + nil; });`, E_UNEXPECTED_TYPE},
+	}
+
+	for _, test := range tests {
+		_, err := runEmbedded(t, test.program, func(i *Interpreter) error { return nil })
+		var loxError *LoxError
+		if !errors.As(err, &loxError) || loxError.Type() != test.errorType {
+			t.Errorf("%s: expected %s, got %v", test.program, ErrorTypeNames[test.errorType], err)
+		}
+	}
+}
+
+func TestChannelMemory(t *testing.T) {
+	config := InterpreterConfig{PrintFunc: func(string) {}, MaxMemory: 1 << 20}
+	errs := RunProgram(config, "var channels = []; while (true) channels.push(channel(65536));")
+	var loxError *LoxError
+	if len(errs) != 1 || !errors.As(errs[0], &loxError) || loxError.Type() != E_MEMORY_LIMIT_EXCEEDED {
+		t.Errorf("expected %s, got %v", ErrorTypeNames[E_MEMORY_LIMIT_EXCEEDED], errs)
+	}
+}
+
+func TestTaskCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	i := NewInterpreter(InterpreterConfig{PrintFunc: func(string) {}, Context: ctx})
+	stmts, errs := Compile("var ch = channel(0); spawn(fun () { ch.recv(); }); ch.recv();", NewResolver(i))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	_, err := i.Interpret(stmts)
+	var loxError *LoxError
+	if !errors.As(err, &loxError) || loxError.Type() != E_CANCELLED {
+		t.Errorf("expected the program to be cancelled, got %v", err)
+	}
+}
+
+// TestConcurrentCalls calls into one interpreter from many goroutines while
+// registered Go functions run in parallel, for go test -race to check.
+func TestConcurrentCalls(t *testing.T) {
+	i := NewInterpreter(InterpreterConfig{PrintFunc: func(string) {}})
+	i.RegisterFunc("pause", func() { time.Sleep(time.Millisecond) })
+
+	program := `
+var calls = 0;
+fun handle(n) {
+	calls = calls + 1;
+	pause();
+	var task = spawn(fun () { pause(); return n * 2; });
+	return task.join();
+}
+`
+	stmts, errs := Compile(program, NewResolver(i))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	if _, err := i.Interpret(stmts); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			value, err := i.CallGlobal("handle", n)
+			if err != nil || value != float64(n*2) {
+				t.Errorf("expected %d, got %v, %v", n*2, value, err)
+			}
+		}(n)
+	}
+	wg.Wait()
+
+	if calls, _ := i.Global("calls"); calls != 20.0 {
+		t.Errorf("expected 20 calls, got %v", calls)
+	}
+}
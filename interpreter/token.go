@@ -19,6 +19,8 @@ const (
 	TK_STAR
 	TK_QUESTION
 	TK_COLON
+	TK_LEFT_BRACKET
+	TK_RIGHT_BRACKET
 
 	// One or two character tokens
 	TK_BANG
@@ -52,27 +54,49 @@ const (
 	TK_TRUE
 	TK_VAR
 	TK_WHILE
+	TK_BREAK
+	TK_CONTINUE
+	TK_THROW
+	TK_TRY
+	TK_CATCH
+	TK_FINALLY
+	TK_IMPORT
+	TK_AS
+	TK_ASYNC
+	TK_AWAIT
+	TK_YIELD
 
 	TK_EOF
 )
 
 var TokenTypeKeywords = map[string]TokenType{
-	"and":    TK_AND,
-	"class":  TK_CLASS,
-	"else":   TK_ELSE,
-	"false":  TK_FALSE,
-	"for":    TK_FOR,
-	"fun":    TK_FUN,
-	"if":     TK_IF,
-	"nil":    TK_NIL,
-	"or":     TK_OR,
-	"print":  TK_PRINT,
-	"return": TK_RETURN,
-	"super":  TK_SUPER,
-	"this":   TK_THIS,
-	"true":   TK_TRUE,
-	"var":    TK_VAR,
-	"while":  TK_WHILE,
+	"and":      TK_AND,
+	"class":    TK_CLASS,
+	"else":     TK_ELSE,
+	"false":    TK_FALSE,
+	"for":      TK_FOR,
+	"fun":      TK_FUN,
+	"if":       TK_IF,
+	"nil":      TK_NIL,
+	"or":       TK_OR,
+	"print":    TK_PRINT,
+	"return":   TK_RETURN,
+	"super":    TK_SUPER,
+	"this":     TK_THIS,
+	"true":     TK_TRUE,
+	"var":      TK_VAR,
+	"while":    TK_WHILE,
+	"break":    TK_BREAK,
+	"continue": TK_CONTINUE,
+	"throw":    TK_THROW,
+	"try":      TK_TRY,
+	"catch":    TK_CATCH,
+	"finally":  TK_FINALLY,
+	"import":   TK_IMPORT,
+	"as":       TK_AS,
+	"async":    TK_ASYNC,
+	"await":    TK_AWAIT,
+	"yield":    TK_YIELD,
 }
 
 var TokenTypeNames = map[TokenType]string{
@@ -114,9 +138,22 @@ var TokenTypeNames = map[TokenType]string{
 	TK_TRUE:          "TK_TRUE",
 	TK_VAR:           "TK_VAR",
 	TK_WHILE:         "TK_WHILE",
+	TK_BREAK:         "TK_BREAK",
+	TK_CONTINUE:      "TK_CONTINUE",
+	TK_THROW:         "TK_THROW",
+	TK_TRY:           "TK_TRY",
+	TK_CATCH:         "TK_CATCH",
+	TK_FINALLY:       "TK_FINALLY",
+	TK_IMPORT:        "TK_IMPORT",
+	TK_AS:            "TK_AS",
+	TK_ASYNC:         "TK_ASYNC",
+	TK_AWAIT:         "TK_AWAIT",
+	TK_YIELD:         "TK_YIELD",
 	TK_EOF:           "TK_EOF",
 	TK_QUESTION:      "TK_QUESTION",
 	TK_COLON:         "TK_COLON",
+	TK_LEFT_BRACKET:  "TK_LEFT_BRACKET",
+	TK_RIGHT_BRACKET: "TK_RIGHT_BRACKET",
 }
 
 type Token struct {
@@ -124,10 +161,30 @@ type Token struct {
 	Lexeme    string
 	Literal   interface{}
 	Line      int
+	// Column is the 1-based column, counted in characters, of the first
+	// character of the token. Offset is its byte offset in the source.
+	Column int
+	Offset int
 }
 
 func NewToken(tokenType TokenType, lexeme string, literal interface{}, line int) Token {
-	return Token{tokenType, lexeme, literal, line}
+	return Token{TokenType: tokenType, Lexeme: lexeme, Literal: literal, Line: line}
+}
+
+// Span covers the source text of the token.
+func (token Token) Span() Span {
+	start := Position{Line: token.Line, Column: token.Column, Offset: token.Offset}
+	end := start
+	end.Offset += len(token.Lexeme)
+	for _, c := range token.Lexeme {
+		if c == '\n' {
+			end.Line++
+			end.Column = 1
+		} else {
+			end.Column++
+		}
+	}
+	return Span{Start: start, End: end}
 }
 
 func (token Token) String() string {
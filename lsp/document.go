@@ -0,0 +1,245 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/cgrunewald/golox/interpreter"
+)
+
+// document is an open text document and what the scanner, parser and
+// resolver found in it.
+type document struct {
+	uri     string
+	version int
+	text    string
+	// lines holds the byte offset each line starts at.
+	lines []int
+
+	index  *interpreter.SymbolIndex
+	errors []error
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{uri: uri, version: version, text: text, lines: []int{0}}
+	for idx, c := range text {
+		if c == '\n' {
+			d.lines = append(d.lines, idx+1)
+		}
+	}
+
+	resolver := interpreter.NewResolver(nil)
+	d.index = resolver.IndexSymbols()
+	_, d.errors = interpreter.Compile(text, resolver)
+	return d
+}
+
+// position converts an offset in the text to a protocol position.
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+
+	line := 0
+	for line+1 < len(d.lines) && d.lines[line+1] <= offset {
+		line++
+	}
+
+	character := 0
+	for _, c := range d.text[d.lines[line]:offset] {
+		character += utf16.RuneLen(c)
+	}
+	return Position{Line: line, Character: character}
+}
+
+// offset converts a protocol position to an offset in the text. Positions
+// past the end of a line are clamped to it.
+func (d *document) offset(position Position) int {
+	if position.Line < 0 {
+		return 0
+	}
+	if position.Line >= len(d.lines) {
+		return len(d.text)
+	}
+
+	offset := d.lines[position.Line]
+	for character := 0; character < position.Character && offset < len(d.text); {
+		c, size := utf8.DecodeRuneInString(d.text[offset:])
+		if c == '\n' {
+			break
+		}
+		character += utf16.RuneLen(c)
+		offset += size
+	}
+	return offset
+}
+
+func (d *document) span(span interpreter.Span) Range {
+	return Range{Start: d.position(span.Start.Offset), End: d.position(span.End.Offset)}
+}
+
+func (d *document) location(span interpreter.Span) Location {
+	return Location{URI: d.uri, Range: d.span(span)}
+}
+
+func (d *document) diagnostics() []Diagnostic {
+	diagnostics := make([]Diagnostic, 0, len(d.errors))
+	for _, err := range d.errors {
+		diagnostic := Diagnostic{Severity: SEVERITY_ERROR, Source: "golox", Message: err.Error()}
+
+		var loxError *interpreter.LoxError
+		if errors.As(err, &loxError) {
+			diagnostic.Message = loxError.Message()
+			if span := loxError.Span(); !span.IsZero() {
+				diagnostic.Range = d.span(span)
+			} else {
+				line := Position{Line: loxError.Line() - 1}
+				diagnostic.Range = Range{Start: line, End: line}
+			}
+		}
+
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
+}
+
+func (d *document) definition(position Position) *Location {
+	symbol, ok := d.index.At(d.offset(position))
+	if !ok {
+		return nil
+	}
+
+	location := d.location(symbol.Name.Span())
+	return &location
+}
+
+func (d *document) references(position Position, includeDeclaration bool) []Location {
+	locations := make([]Location, 0)
+	symbol, ok := d.index.At(d.offset(position))
+	if !ok {
+		return locations
+	}
+
+	if includeDeclaration {
+		locations = append(locations, d.location(symbol.Name.Span()))
+	}
+	for _, name := range d.index.ReferencesTo(symbol) {
+		locations = append(locations, d.location(name.Span()))
+	}
+	return locations
+}
+
+func (d *document) hover(position Position) *Hover {
+	offset := d.offset(position)
+
+	var description string
+	var name interpreter.Token
+	if symbol, ok := d.index.At(offset); ok {
+		description = describe(symbol)
+		name = symbol.Name
+		if reference, ok := d.index.ReferenceAt(offset); ok {
+			name = reference.Name
+		}
+	} else if reference, ok := d.index.ReferenceAt(offset); ok && isNative(reference.Name.Lexeme) {
+		description = fmt.Sprintf("(native) %s", reference.Name.Lexeme)
+		name = reference.Name
+	} else {
+		return nil
+	}
+
+	r := d.span(name.Span())
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```lox\n" + description + "\n```"},
+		Range:    &r,
+	}
+}
+
+func isNative(name string) bool {
+	if name == "clock" {
+		return true
+	}
+	_, ok := interpreter.StandardLibrary()[name]
+	return ok
+}
+
+// describe renders the declaration of symbol the way it reads in source.
+func describe(symbol *interpreter.Symbol) string {
+	switch declaration := symbol.Declaration.(type) {
+	case *interpreter.FunctionStmt:
+		params := make([]string, len(declaration.Params))
+		for idx, param := range declaration.Params {
+			params[idx] = param.Lexeme
+		}
+
+		signature := fmt.Sprintf("%s(%s)", declaration.Name.Lexeme, strings.Join(params, ", "))
+		if symbol.Kind == interpreter.SYMBOL_METHOD {
+			return fmt.Sprintf("(method) %s.%s", symbol.Parent.Name.Lexeme, signature)
+		}
+		return "fun " + signature
+	case *interpreter.ClassStmt:
+		if declaration.SuperClass != nil {
+			return fmt.Sprintf("class %s < %s", declaration.Name.Lexeme, declaration.SuperClass.Name.Lexeme)
+		}
+		return "class " + declaration.Name.Lexeme
+	case *interpreter.VarStmt:
+		if symbol.Kind == interpreter.SYMBOL_FIELD {
+			return fmt.Sprintf("(field) %s.%s", symbol.Parent.Name.Lexeme, declaration.Name.Lexeme)
+		}
+		return "var " + declaration.Name.Lexeme
+	case *interpreter.ImportStmt:
+		return fmt.Sprintf("import %s as %s", declaration.Path.Lexeme, declaration.Name.Lexeme)
+	}
+
+	if symbol.Kind == interpreter.SYMBOL_PARAMETER {
+		return "(parameter) " + symbol.Name.Lexeme
+	}
+	return "(variable) " + symbol.Name.Lexeme
+}
+
+var symbolKinds = map[interpreter.SymbolKind]int{
+	interpreter.SYMBOL_VARIABLE:  SYMBOL_KIND_VARIABLE,
+	interpreter.SYMBOL_PARAMETER: SYMBOL_KIND_VARIABLE,
+	interpreter.SYMBOL_FUNCTION:  SYMBOL_KIND_FUNCTION,
+	interpreter.SYMBOL_CLASS:     SYMBOL_KIND_CLASS,
+	interpreter.SYMBOL_METHOD:    SYMBOL_KIND_METHOD,
+	interpreter.SYMBOL_MODULE:    SYMBOL_KIND_MODULE,
+	interpreter.SYMBOL_FIELD:     SYMBOL_KIND_FIELD,
+}
+
+// symbols outlines the document: its globals, with the fields and methods of
+// each class nested under it.
+func (d *document) symbols() []DocumentSymbol {
+	documentSymbol := func(symbol *interpreter.Symbol) DocumentSymbol {
+		return DocumentSymbol{
+			Name:           symbol.Name.Lexeme,
+			Detail:         describe(symbol),
+			Kind:           symbolKinds[symbol.Kind],
+			Range:          d.span(symbol.Span()),
+			SelectionRange: d.span(symbol.Name.Span()),
+		}
+	}
+
+	symbols := make([]DocumentSymbol, 0)
+	classes := make(map[*interpreter.Symbol]int)
+	for _, symbol := range d.index.Symbols {
+		if symbol.Kind == interpreter.SYMBOL_METHOD || symbol.Kind == interpreter.SYMBOL_FIELD {
+			if idx, ok := classes[symbol.Parent]; ok {
+				symbols[idx].Children = append(symbols[idx].Children, documentSymbol(symbol))
+			}
+			continue
+		}
+
+		if symbol.Depth > 0 {
+			continue
+		}
+
+		if symbol.Kind == interpreter.SYMBOL_CLASS {
+			classes[symbol] = len(symbols)
+		}
+		symbols = append(symbols, documentSymbol(symbol))
+	}
+	return symbols
+}
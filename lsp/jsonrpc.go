@@ -0,0 +1,136 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC error codes used by the server.
+const (
+	E_PARSE_ERROR      = -32700
+	E_INVALID_REQUEST  = -32600
+	E_METHOD_NOT_FOUND = -32601
+	E_INVALID_PARAMS   = -32602
+)
+
+// Message is a JSON-RPC request, response or notification. Requests and
+// responses have an ID, notifications do not.
+type Message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+func (m *Message) IsNotification() bool {
+	return m.ID == nil && m.Method != ""
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// maxContentLength bounds the body of a message read, so a bad header cannot
+// make the reader allocate without limit.
+const maxContentLength = 64 << 20
+
+// Conn reads and writes messages framed with a Content-Length header, as LSP
+// and DAP do. Writes may come from several goroutines.
+type Conn struct {
+	reader *textproto.Reader
+	body   *bufio.Reader
+	writer io.Writer
+	mu     sync.Mutex
+}
+
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	body := bufio.NewReader(r)
+	return &Conn{reader: textproto.NewReader(body), body: body, writer: w}
+}
+
+// ReadRaw reads the body of the next message.
+func (c *Conn) ReadRaw() ([]byte, error) {
+	header, err := c.reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 || length > maxContentLength {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.body, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// WriteRaw writes body as one message.
+func (c *Conn) WriteRaw(body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err := c.writer.Write(body)
+	return err
+}
+
+func (c *Conn) Read() (*Message, error) {
+	body, err := c.ReadRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	message := &Message{}
+	if err := json.Unmarshal(body, message); err != nil {
+		return nil, &ResponseError{Code: E_PARSE_ERROR, Message: err.Error()}
+	}
+	return message, nil
+}
+
+func (c *Conn) Write(message *Message) error {
+	message.JSONRPC = "2.0"
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return c.WriteRaw(body)
+}
+
+// Notify sends a notification.
+func (c *Conn) Notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.Write(&Message{Method: method, Params: raw})
+}
+
+// Reply sends the response to the request with the given ID.
+func (c *Conn) Reply(id *json.RawMessage, result interface{}, err *ResponseError) error {
+	if err != nil {
+		return c.Write(&Message{ID: id, Error: err})
+	}
+
+	raw, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	return c.Write(&Message{ID: id, Result: raw})
+}
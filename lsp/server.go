@@ -0,0 +1,166 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Server is a language server for Lox. It handles one message at a time, so
+// documents are only ever touched by the goroutine running Serve.
+type Server struct {
+	conn      *Conn
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer() *Server {
+	return &Server{documents: make(map[string]*document)}
+}
+
+// Serve answers the messages read from r on w until the client sends exit or
+// closes the connection. Exiting before a shutdown request is an error.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.conn = NewConn(r, w)
+	for {
+		message, err := s.conn.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		var responseError *ResponseError
+		if errors.As(err, &responseError) {
+			id := json.RawMessage("null")
+			s.conn.Reply(&id, nil, responseError)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if message.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("lsp: exit before shutdown")
+			}
+			return nil
+		}
+
+		result, responseError := s.dispatch(message)
+		if message.IsNotification() {
+			continue
+		}
+
+		if err := s.conn.Reply(message.ID, result, responseError); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) dispatch(message *Message) (interface{}, *ResponseError) {
+	switch message.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:       TEXT_DOCUMENT_SYNC_FULL,
+				DefinitionProvider:     true,
+				ReferencesProvider:     true,
+				HoverProvider:          true,
+				DocumentSymbolProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "golox"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		params := DidOpenTextDocumentParams{}
+		if err := decode(message, &params); err != nil {
+			return nil, err
+		}
+		item := params.TextDocument
+		return nil, s.update(newDocument(item.URI, item.Version, item.Text))
+	case "textDocument/didChange":
+		params := DidChangeTextDocumentParams{}
+		if err := decode(message, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return nil, s.update(newDocument(params.TextDocument.URI, params.TextDocument.Version, text))
+	case "textDocument/didClose":
+		params := DidCloseTextDocumentParams{}
+		if err := decode(message, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.publish(PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	case "textDocument/definition":
+		params := TextDocumentPositionParams{}
+		d, err := s.document(message, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.definition(params.Position), nil
+	case "textDocument/references":
+		params := ReferenceParams{}
+		d, err := s.document(message, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.references(params.Position, params.Context.IncludeDeclaration), nil
+	case "textDocument/hover":
+		params := TextDocumentPositionParams{}
+		d, err := s.document(message, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.hover(params.Position), nil
+	case "textDocument/documentSymbol":
+		params := DocumentSymbolParams{}
+		d, err := s.document(message, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return d.symbols(), nil
+	}
+
+	return nil, &ResponseError{Code: E_METHOD_NOT_FOUND, Message: fmt.Sprintf("Unknown method '%s'", message.Method)}
+}
+
+func decode(message *Message, params interface{}) *ResponseError {
+	if err := json.Unmarshal(message.Params, params); err != nil {
+		return &ResponseError{Code: E_INVALID_PARAMS, Message: err.Error()}
+	}
+	return nil
+}
+
+// document decodes the parameters of a request about an open document and
+// returns that document.
+func (s *Server) document(message *Message, params interface{}, identifier *TextDocumentIdentifier) (*document, *ResponseError) {
+	if err := decode(message, params); err != nil {
+		return nil, err
+	}
+
+	d, ok := s.documents[identifier.URI]
+	if !ok {
+		return nil, &ResponseError{Code: E_INVALID_PARAMS, Message: fmt.Sprintf("Document '%s' is not open", identifier.URI)}
+	}
+	return d, nil
+}
+
+// update replaces a document and publishes its diagnostics.
+func (s *Server) update(d *document) *ResponseError {
+	s.documents[d.uri] = d
+	return s.publish(PublishDiagnosticsParams{URI: d.uri, Version: d.version, Diagnostics: d.diagnostics()})
+}
+
+func (s *Server) publish(params PublishDiagnosticsParams) *ResponseError {
+	if err := s.conn.Notify("textDocument/publishDiagnostics", params); err != nil {
+		return &ResponseError{Code: E_INVALID_REQUEST, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient drives a server running in-process over pipes, the way an
+// editor drives it over stdio.
+type testClient struct {
+	t        *testing.T
+	conn     *Conn
+	nextID   int
+	messages chan *Message
+	pending  []*Message
+	done     chan error
+	close    func()
+}
+
+func newTestClient(t *testing.T) *testClient {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	c := &testClient{
+		t:        t,
+		conn:     NewConn(clientReader, clientWriter),
+		messages: make(chan *Message, 16),
+		done:     make(chan error, 1),
+		close: func() {
+			clientWriter.Close()
+			clientReader.Close()
+		},
+	}
+
+	go func() {
+		c.done <- NewServer().Serve(serverReader, serverWriter)
+		serverWriter.Close()
+	}()
+
+	// Reading in the background keeps the server from blocking on its
+	// notifications while the client is writing.
+	go func() {
+		defer close(c.messages)
+		for {
+			message, err := c.conn.Read()
+			if err != nil {
+				return
+			}
+			c.messages <- message
+		}
+	}()
+
+	return c
+}
+
+func (c *testClient) next() *Message {
+	select {
+	case message, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("connection closed")
+		}
+		return message
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("timed out waiting for the server")
+	}
+	return nil
+}
+
+// call sends a request and decodes the result of its response into result.
+func (c *testClient) call(method string, params interface{}, result interface{}) *ResponseError {
+	c.nextID++
+	id := json.RawMessage(strings.TrimSpace(string(mustMarshal(c.t, c.nextID))))
+	if err := c.conn.Write(&Message{ID: &id, Method: method, Params: mustMarshal(c.t, params)}); err != nil {
+		c.t.Fatalf("write failed: %v", err)
+	}
+
+	for {
+		message := c.next()
+		if message.ID == nil || string(*message.ID) != string(id) {
+			c.pending = append(c.pending, message)
+			continue
+		}
+
+		if message.Error != nil {
+			return message.Error
+		}
+
+		if result != nil {
+			if err := json.Unmarshal(message.Result, result); err != nil {
+				c.t.Fatalf("could not decode result %s: %v", message.Result, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (c *testClient) notify(method string, params interface{}) {
+	if err := c.conn.Notify(method, params); err != nil {
+		c.t.Fatalf("write failed: %v", err)
+	}
+}
+
+// diagnostics waits for the next diagnostics published for uri.
+func (c *testClient) diagnostics(uri string) PublishDiagnosticsParams {
+	for {
+		var message *Message
+		if len(c.pending) > 0 {
+			message, c.pending = c.pending[0], c.pending[1:]
+		} else {
+			message = c.next()
+		}
+
+		params := PublishDiagnosticsParams{}
+		if message.Method == "textDocument/publishDiagnostics" {
+			json.Unmarshal(message.Params, &params)
+			if params.URI == uri {
+				return params
+			}
+		}
+	}
+}
+
+func (c *testClient) open(uri string, text string) PublishDiagnosticsParams {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, Version: 1, Text: text},
+	})
+	return c.diagnostics(uri)
+}
+
+func (c *testClient) shutdown() {
+	if err := c.call("shutdown", nil, nil); err != nil {
+		c.t.Fatalf("shutdown failed: %v", err)
+	}
+	c.notify("exit", nil)
+
+	select {
+	case err := <-c.done:
+		if err != nil {
+			c.t.Errorf("server exited with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("server did not exit")
+	}
+	c.close()
+}
+
+func mustMarshal(t *testing.T, value interface{}) json.RawMessage {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	return raw
+}
+
+// at finds the position of the nth occurrence of needle in an ASCII text.
+func at(text string, needle string, nth int) Position {
+	offset := -1
+	for idx := 0; idx <= nth; idx++ {
+		offset += 1 + strings.Index(text[offset+1:], needle)
+	}
+
+	before := text[:offset]
+	line := strings.Count(before, "\n")
+	return Position{Line: line, Character: offset - (strings.LastIndex(before, "\n") + 1)}
+}
+
+func TestInitializeAndShutdown(t *testing.T) {
+	c := newTestClient(t)
+
+	result := InitializeResult{}
+	if err := c.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &result); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	expected := ServerCapabilities{
+		TextDocumentSync:       TEXT_DOCUMENT_SYNC_FULL,
+		DefinitionProvider:     true,
+		ReferencesProvider:     true,
+		HoverProvider:          true,
+		DocumentSymbolProvider: true,
+	}
+	if result.Capabilities != expected {
+		t.Errorf("expected capabilities %+v, got %+v", expected, result.Capabilities)
+	}
+
+	if err := c.call("textDocument/formatting", map[string]interface{}{}, nil); err == nil || err.Code != E_METHOD_NOT_FOUND {
+		t.Errorf("expected method not found, got %v", err)
+	}
+
+	c.shutdown()
+}
+
+func TestPublishDiagnostics(t *testing.T) {
+	c := newTestClient(t)
+	uri := "file:///errors.lox"
+
+	params := c.open(uri, "var a = 1;\nprint a +;\n{ var b = 1; var b = 2; }\nbreak;")
+	expected := []Diagnostic{
+		{Range: Range{Position{1, 9}, Position{1, 10}}, Severity: SEVERITY_ERROR, Source: "golox", Message: "Expected expression."},
+		{Range: Range{Position{2, 17}, Position{2, 18}}, Severity: SEVERITY_ERROR, Source: "golox", Message: "Already a variable with this name"},
+		{Range: Range{Position{3, 0}, Position{3, 5}}, Severity: SEVERITY_ERROR, Source: "golox", Message: "Cannot use 'break' outside of a loop"},
+	}
+	if !reflect.DeepEqual(params.Diagnostics, expected) {
+		t.Errorf("expected diagnostics %+v, got %+v", expected, params.Diagnostics)
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   VersionedTextDocumentIdentifier{URI: uri, Version: 2},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "var a = 1;\nprint a + 1;"}},
+	})
+	params = c.diagnostics(uri)
+	if params.Version != 2 || len(params.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics for version 2, got %+v", params)
+	}
+
+	c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+	if params = c.diagnostics(uri); len(params.Diagnostics) != 0 {
+		t.Errorf("expected diagnostics to be cleared on close, got %+v", params)
+	}
+
+	if err := c.call("textDocument/hover", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}}, nil); err == nil || err.Code != E_INVALID_PARAMS {
+		t.Errorf("expected an error for a closed document, got %v", err)
+	}
+
+	c.shutdown()
+}
+
+const program = `class Shape {
+  fun area() { return 0; }
+}
+class Square < Shape {
+  fun init(side) { this.side = side; }
+  fun area() { return this.side * this.side; }
+}
+fun total(count) {
+  var sum = 0;
+  for (var i = 0; i < count; i = i + 1) {
+    sum = sum + later(i);
+  }
+  return sum;
+}
+fun later(n) { return n; }
+var square = Square(2);
+print total(3) + str(square.area());
+`
+
+func TestNavigation(t *testing.T) {
+	c := newTestClient(t)
+	uri := "file:///shapes.lox"
+	doc := TextDocumentIdentifier{URI: uri}
+
+	if params := c.open(uri, program); len(params.Diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %+v", params.Diagnostics)
+	}
+
+	word := func(needle string, nth int) Range {
+		start := at(program, needle, nth)
+		return Range{start, Position{start.Line, start.Character + len(needle)}}
+	}
+
+	definitions := []struct {
+		position Position
+		expected *Location
+	}{
+		{at(program, "Shape", 1), &Location{uri, word("Shape", 0)}},
+		{at(program, "sum", 2), &Location{uri, word("sum", 0)}},
+		{at(program, "count", 1), &Location{uri, word("count", 0)}},
+		// Globals may be used before they are declared.
+		{at(program, "later", 0), &Location{uri, word("later", 1)}},
+		{at(program, "square", 1), &Location{uri, word("square", 0)}},
+		{at(program, "str", 0), nil},
+		{Position{100, 0}, nil},
+	}
+	for _, test := range definitions {
+		var location *Location
+		if err := c.call("textDocument/definition", TextDocumentPositionParams{doc, test.position}, &location); err != nil {
+			t.Fatalf("definition failed: %v", err)
+		}
+		if !reflect.DeepEqual(location, test.expected) {
+			t.Errorf("definition at %v: expected %v, got %v", test.position, test.expected, location)
+		}
+	}
+
+	var references []Location
+	params := ReferenceParams{TextDocumentPositionParams{doc, at(program, "sum", 0)}, ReferenceContext{IncludeDeclaration: true}}
+	if err := c.call("textDocument/references", params, &references); err != nil {
+		t.Fatalf("references failed: %v", err)
+	}
+	expectedReferences := []Location{{uri, word("sum", 0)}, {uri, word("sum", 1)}, {uri, word("sum", 2)}, {uri, word("sum", 3)}}
+	if !reflect.DeepEqual(references, expectedReferences) {
+		t.Errorf("expected references %v, got %v", expectedReferences, references)
+	}
+
+	hovers := []struct {
+		position Position
+		expected string
+	}{
+		{at(program, "total", 1), "fun total(count)"},
+		{at(program, "Square", 1), "class Square < Shape"},
+		{at(program, "area", 1), "(method) Square.area()"},
+		{at(program, "side", 0), "(parameter) side"},
+		{at(program, "str", 0), "(native) str"},
+	}
+	for _, test := range hovers {
+		var hover *Hover
+		if err := c.call("textDocument/hover", TextDocumentPositionParams{doc, test.position}, &hover); err != nil {
+			t.Fatalf("hover failed: %v", err)
+		}
+		expected := "```lox\n" + test.expected + "\n```"
+		if hover == nil || hover.Contents.Value != expected {
+			t.Errorf("hover at %v: expected %q, got %+v", test.position, expected, hover)
+		}
+	}
+
+	var symbols []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", DocumentSymbolParams{doc}, &symbols); err != nil {
+		t.Fatalf("document symbols failed: %v", err)
+	}
+
+	outline := make([]string, 0)
+	for _, symbol := range symbols {
+		outline = append(outline, symbol.Name)
+		for _, child := range symbol.Children {
+			outline = append(outline, symbol.Name+"."+child.Name)
+		}
+	}
+	expectedOutline := []string{"Shape", "Shape.area", "Square", "Square.init", "Square.area", "total", "later", "square"}
+	if !reflect.DeepEqual(outline, expectedOutline) {
+		t.Errorf("expected outline %v, got %v", expectedOutline, outline)
+	}
+
+	if symbols[0].Kind != SYMBOL_KIND_CLASS || symbols[0].Range != (Range{Position{0, 0}, Position{2, 1}}) {
+		t.Errorf("unexpected class symbol %+v", symbols[0])
+	}
+
+	c.shutdown()
+}
+
+func TestUnicodePositions(t *testing.T) {
+	c := newTestClient(t)
+	uri := "file:///unicode.lox"
+	doc := TextDocumentIdentifier{URI: uri}
+
+	// 'é' is one UTF-16 code unit but two bytes, '𝄞' is two code units.
+	c.open(uri, "var s = \"é𝄞\"; print s;")
+
+	var location *Location
+	if err := c.call("textDocument/definition", TextDocumentPositionParams{doc, Position{0, 21}}, &location); err != nil {
+		t.Fatalf("definition failed: %v", err)
+	}
+
+	expected := &Location{uri, Range{Position{0, 4}, Position{0, 5}}}
+	if !reflect.DeepEqual(location, expected) {
+		t.Errorf("expected %v, got %v", expected, location)
+	}
+
+	c.shutdown()
+}
+
+func TestInvalidContentLength(t *testing.T) {
+	for _, length := range []string{"-1", "abc", "99999999999999999"} {
+		input := "Content-Length: " + length + "\r\n\r\n{}"
+		if _, err := NewConn(strings.NewReader(input), io.Discard).ReadRaw(); err == nil {
+			t.Errorf("%s: expected an error", length)
+		}
+		if err := NewServer().Serve(strings.NewReader(input), io.Discard); err == nil {
+			t.Errorf("%s: expected serving to fail", length)
+		}
+	}
+}
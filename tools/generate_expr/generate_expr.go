@@ -60,6 +60,7 @@ func generate(writer *bufio.Writer, mainClass string, grammar []string) {
 	w.writeNewLine()
 	w.writeLinef("type %s interface {", mainClass)
 	w.writeLinef("  Accept(visitor %sVisitor) interface{}", mainClass)
+	w.writeLinef("  Span() Span")
 	w.writeLinef("}")
 	w.writeNewLine()
 
@@ -77,6 +78,7 @@ func generate(writer *bufio.Writer, mainClass string, grammar []string) {
 		definerFunc := func() {
 			w.writeLinef("type %s struct {", key)
 			w.writeLinef("  Expr")
+			w.writeLinef("  span Span")
 			for _, def := range definitionElements {
 				def = strings.Trim(def, " ")
 				w.writeLinef("  %s", def)
@@ -88,6 +90,16 @@ func generate(writer *bufio.Writer, mainClass string, grammar []string) {
 			w.writeLinef("  return visitor.Visit%s(e)", key)
 			w.writeLinef("}")
 			w.writeNewLine()
+
+			w.writeLinef("func (e *%s) Span() Span {", key)
+			w.writeLinef("  return e.span")
+			w.writeLinef("}")
+			w.writeNewLine()
+
+			w.writeLinef("func (e *%s) SetSpan(span Span) {", key)
+			w.writeLinef("  e.span = span")
+			w.writeLinef("}")
+			w.writeNewLine()
 		}
 
 		structDefiners = append(structDefiners, definerFunc)
@@ -140,18 +152,29 @@ func main() {
 				"Super : Super Token, Call Token",
 				"Get : Object Expr, Name Token",
 				"Set : Object Expr, Name Token, Value Expr",
-				"Lambda : Name Token, Params []Token, Body []Stmt",
+				"Lambda : Name Token, Params []Token, Body []Stmt, IsAsync bool, IsGenerator bool",
+				"ListLiteral : Bracket Token, Elements []Expr",
+				"MapLiteral : Brace Token, Keys []Expr, Values []Expr",
+				"GetIndex : Object Expr, Bracket Token, Index Expr",
+				"SetIndex : Object Expr, Bracket Token, Index Expr, Value Expr",
+				"Await : Keyword Token, Value Expr",
 			}},
 		{"stmt.go", "Stmt", []string{
 			"IfStmt : Condition Expr, ThenBranch Stmt, ElseBranch Stmt",
-			"WhileStmt : Condition Expr, Body Stmt",
+			"WhileStmt : Condition Expr, Body Stmt, Increment Expr",
 			"ExprStmt: Expression Expr",
-			"PrintStmt : Expression Expr",
+			"PrintStmt : Keyword Token, Expression Expr",
 			"VarStmt : Name Token, Initializer Expr",
-			"FunctionStmt : Name Token, Params []Token, Body []Stmt",
-			"ClassStmt : Name Token, SuperClass *Variable, Methods []*FunctionStmt",
+			"FunctionStmt : Name Token, Params []Token, Body []Stmt, IsAsync bool, IsGenerator bool, IsGetter bool",
+			"ClassStmt : Name Token, SuperClass *Variable, Fields []*VarStmt, Methods []*FunctionStmt, ClassMethods []*FunctionStmt, ClassFields []*VarStmt",
 			"BlockStmt : Statements []Stmt",
 			"ReturnStmt : Keyword Token, Expression Expr",
+			"YieldStmt : Keyword Token, Expression Expr",
+			"BreakStmt : Keyword Token",
+			"ContinueStmt : Keyword Token",
+			"ThrowStmt : Keyword Token, Expression Expr",
+			"ImportStmt : Keyword Token, Path Token, Name Token",
+			"TryStmt : Keyword Token, Body *BlockStmt, CatchName Token, CatchBody *BlockStmt, FinallyBody *BlockStmt",
 		}},
 	}
 
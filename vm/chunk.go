@@ -0,0 +1,252 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cgrunewald/golox/interpreter"
+)
+
+type OpCode byte
+
+const (
+	OP_CONSTANT OpCode = iota
+	OP_NIL
+	OP_TRUE
+	OP_FALSE
+	OP_POP
+	OP_GET_LOCAL
+	OP_SET_LOCAL
+	OP_GET_GLOBAL
+	OP_DEFINE_GLOBAL
+	OP_SET_GLOBAL
+	OP_GET_UPVALUE
+	OP_SET_UPVALUE
+	OP_GET_PROPERTY
+	OP_SET_PROPERTY
+	OP_GET_SUPER
+	OP_EQUAL
+	OP_NOT_EQUAL
+	OP_GREATER
+	OP_GREATER_EQUAL
+	OP_LESS
+	OP_LESS_EQUAL
+	OP_ADD
+	OP_SUBTRACT
+	OP_MULTIPLY
+	OP_DIVIDE
+	OP_NOT
+	OP_NEGATE
+	OP_AND
+	OP_PRINT
+	OP_JUMP
+	OP_JUMP_IF_FALSE
+	OP_LOOP
+	OP_CALL
+	OP_INVOKE
+	OP_SUPER_INVOKE
+	OP_CLOSURE
+	OP_CLOSE_UPVALUE
+	OP_RETURN
+	OP_CLASS
+	OP_INHERIT
+	OP_METHOD
+	OP_LIST
+	OP_GET_INDEX
+	OP_SET_INDEX
+	OP_MAP
+	OP_TRY
+	OP_POP_HANDLER
+	OP_THROW
+	OP_CATCH
+)
+
+var OpCodeNames = map[OpCode]string{
+	OP_CONSTANT:      "OP_CONSTANT",
+	OP_NIL:           "OP_NIL",
+	OP_TRUE:          "OP_TRUE",
+	OP_FALSE:         "OP_FALSE",
+	OP_POP:           "OP_POP",
+	OP_GET_LOCAL:     "OP_GET_LOCAL",
+	OP_SET_LOCAL:     "OP_SET_LOCAL",
+	OP_GET_GLOBAL:    "OP_GET_GLOBAL",
+	OP_DEFINE_GLOBAL: "OP_DEFINE_GLOBAL",
+	OP_SET_GLOBAL:    "OP_SET_GLOBAL",
+	OP_GET_UPVALUE:   "OP_GET_UPVALUE",
+	OP_SET_UPVALUE:   "OP_SET_UPVALUE",
+	OP_GET_PROPERTY:  "OP_GET_PROPERTY",
+	OP_SET_PROPERTY:  "OP_SET_PROPERTY",
+	OP_GET_SUPER:     "OP_GET_SUPER",
+	OP_EQUAL:         "OP_EQUAL",
+	OP_NOT_EQUAL:     "OP_NOT_EQUAL",
+	OP_GREATER:       "OP_GREATER",
+	OP_GREATER_EQUAL: "OP_GREATER_EQUAL",
+	OP_LESS:          "OP_LESS",
+	OP_LESS_EQUAL:    "OP_LESS_EQUAL",
+	OP_ADD:           "OP_ADD",
+	OP_SUBTRACT:      "OP_SUBTRACT",
+	OP_MULTIPLY:      "OP_MULTIPLY",
+	OP_DIVIDE:        "OP_DIVIDE",
+	OP_NOT:           "OP_NOT",
+	OP_NEGATE:        "OP_NEGATE",
+	OP_AND:           "OP_AND",
+	OP_PRINT:         "OP_PRINT",
+	OP_JUMP:          "OP_JUMP",
+	OP_JUMP_IF_FALSE: "OP_JUMP_IF_FALSE",
+	OP_LOOP:          "OP_LOOP",
+	OP_CALL:          "OP_CALL",
+	OP_INVOKE:        "OP_INVOKE",
+	OP_SUPER_INVOKE:  "OP_SUPER_INVOKE",
+	OP_CLOSURE:       "OP_CLOSURE",
+	OP_CLOSE_UPVALUE: "OP_CLOSE_UPVALUE",
+	OP_RETURN:        "OP_RETURN",
+	OP_CLASS:         "OP_CLASS",
+	OP_INHERIT:       "OP_INHERIT",
+	OP_METHOD:        "OP_METHOD",
+	OP_LIST:          "OP_LIST",
+	OP_GET_INDEX:     "OP_GET_INDEX",
+	OP_SET_INDEX:     "OP_SET_INDEX",
+	OP_MAP:           "OP_MAP",
+	OP_TRY:           "OP_TRY",
+	OP_POP_HANDLER:   "OP_POP_HANDLER",
+	OP_THROW:         "OP_THROW",
+	OP_CATCH:         "OP_CATCH",
+}
+
+// position records where in the source an instruction came from so runtime
+// errors can be reported the same way the tree walker reports them.
+type position struct {
+	line   int
+	column int
+	offset int
+	lexeme string
+}
+
+type Chunk struct {
+	Code      []byte
+	Constants []interface{}
+	positions []position
+	constants map[interface{}]uint16
+}
+
+func NewChunk() *Chunk {
+	return &Chunk{
+		Code:      make([]byte, 0),
+		Constants: make([]interface{}, 0),
+		positions: make([]position, 0),
+		constants: make(map[interface{}]uint16),
+	}
+}
+
+func (c *Chunk) write(b byte, token interpreter.Token) {
+	c.Code = append(c.Code, b)
+	c.positions = append(c.positions, position{line: token.Line, column: token.Column, offset: token.Offset, lexeme: token.Lexeme})
+}
+
+// addConstant returns the index of value in the constant table. Strings and
+// numbers are deduplicated since names are referenced over and over.
+func (c *Chunk) addConstant(value interface{}) int {
+	switch value.(type) {
+	case string, float64:
+		if idx, ok := c.constants[value]; ok {
+			return int(idx)
+		}
+	}
+
+	c.Constants = append(c.Constants, value)
+	idx := len(c.Constants) - 1
+
+	switch value.(type) {
+	case string, float64:
+		if idx <= maxShort {
+			c.constants[value] = uint16(idx)
+		}
+	}
+
+	return idx
+}
+
+func (c *Chunk) readShort(offset int) int {
+	return int(c.Code[offset])<<8 | int(c.Code[offset+1])
+}
+
+// Disassemble renders the chunk, and every function nested in its constant
+// table, in a human readable form.
+func (c *Chunk) Disassemble(name string) string {
+	builder := strings.Builder{}
+	c.disassemble(&builder, name)
+	return builder.String()
+}
+
+func (c *Chunk) disassemble(builder *strings.Builder, name string) {
+	builder.WriteString(fmt.Sprintf("== %s ==\n", name))
+
+	for offset := 0; offset < len(c.Code); {
+		offset = c.disassembleInstruction(builder, offset)
+	}
+
+	for _, constant := range c.Constants {
+		if fn, ok := constant.(*Function); ok {
+			fn.chunk.disassemble(builder, fn.String())
+		}
+	}
+}
+
+func (c *Chunk) disassembleInstruction(builder *strings.Builder, offset int) int {
+	builder.WriteString(fmt.Sprintf("%04d ", offset))
+	if offset > 0 && c.positions[offset].line == c.positions[offset-1].line {
+		builder.WriteString("   | ")
+	} else {
+		builder.WriteString(fmt.Sprintf("%4d ", c.positions[offset].line))
+	}
+
+	op := OpCode(c.Code[offset])
+	name := OpCodeNames[op]
+
+	switch op {
+	case OP_CONSTANT, OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL,
+		OP_GET_PROPERTY, OP_SET_PROPERTY, OP_GET_SUPER, OP_CLASS, OP_METHOD:
+		idx := c.readShort(offset + 1)
+		if op == OP_GET_GLOBAL || op == OP_DEFINE_GLOBAL || op == OP_SET_GLOBAL {
+			builder.WriteString(fmt.Sprintf("%-16s %4d '%s'\n", name, idx, c.positions[offset].lexeme))
+		} else {
+			builder.WriteString(fmt.Sprintf("%-16s %4d '%v'\n", name, idx, c.Constants[idx]))
+		}
+		return offset + 3
+	case OP_LIST, OP_MAP:
+		builder.WriteString(fmt.Sprintf("%-16s %4d\n", name, c.readShort(offset+1)))
+		return offset + 3
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE, OP_CALL:
+		builder.WriteString(fmt.Sprintf("%-16s %4d\n", name, c.Code[offset+1]))
+		return offset + 2
+	case OP_JUMP, OP_JUMP_IF_FALSE, OP_TRY:
+		jump := c.readShort(offset + 1)
+		builder.WriteString(fmt.Sprintf("%-16s %4d -> %d\n", name, offset, offset+3+jump))
+		return offset + 3
+	case OP_LOOP:
+		jump := c.readShort(offset + 1)
+		builder.WriteString(fmt.Sprintf("%-16s %4d -> %d\n", name, offset, offset+3-jump))
+		return offset + 3
+	case OP_INVOKE, OP_SUPER_INVOKE:
+		idx := c.readShort(offset + 1)
+		builder.WriteString(fmt.Sprintf("%-16s (%d args) %4d '%v'\n", name, c.Code[offset+3], idx, c.Constants[idx]))
+		return offset + 4
+	case OP_CLOSURE:
+		idx := c.readShort(offset + 1)
+		fn := c.Constants[idx].(*Function)
+		builder.WriteString(fmt.Sprintf("%-16s %4d %v\n", name, idx, fn))
+		offset = offset + 3
+		for j := 0; j < fn.upvalueCount; j++ {
+			kind := "upvalue"
+			if c.Code[offset] == 1 {
+				kind = "local"
+			}
+			builder.WriteString(fmt.Sprintf("%04d    |                     %s %d\n", offset, kind, c.Code[offset+1]))
+			offset = offset + 2
+		}
+		return offset
+	default:
+		builder.WriteString(name + "\n")
+		return offset + 1
+	}
+}
@@ -0,0 +1,972 @@
+package vm
+
+import (
+	"github.com/cgrunewald/golox/interpreter"
+)
+
+type FunctionType int32
+
+const (
+	FUNCTION_TYPE_SCRIPT FunctionType = iota
+	FUNCTION_TYPE_FUNCTION
+	FUNCTION_TYPE_METHOD
+	FUNCTION_TYPE_INITIALIZER
+)
+
+const (
+	maxByte  = 255
+	maxShort = 65535
+)
+
+type local struct {
+	name       string
+	depth      int
+	isCaptured bool
+}
+
+type upvalueRef struct {
+	index   byte
+	isLocal bool
+}
+
+// loop records the jumps emitted by break and continue so they can be
+// patched once the end of the loop body is known.
+type loop struct {
+	scopeDepth    int
+	tryDepth      int
+	breakJumps    []int
+	continueJumps []int
+}
+
+// tryBlock is a try statement being compiled. Jumps that leave it early have
+// to remove its handler and run its finally block on the way out.
+type tryBlock struct {
+	handler bool
+	finally *interpreter.BlockStmt
+}
+
+// functionScope tracks the stack slots of the function currently being
+// compiled. Scopes form a chain so that closures can capture variables from
+// the functions enclosing them.
+type functionScope struct {
+	enclosing    *functionScope
+	function     *Function
+	functionType FunctionType
+	locals       []local
+	upvalues     []upvalueRef
+	loops        []*loop
+	tries        []*tryBlock
+	scopeDepth   int
+}
+
+// Compiler turns a resolved AST into bytecode. Variables are bound to stack
+// slots, upvalues or global slots at compile time so that the VM never has
+// to walk an environment chain.
+type Compiler struct {
+	globals *globalTable
+	current *functionScope
+	class   string
+	token   interpreter.Token
+	errs    []error
+}
+
+func NewCompiler(globals *globalTable) *Compiler {
+	return &Compiler{globals: globals, errs: make([]error, 0)}
+}
+
+func (c *Compiler) Compile(stmts []interpreter.Stmt) (*Function, []error) {
+	c.beginFunction("", FUNCTION_TYPE_SCRIPT)
+	for _, stmt := range stmts {
+		stmt.Accept(c)
+	}
+
+	return c.endFunction(), c.errs
+}
+
+func (c *Compiler) CompileExpr(expr interpreter.Expr) (*Function, []error) {
+	c.beginFunction("", FUNCTION_TYPE_SCRIPT)
+	expr.Accept(c)
+	c.emitOp(OP_RETURN)
+
+	return c.endFunction(), c.errs
+}
+
+func (c *Compiler) HasError() bool {
+	return len(c.errs) > 0
+}
+
+func (c *Compiler) Errors() []error {
+	return c.errs
+}
+
+func (c *Compiler) beginFunction(name string, functionType FunctionType) {
+	scope := &functionScope{
+		enclosing:    c.current,
+		function:     &Function{name: name, chunk: NewChunk()},
+		functionType: functionType,
+		locals:       make([]local, 0, 8),
+		upvalues:     make([]upvalueRef, 0),
+	}
+
+	// Slot zero holds the callee, or the receiver for methods.
+	slotZero := ""
+	if functionType == FUNCTION_TYPE_METHOD || functionType == FUNCTION_TYPE_INITIALIZER {
+		slotZero = "this"
+		scope.function.class = c.class
+	}
+	scope.locals = append(scope.locals, local{name: slotZero})
+
+	c.current = scope
+}
+
+func (c *Compiler) endFunction() *Function {
+	c.emitReturn()
+
+	fn := c.current.function
+	fn.upvalueCount = len(c.current.upvalues)
+	c.current = c.current.enclosing
+	return fn
+}
+
+func (c *Compiler) at(token interpreter.Token) {
+	c.token = token
+}
+
+func (c *Compiler) error(token interpreter.Token, message string) {
+	c.errs = append(c.errs, token.ToError(message))
+}
+
+func (c *Compiler) chunk() *Chunk {
+	return c.current.function.chunk
+}
+
+func (c *Compiler) emitByte(b byte) {
+	c.chunk().write(b, c.token)
+}
+
+func (c *Compiler) emitOp(op OpCode) {
+	c.emitByte(byte(op))
+}
+
+func (c *Compiler) emitOpByte(op OpCode, operand byte) {
+	c.emitByte(byte(op))
+	c.emitByte(operand)
+}
+
+func (c *Compiler) emitOpShort(op OpCode, operand uint16) {
+	c.emitByte(byte(op))
+	c.emitByte(byte(operand >> 8))
+	c.emitByte(byte(operand))
+}
+
+func (c *Compiler) emitReturn() {
+	if c.current.functionType == FUNCTION_TYPE_INITIALIZER {
+		c.emitOpByte(OP_GET_LOCAL, 0)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+	c.emitOp(OP_RETURN)
+}
+
+func (c *Compiler) emitJump(op OpCode) int {
+	c.emitOpShort(op, 0xffff)
+	return len(c.chunk().Code) - 2
+}
+
+func (c *Compiler) patchJump(offset int) {
+	jump := len(c.chunk().Code) - offset - 2
+	if jump > maxShort {
+		c.error(c.token, "Too much code to jump over")
+	}
+
+	c.chunk().Code[offset] = byte(jump >> 8)
+	c.chunk().Code[offset+1] = byte(jump)
+}
+
+func (c *Compiler) emitLoop(loopStart int) {
+	offset := len(c.chunk().Code) - loopStart + 3
+	if offset > maxShort {
+		c.error(c.token, "Loop body too large")
+	}
+	c.emitOpShort(OP_LOOP, uint16(offset))
+}
+
+func (c *Compiler) makeConstant(value interface{}) uint16 {
+	idx := c.chunk().addConstant(value)
+	if idx > maxShort {
+		c.error(c.token, "Too many constants in one chunk")
+		return 0
+	}
+	return uint16(idx)
+}
+
+func (c *Compiler) emitConstant(value interface{}) {
+	c.emitOpShort(OP_CONSTANT, c.makeConstant(value))
+}
+
+func (c *Compiler) globalSlot(name interpreter.Token) uint16 {
+	idx, ok := c.globals.slot(name.Lexeme)
+	if !ok {
+		c.error(name, "Too many global variables")
+	}
+	return idx
+}
+
+func (c *Compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+func (c *Compiler) endScope() {
+	scope := c.current
+	scope.scopeDepth--
+
+	for len(scope.locals) > 0 && scope.locals[len(scope.locals)-1].depth > scope.scopeDepth {
+		if scope.locals[len(scope.locals)-1].isCaptured {
+			c.emitOp(OP_CLOSE_UPVALUE)
+		} else {
+			c.emitOp(OP_POP)
+		}
+		scope.locals = scope.locals[:len(scope.locals)-1]
+	}
+}
+
+// discardLocals pops the locals declared deeper than depth without forgetting
+// them, for jumps that leave a scope early.
+func (c *Compiler) discardLocals(depth int) {
+	scope := c.current
+	for i := len(scope.locals) - 1; i >= 0 && scope.locals[i].depth > depth; i-- {
+		if scope.locals[i].isCaptured {
+			c.emitOp(OP_CLOSE_UPVALUE)
+		} else {
+			c.emitOp(OP_POP)
+		}
+	}
+}
+
+func (c *Compiler) isGlobalScope() bool {
+	return c.current.scopeDepth == 0
+}
+
+func (c *Compiler) addLocal(name interpreter.Token) {
+	if len(c.current.locals) > maxByte {
+		c.error(name, "Too many local variables in function")
+		return
+	}
+
+	c.current.locals = append(c.current.locals, local{name: name.Lexeme, depth: c.current.scopeDepth})
+}
+
+// declareVariable must be called before the value of the variable is pushed so
+// that local variables are bound to the slot their value will end up in.
+func (c *Compiler) declareVariable(name interpreter.Token) {
+	if !c.isGlobalScope() {
+		c.addLocal(name)
+	}
+}
+
+// defineVariable is called once the value of the variable is on the stack.
+func (c *Compiler) defineVariable(name interpreter.Token) {
+	if c.isGlobalScope() {
+		c.at(name)
+		c.emitOpShort(OP_DEFINE_GLOBAL, c.globalSlot(name))
+	}
+}
+
+func resolveLocal(scope *functionScope, name string) int {
+	for i := len(scope.locals) - 1; i >= 0; i-- {
+		if scope.locals[i].name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (c *Compiler) resolveUpvalue(scope *functionScope, name interpreter.Token) int {
+	if scope.enclosing == nil {
+		return -1
+	}
+
+	if local := resolveLocal(scope.enclosing, name.Lexeme); local != -1 {
+		scope.enclosing.locals[local].isCaptured = true
+		return c.addUpvalue(scope, name, byte(local), true)
+	}
+
+	if upvalue := c.resolveUpvalue(scope.enclosing, name); upvalue != -1 {
+		return c.addUpvalue(scope, name, byte(upvalue), false)
+	}
+
+	return -1
+}
+
+func (c *Compiler) addUpvalue(scope *functionScope, name interpreter.Token, index byte, isLocal bool) int {
+	for i, upvalue := range scope.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i
+		}
+	}
+
+	if len(scope.upvalues) > maxByte {
+		c.error(name, "Too many closure variables in function")
+		return 0
+	}
+
+	scope.upvalues = append(scope.upvalues, upvalueRef{index: index, isLocal: isLocal})
+	return len(scope.upvalues) - 1
+}
+
+func (c *Compiler) getVariable(name interpreter.Token) {
+	c.at(name)
+	if slot := resolveLocal(c.current, name.Lexeme); slot != -1 {
+		c.emitOpByte(OP_GET_LOCAL, byte(slot))
+	} else if upvalue := c.resolveUpvalue(c.current, name); upvalue != -1 {
+		c.emitOpByte(OP_GET_UPVALUE, byte(upvalue))
+	} else {
+		c.emitOpShort(OP_GET_GLOBAL, c.globalSlot(name))
+	}
+}
+
+func (c *Compiler) setVariable(name interpreter.Token) {
+	c.at(name)
+	if slot := resolveLocal(c.current, name.Lexeme); slot != -1 {
+		c.emitOpByte(OP_SET_LOCAL, byte(slot))
+	} else if upvalue := c.resolveUpvalue(c.current, name); upvalue != -1 {
+		c.emitOpByte(OP_SET_UPVALUE, byte(upvalue))
+	} else {
+		c.emitOpShort(OP_SET_GLOBAL, c.globalSlot(name))
+	}
+}
+
+// thisToken refers to the receiver of the method enclosing a 'super' expression.
+func thisToken(super interpreter.Token) interpreter.Token {
+	return interpreter.NewToken(interpreter.TK_THIS, "this", nil, super.Line)
+}
+
+func (c *Compiler) function(name interpreter.Token, params []interpreter.Token, body []interpreter.Stmt, functionType FunctionType) {
+	c.beginFunction(name.Lexeme, functionType)
+	c.beginScope()
+
+	c.current.function.arity = len(params)
+	for _, param := range params {
+		c.addLocal(param)
+	}
+
+	for _, stmt := range body {
+		stmt.Accept(c)
+	}
+
+	upvalues := c.current.upvalues
+	fn := c.endFunction()
+
+	c.at(name)
+	c.emitOpShort(OP_CLOSURE, c.makeConstant(fn))
+	for _, upvalue := range upvalues {
+		if upvalue.isLocal {
+			c.emitByte(1)
+		} else {
+			c.emitByte(0)
+		}
+		c.emitByte(upvalue.index)
+	}
+}
+
+func (c *Compiler) arguments(paren interpreter.Token, args []interpreter.Expr) byte {
+	for _, arg := range args {
+		arg.Accept(c)
+	}
+
+	if len(args) > maxByte {
+		c.error(paren, "Argument list exceeded maximum length")
+	}
+	return byte(len(args))
+}
+
+func (c *Compiler) VisitBinary(expr *interpreter.Binary) interface{} {
+	expr.Left.Accept(c)
+	expr.Right.Accept(c)
+
+	c.at(expr.Operator)
+	switch expr.Operator.TokenType {
+	case interpreter.TK_PLUS:
+		c.emitOp(OP_ADD)
+	case interpreter.TK_MINUS:
+		c.emitOp(OP_SUBTRACT)
+	case interpreter.TK_STAR:
+		c.emitOp(OP_MULTIPLY)
+	case interpreter.TK_SLASH:
+		c.emitOp(OP_DIVIDE)
+	case interpreter.TK_BANG_EQUAL:
+		c.emitOp(OP_NOT_EQUAL)
+	case interpreter.TK_EQUAL_EQUAL:
+		c.emitOp(OP_EQUAL)
+	case interpreter.TK_GREATER:
+		c.emitOp(OP_GREATER)
+	case interpreter.TK_GREATER_EQUAL:
+		c.emitOp(OP_GREATER_EQUAL)
+	case interpreter.TK_LESS:
+		c.emitOp(OP_LESS)
+	case interpreter.TK_LESS_EQUAL:
+		c.emitOp(OP_LESS_EQUAL)
+	default:
+		c.error(expr.Operator, "Invalid binary operator")
+	}
+
+	return nil
+}
+
+func (c *Compiler) VisitLogical(expr *interpreter.Logical) interface{} {
+	expr.Left.Accept(c)
+
+	c.at(expr.Operator)
+	switch expr.Operator.TokenType {
+	case interpreter.TK_OR:
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+		c.emitOp(OP_POP)
+		c.emitOp(OP_TRUE)
+		endJump := c.emitJump(OP_JUMP)
+
+		c.patchJump(elseJump)
+		c.emitOp(OP_POP)
+		expr.Right.Accept(c)
+
+		// Like the tree walker, logical operators always produce a boolean.
+		c.at(expr.Operator)
+		c.emitOp(OP_NOT)
+		c.emitOp(OP_NOT)
+		c.patchJump(endJump)
+	case interpreter.TK_AND:
+		// The tree walker evaluates both operands of 'and'.
+		expr.Right.Accept(c)
+		c.at(expr.Operator)
+		c.emitOp(OP_AND)
+	default:
+		c.error(expr.Operator, "unexpected operator "+expr.Operator.Lexeme)
+	}
+
+	return nil
+}
+
+func (c *Compiler) VisitGrouping(expr *interpreter.Grouping) interface{} {
+	expr.Expression.Accept(c)
+	return nil
+}
+
+func (c *Compiler) VisitLiteral(expr *interpreter.Literal) interface{} {
+	switch expr.Value {
+	case nil:
+		c.emitOp(OP_NIL)
+	case true:
+		c.emitOp(OP_TRUE)
+	case false:
+		c.emitOp(OP_FALSE)
+	default:
+		c.emitConstant(expr.Value)
+	}
+
+	return nil
+}
+
+func (c *Compiler) VisitUnary(expr *interpreter.Unary) interface{} {
+	expr.Right.Accept(c)
+
+	c.at(expr.Operator)
+	switch expr.Operator.TokenType {
+	case interpreter.TK_MINUS:
+		c.emitOp(OP_NEGATE)
+	case interpreter.TK_BANG:
+		c.emitOp(OP_NOT)
+	default:
+		c.error(expr.Operator, "Invalid unary operator")
+	}
+
+	return nil
+}
+
+func (c *Compiler) VisitTernaryCondition(expr *interpreter.TernaryCondition) interface{} {
+	expr.Condition.Accept(c)
+
+	elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	expr.TrueBranch.Accept(c)
+	endJump := c.emitJump(OP_JUMP)
+
+	c.patchJump(elseJump)
+	c.emitOp(OP_POP)
+	expr.FalseBranch.Accept(c)
+	c.patchJump(endJump)
+
+	return nil
+}
+
+func (c *Compiler) VisitAssign(expr *interpreter.Assign) interface{} {
+	expr.Value.Accept(c)
+	c.setVariable(expr.Name)
+	return nil
+}
+
+func (c *Compiler) VisitVariable(expr *interpreter.Variable) interface{} {
+	c.getVariable(expr.Name)
+	return nil
+}
+
+func (c *Compiler) VisitCall(expr *interpreter.Call) interface{} {
+	switch callee := expr.Callee.(type) {
+	case *interpreter.Get:
+		callee.Object.Accept(c)
+		argCount := c.arguments(expr.Paren, expr.Arguments)
+
+		c.at(callee.Name)
+		c.emitOpShort(OP_INVOKE, c.makeConstant(callee.Name.Lexeme))
+		c.emitByte(argCount)
+	case *interpreter.Super:
+		c.getVariable(thisToken(callee.Super))
+		argCount := c.arguments(expr.Paren, expr.Arguments)
+		c.getVariable(callee.Super)
+
+		c.at(callee.Call)
+		c.emitOpShort(OP_SUPER_INVOKE, c.makeConstant(callee.Call.Lexeme))
+		c.emitByte(argCount)
+	default:
+		expr.Callee.Accept(c)
+		argCount := c.arguments(expr.Paren, expr.Arguments)
+
+		c.at(expr.Paren)
+		c.emitOpByte(OP_CALL, argCount)
+	}
+
+	return nil
+}
+
+func (c *Compiler) VisitSuper(expr *interpreter.Super) interface{} {
+	c.getVariable(thisToken(expr.Super))
+	c.getVariable(expr.Super)
+
+	c.at(expr.Call)
+	c.emitOpShort(OP_GET_SUPER, c.makeConstant(expr.Call.Lexeme))
+	return nil
+}
+
+func (c *Compiler) VisitGet(expr *interpreter.Get) interface{} {
+	expr.Object.Accept(c)
+
+	c.at(expr.Name)
+	c.emitOpShort(OP_GET_PROPERTY, c.makeConstant(expr.Name.Lexeme))
+	return nil
+}
+
+func (c *Compiler) VisitSet(expr *interpreter.Set) interface{} {
+	expr.Object.Accept(c)
+	expr.Value.Accept(c)
+
+	c.at(expr.Name)
+	c.emitOpShort(OP_SET_PROPERTY, c.makeConstant(expr.Name.Lexeme))
+	return nil
+}
+
+func (c *Compiler) VisitLambda(expr *interpreter.Lambda) interface{} {
+	c.checkSync(expr.Name, expr.IsAsync)
+	c.function(expr.Name, expr.Params, expr.Body, FUNCTION_TYPE_FUNCTION)
+	return nil
+}
+
+// The event loop only runs on the tree-walking interpreter.
+func (c *Compiler) VisitAwait(expr *interpreter.Await) interface{} {
+	c.error(expr.Keyword, "Await is not supported by the VM")
+	return nil
+}
+
+func (c *Compiler) VisitYieldStmt(stmt *interpreter.YieldStmt) interface{} {
+	c.error(stmt.Keyword, "Generators are not supported by the VM")
+	return nil
+}
+
+func (c *Compiler) checkSync(name interpreter.Token, isAsync bool) {
+	if isAsync {
+		c.error(name, "Async functions are not supported by the VM")
+	}
+}
+
+func (c *Compiler) VisitListLiteral(expr *interpreter.ListLiteral) interface{} {
+	for _, element := range expr.Elements {
+		element.Accept(c)
+	}
+
+	if len(expr.Elements) > maxShort {
+		c.error(expr.Bracket, "Too many elements in list literal")
+	}
+
+	c.at(expr.Bracket)
+	c.emitOpShort(OP_LIST, uint16(len(expr.Elements)))
+	return nil
+}
+
+func (c *Compiler) VisitMapLiteral(expr *interpreter.MapLiteral) interface{} {
+	for idx, key := range expr.Keys {
+		key.Accept(c)
+		expr.Values[idx].Accept(c)
+	}
+
+	if len(expr.Keys) > maxShort {
+		c.error(expr.Brace, "Too many entries in map literal")
+	}
+
+	c.at(expr.Brace)
+	c.emitOpShort(OP_MAP, uint16(len(expr.Keys)))
+	return nil
+}
+
+func (c *Compiler) VisitGetIndex(expr *interpreter.GetIndex) interface{} {
+	expr.Object.Accept(c)
+	expr.Index.Accept(c)
+
+	c.at(expr.Bracket)
+	c.emitOp(OP_GET_INDEX)
+	return nil
+}
+
+func (c *Compiler) VisitSetIndex(expr *interpreter.SetIndex) interface{} {
+	expr.Object.Accept(c)
+	expr.Index.Accept(c)
+	expr.Value.Accept(c)
+
+	c.at(expr.Bracket)
+	c.emitOp(OP_SET_INDEX)
+	return nil
+}
+
+func (c *Compiler) VisitIfStmt(stmt *interpreter.IfStmt) interface{} {
+	stmt.Condition.Accept(c)
+
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	stmt.ThenBranch.Accept(c)
+	elseJump := c.emitJump(OP_JUMP)
+
+	c.patchJump(thenJump)
+	c.emitOp(OP_POP)
+	if stmt.ElseBranch != nil {
+		stmt.ElseBranch.Accept(c)
+	}
+	c.patchJump(elseJump)
+
+	return nil
+}
+
+func (c *Compiler) VisitWhileStmt(stmt *interpreter.WhileStmt) interface{} {
+	loopStart := len(c.chunk().Code)
+	stmt.Condition.Accept(c)
+
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+
+	l := &loop{scopeDepth: c.current.scopeDepth, tryDepth: len(c.current.tries)}
+	c.current.loops = append(c.current.loops, l)
+	stmt.Body.Accept(c)
+	c.current.loops = c.current.loops[:len(c.current.loops)-1]
+
+	for _, jump := range l.continueJumps {
+		c.patchJump(jump)
+	}
+
+	if stmt.Increment != nil {
+		stmt.Increment.Accept(c)
+		c.emitOp(OP_POP)
+	}
+	c.emitLoop(loopStart)
+
+	c.patchJump(exitJump)
+	c.emitOp(OP_POP)
+
+	for _, jump := range l.breakJumps {
+		c.patchJump(jump)
+	}
+
+	return nil
+}
+
+func (c *Compiler) currentLoop(keyword interpreter.Token, errorType int32) *loop {
+	if len(c.current.loops) == 0 {
+		c.errs = append(c.errs, keyword.ToRuntimeError(errorType, "Cannot use '"+keyword.Lexeme+"' outside of a loop"))
+		return nil
+	}
+
+	return c.current.loops[len(c.current.loops)-1]
+}
+
+func (c *Compiler) VisitBreakStmt(stmt *interpreter.BreakStmt) interface{} {
+	c.at(stmt.Keyword)
+	l := c.currentLoop(stmt.Keyword, interpreter.E_UNEXPECTED_BREAK)
+	if l == nil {
+		return nil
+	}
+
+	c.leaveTries(l.tryDepth)
+	c.discardLocals(l.scopeDepth)
+	l.breakJumps = append(l.breakJumps, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *Compiler) VisitContinueStmt(stmt *interpreter.ContinueStmt) interface{} {
+	c.at(stmt.Keyword)
+	l := c.currentLoop(stmt.Keyword, interpreter.E_UNEXPECTED_CONTINUE)
+	if l == nil {
+		return nil
+	}
+
+	c.leaveTries(l.tryDepth)
+	c.discardLocals(l.scopeDepth)
+	l.continueJumps = append(l.continueJumps, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *Compiler) VisitExprStmt(stmt *interpreter.ExprStmt) interface{} {
+	stmt.Expression.Accept(c)
+	c.emitOp(OP_POP)
+	return nil
+}
+
+func (c *Compiler) VisitPrintStmt(stmt *interpreter.PrintStmt) interface{} {
+	stmt.Expression.Accept(c)
+	c.emitOp(OP_PRINT)
+	return nil
+}
+
+func (c *Compiler) VisitVarStmt(stmt *interpreter.VarStmt) interface{} {
+	c.declareVariable(stmt.Name)
+
+	if stmt.Initializer != nil {
+		stmt.Initializer.Accept(c)
+	} else {
+		c.at(stmt.Name)
+		c.emitOp(OP_NIL)
+	}
+
+	c.defineVariable(stmt.Name)
+	return nil
+}
+
+func (c *Compiler) VisitFunctionStmt(stmt *interpreter.FunctionStmt) interface{} {
+	c.declareVariable(stmt.Name)
+	c.checkSync(stmt.Name, stmt.IsAsync)
+	c.function(stmt.Name, stmt.Params, stmt.Body, FUNCTION_TYPE_FUNCTION)
+	c.defineVariable(stmt.Name)
+	return nil
+}
+
+func (c *Compiler) VisitClassStmt(stmt *interpreter.ClassStmt) interface{} {
+	c.declareVariable(stmt.Name)
+
+	c.at(stmt.Name)
+	c.emitOpShort(OP_CLASS, c.makeConstant(stmt.Name.Lexeme))
+	c.defineVariable(stmt.Name)
+
+	if stmt.SuperClass != nil {
+		if stmt.SuperClass.Name.Lexeme == stmt.Name.Lexeme {
+			c.errs = append(c.errs, stmt.SuperClass.Name.ToRuntimeError(interpreter.E_INVALID_CLASS, "A class can't inherit from itself"))
+		}
+
+		// The superclass stays on the stack as the 'super' local that methods
+		// capture.
+		c.getVariable(stmt.SuperClass.Name)
+		c.beginScope()
+		c.addLocal(interpreter.SuperToken)
+
+		c.getVariable(stmt.Name)
+		c.at(stmt.SuperClass.Name)
+		c.emitOp(OP_INHERIT)
+	}
+
+	for _, field := range stmt.Fields {
+		c.error(field.Name, "Fields are not supported by the VM")
+	}
+	for _, method := range stmt.ClassMethods {
+		c.error(method.Name, "Class methods are not supported by the VM")
+	}
+	for _, field := range stmt.ClassFields {
+		c.error(field.Name, "Class fields are not supported by the VM")
+	}
+
+	enclosingClass := c.class
+	c.class = stmt.Name.Lexeme
+	defer func() { c.class = enclosingClass }()
+
+	c.getVariable(stmt.Name)
+	for _, method := range stmt.Methods {
+		functionType := FUNCTION_TYPE_METHOD
+		if method.Name.Lexeme == "init" {
+			functionType = FUNCTION_TYPE_INITIALIZER
+		}
+
+		c.checkSync(method.Name, method.IsAsync)
+		if method.IsGetter {
+			c.error(method.Name, "Getters are not supported by the VM")
+		}
+		if interpreter.IsOperatorMethod(method.Name.Lexeme) {
+			c.error(method.Name, "Operator methods are not supported by the VM")
+		}
+		if method.Name.Lexeme == "toString" {
+			c.error(method.Name, "toString methods are not supported by the VM")
+		}
+		c.function(method.Name, method.Params, method.Body, functionType)
+		c.at(method.Name)
+		c.emitOpShort(OP_METHOD, c.makeConstant(method.Name.Lexeme))
+	}
+	c.emitOp(OP_POP)
+
+	if stmt.SuperClass != nil {
+		c.endScope()
+	}
+
+	return nil
+}
+
+func (c *Compiler) VisitBlockStmt(stmt *interpreter.BlockStmt) interface{} {
+	c.beginScope()
+	for _, s := range stmt.Statements {
+		s.Accept(c)
+	}
+	c.endScope()
+
+	return nil
+}
+
+func (c *Compiler) VisitReturnStmt(stmt *interpreter.ReturnStmt) interface{} {
+	c.at(stmt.Keyword)
+	if c.current.functionType == FUNCTION_TYPE_SCRIPT {
+		c.errs = append(c.errs, stmt.Keyword.ToRuntimeError(interpreter.E_UNEXPECTED_RETURN, "unexpected return in current scope"))
+		return nil
+	}
+
+	if stmt.Expression == nil || c.current.functionType == FUNCTION_TYPE_INITIALIZER {
+		if stmt.Expression != nil {
+			stmt.Expression.Accept(c)
+			c.at(stmt.Keyword)
+			c.emitOp(OP_POP)
+		}
+		c.leaveTries(0)
+		c.emitReturn()
+		return nil
+	}
+
+	if len(c.current.tries) == 0 {
+		stmt.Expression.Accept(c)
+		c.at(stmt.Keyword)
+		c.emitOp(OP_RETURN)
+		return nil
+	}
+
+	// The return value is kept in a hidden local while finally blocks run.
+	c.beginScope()
+	stmt.Expression.Accept(c)
+	c.addLocal(interpreter.Token{Lexeme: " return", Line: stmt.Keyword.Line})
+	c.leaveTries(0)
+	c.at(stmt.Keyword)
+	c.emitOpByte(OP_GET_LOCAL, byte(len(c.current.locals)-1))
+	c.emitOp(OP_RETURN)
+	c.endScope()
+
+	return nil
+}
+
+// leaveTries unwinds the try statements nested deeper than depth, innermost
+// first, before a jump out of them.
+func (c *Compiler) leaveTries(depth int) {
+	tries := c.current.tries
+	for idx := len(tries) - 1; idx >= depth; idx-- {
+		if tries[idx].handler {
+			c.emitOp(OP_POP_HANDLER)
+		}
+
+		if tries[idx].finally != nil {
+			c.current.tries = tries[:idx]
+			tries[idx].finally.Accept(c)
+			c.current.tries = tries
+		}
+	}
+}
+
+func (c *Compiler) VisitImportStmt(stmt *interpreter.ImportStmt) interface{} {
+	c.error(stmt.Keyword, "Modules are not supported by the bytecode VM")
+	return nil
+}
+
+func (c *Compiler) VisitThrowStmt(stmt *interpreter.ThrowStmt) interface{} {
+	stmt.Expression.Accept(c)
+	c.at(stmt.Keyword)
+	c.emitOp(OP_THROW)
+	return nil
+}
+
+// VisitTryStmt installs a handler around the try block. When an error unwinds
+// to the handler it is pushed on the stack and the catch block, or the
+// finally block followed by a rethrow, runs.
+func (c *Compiler) VisitTryStmt(stmt *interpreter.TryStmt) interface{} {
+	c.at(stmt.Keyword)
+	handlerJump := c.emitJump(OP_TRY)
+
+	c.current.tries = append(c.current.tries, &tryBlock{handler: true, finally: stmt.FinallyBody})
+	stmt.Body.Accept(c)
+	c.current.tries = c.current.tries[:len(c.current.tries)-1]
+
+	c.at(stmt.Keyword)
+	c.emitOp(OP_POP_HANDLER)
+	exitJump := c.emitJump(OP_JUMP)
+	c.patchJump(handlerJump)
+
+	if stmt.CatchBody != nil {
+		c.beginScope()
+		c.emitOp(OP_CATCH)
+		c.addLocal(stmt.CatchName)
+
+		// Errors raised by the catch block still have to run the finally
+		// block.
+		catchHandlerJump := -1
+		if stmt.FinallyBody != nil {
+			catchHandlerJump = c.emitJump(OP_TRY)
+		}
+
+		c.current.tries = append(c.current.tries, &tryBlock{handler: catchHandlerJump >= 0, finally: stmt.FinallyBody})
+		for _, s := range stmt.CatchBody.Statements {
+			s.Accept(c)
+		}
+		c.current.tries = c.current.tries[:len(c.current.tries)-1]
+
+		if catchHandlerJump >= 0 {
+			c.at(stmt.Keyword)
+			c.emitOp(OP_POP_HANDLER)
+		}
+		c.endScope()
+
+		if catchHandlerJump >= 0 {
+			catchExitJump := c.emitJump(OP_JUMP)
+			c.patchJump(catchHandlerJump)
+
+			// The caught value is still on the stack below the new error.
+			c.beginScope()
+			c.addLocal(interpreter.Token{Lexeme: " caught", Line: stmt.Keyword.Line})
+			c.finallyThenRethrow(stmt)
+			c.endScope()
+
+			c.patchJump(catchExitJump)
+		}
+	} else {
+		c.finallyThenRethrow(stmt)
+	}
+
+	c.patchJump(exitJump)
+	if stmt.FinallyBody != nil {
+		stmt.FinallyBody.Accept(c)
+	}
+
+	return nil
+}
+
+func (c *Compiler) finallyThenRethrow(stmt *interpreter.TryStmt) {
+	c.beginScope()
+	c.addLocal(interpreter.Token{Lexeme: " error", Line: stmt.Keyword.Line})
+	stmt.FinallyBody.Accept(c)
+	c.at(stmt.Keyword)
+	c.emitOpByte(OP_GET_LOCAL, byte(len(c.current.locals)-1))
+	c.emitOp(OP_THROW)
+	c.endScope()
+}
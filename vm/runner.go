@@ -0,0 +1,23 @@
+package vm
+
+import "github.com/cgrunewald/golox/interpreter"
+
+func RunProgram(config interpreter.InterpreterConfig, program string) []error {
+	stmts, errs := interpreter.Compile(program, interpreter.NewResolver(nil))
+	if len(errs) > 0 {
+		return errs
+	}
+
+	vm := NewVM(config)
+	fn, errs := vm.Compile(stmts)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	_, err := vm.Run(fn)
+	if err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package vm
+
+import "fmt"
+
+type Function struct {
+	name         string
+	class        string
+	arity        int
+	upvalueCount int
+	chunk        *Chunk
+}
+
+func (f *Function) String() string {
+	if f.name == "" {
+		return "<script>"
+	}
+	return f.name
+}
+
+func (f *Function) Disassemble() string {
+	return f.chunk.Disassemble(f.String())
+}
+
+type Closure struct {
+	function *Function
+	upvalues []*Upvalue
+}
+
+func (c *Closure) String() string {
+	return c.function.name
+}
+
+func (c *Closure) TypeName() string {
+	return "function"
+}
+
+// Upvalue points at a stack slot while the captured variable is still live,
+// and holds the value itself once the variable goes out of scope.
+type Upvalue struct {
+	slot   int
+	closed interface{}
+	isOpen bool
+	next   *Upvalue
+}
+
+func (u *Upvalue) get(vm *VM) interface{} {
+	if u.isOpen {
+		return vm.stack[u.slot]
+	}
+	return u.closed
+}
+
+func (u *Upvalue) set(vm *VM, value interface{}) {
+	if u.isOpen {
+		vm.stack[u.slot] = value
+	} else {
+		u.closed = value
+	}
+}
+
+type Class struct {
+	name    string
+	methods map[string]*Closure
+}
+
+func NewClass(name string) *Class {
+	return &Class{name: name, methods: make(map[string]*Closure)}
+}
+
+func (c *Class) String() string {
+	return c.name
+}
+
+func (c *Class) TypeName() string {
+	return "class"
+}
+
+type Instance struct {
+	class  *Class
+	fields map[string]interface{}
+}
+
+func NewInstance(class *Class) *Instance {
+	return &Instance{class: class, fields: make(map[string]interface{})}
+}
+
+func (i *Instance) String() string {
+	return fmt.Sprintf("%v instance", i.class)
+}
+
+func (i *Instance) TypeName() string {
+	return "instance"
+}
+
+func (i *Instance) Get(property string) (interface{}, bool) {
+	if val, ok := i.fields[property]; ok {
+		return val, true
+	}
+
+	method, ok := i.class.methods[property]
+	if !ok {
+		return nil, false
+	}
+
+	return &BoundMethod{receiver: i, method: method}, true
+}
+
+func (i *Instance) Set(property string, value interface{}) {
+	i.fields[property] = value
+}
+
+type BoundMethod struct {
+	receiver interface{}
+	method   *Closure
+}
+
+func (b *BoundMethod) String() string {
+	return b.method.String()
+}
+
+func (b *BoundMethod) TypeName() string {
+	return "function"
+}
+
+// undefinedValue marks global slots that have been referenced by compiled
+// code but not yet defined at runtime.
+type undefinedValue struct{}
+
+var undefined = &undefinedValue{}
+
+type globalTable struct {
+	slots  map[string]uint16
+	values []interface{}
+}
+
+func newGlobalTable() *globalTable {
+	return &globalTable{slots: make(map[string]uint16), values: make([]interface{}, 0)}
+}
+
+func (g *globalTable) slot(name string) (uint16, bool) {
+	if idx, ok := g.slots[name]; ok {
+		return idx, true
+	}
+
+	if len(g.values) > maxShort {
+		return 0, false
+	}
+
+	idx := uint16(len(g.values))
+	g.slots[name] = idx
+	g.values = append(g.values, undefined)
+	return idx, true
+}
+
+func (g *globalTable) define(name string, value interface{}) {
+	if idx, ok := g.slot(name); ok {
+		g.values[idx] = value
+	}
+}
+
+func isTruthy(value interface{}) bool {
+	if b, ok := value.(bool); ok {
+		return b
+	}
+
+	return false
+}
@@ -0,0 +1,771 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/cgrunewald/golox/interpreter"
+)
+
+const (
+	maxFrames        = 4096
+	initialStackSize = 1024
+)
+
+type callFrame struct {
+	closure *Closure
+	ip      int
+	base    int
+}
+
+// handler is an active try block. Errors unwind the frames and the stack
+// back to where the try block started and resume at ip.
+type handler struct {
+	frameCount int
+	sp         int
+	ip         int
+}
+
+// VM executes compiled bytecode on a value stack. Natives registered through
+// the InterpreterConfig are called with a host interpreter that shares the
+// configuration of the VM.
+type VM struct {
+	config       interpreter.InterpreterConfig
+	host         *interpreter.Interpreter
+	globals      *globalTable
+	stack        []interface{}
+	sp           int
+	frames       []callFrame
+	handlers     []handler
+	openUpvalues *Upvalue
+	limited      bool
+	steps        int
+	memory       interpreter.MemoryStats
+}
+
+func NewVM(config interpreter.InterpreterConfig) *VM {
+	globals := newGlobalTable()
+	globals.define("clock", interpreter.ClockFunc)
+
+	// Natives are defined in a stable order so that global slots do not
+	// change between runs.
+	stdlib := interpreter.StandardLibrary()
+	names := make([]string, 0, len(stdlib))
+	for name := range stdlib {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		globals.define(name, stdlib[name])
+	}
+
+	if config.GlobalFuncOverrides != nil {
+		for key, value := range config.GlobalFuncOverrides {
+			globals.define(key, value)
+		}
+	}
+
+	return &VM{
+		config:  config,
+		host:    interpreter.NewInterpreter(config),
+		globals: globals,
+		stack:   make([]interface{}, initialStackSize),
+		frames:  make([]callFrame, 0, 64),
+		limited: config.MaxSteps > 0 || config.MaxMemory > 0 || config.Context != nil,
+	}
+}
+
+func (vm *VM) Compile(stmts []interpreter.Stmt) (*Function, []error) {
+	return NewCompiler(vm.globals).Compile(stmts)
+}
+
+func (vm *VM) Interpret(stmts []interpreter.Stmt) (interface{}, error) {
+	fn, errs := vm.Compile(stmts)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return vm.Run(fn)
+}
+
+func (vm *VM) InterpretExpr(expr interpreter.Expr) (interface{}, error) {
+	fn, errs := NewCompiler(vm.globals).CompileExpr(expr)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return vm.Run(fn)
+}
+
+func (vm *VM) Run(fn *Function) (interface{}, error) {
+	closure := &Closure{function: fn, upvalues: make([]*Upvalue, 0)}
+	vm.steps = 0
+	vm.memory = interpreter.MemoryStats{}
+	vm.push(closure)
+	if err := vm.call(closure, 0); err != nil {
+		vm.reset()
+		return nil, err
+	}
+
+	return vm.run()
+}
+
+func (vm *VM) reset() {
+	for idx := 0; idx < vm.sp; idx++ {
+		vm.stack[idx] = nil
+	}
+	vm.sp = 0
+	vm.frames = vm.frames[:0]
+	vm.handlers = vm.handlers[:0]
+	vm.openUpvalues = nil
+}
+
+func (vm *VM) push(value interface{}) {
+	if vm.sp == len(vm.stack) {
+		vm.stack = append(vm.stack, value)
+	} else {
+		vm.stack[vm.sp] = value
+	}
+	vm.sp++
+}
+
+func (vm *VM) pop() interface{} {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) peek(distance int) interface{} {
+	return vm.stack[vm.sp-1-distance]
+}
+
+// currentToken describes the instruction currently executing in the innermost
+// frame.
+func (vm *VM) currentToken() interpreter.Token {
+	frame := &vm.frames[len(vm.frames)-1]
+	pos := frame.closure.function.chunk.positions[frame.ip-1]
+	return interpreter.Token{
+		TokenType: interpreter.TK_IDENTIFIER,
+		Lexeme:    pos.lexeme,
+		Line:      pos.line,
+		Column:    pos.column,
+		Offset:    pos.offset,
+	}
+}
+
+// runtimeError reports an error at the instruction currently executing in the
+// innermost frame.
+func (vm *VM) runtimeError(errType int32, message string) error {
+	return vm.currentToken().ToRuntimeError(errType, message)
+}
+
+// nativeError positions errors returned by natives and indexable values at the
+// current instruction.
+func (vm *VM) nativeError(err error) error {
+	return interpreter.AtToken(err, vm.currentToken())
+}
+
+// addStackTrace records the frames above depth, innermost first, on err. The
+// call site of a frame is the instruction its caller is executing.
+func (vm *VM) addStackTrace(err error, depth int) {
+	for idx := len(vm.frames) - 1; idx > 0 && idx >= depth; idx-- {
+		fn := vm.frames[idx].closure.function
+		caller := &vm.frames[idx-1]
+		pos := caller.closure.function.chunk.positions[caller.ip-1]
+
+		interpreter.AddStackFrame(err, interpreter.StackFrame{
+			Function: interpreter.FunctionName(fn.name),
+			Class:    fn.class,
+			Line:     pos.line,
+			File:     vm.config.ScriptPath,
+		})
+	}
+}
+
+// unwind resumes execution at the innermost try handler with the error on
+// top of the stack. It reports false when no handler is active.
+func (vm *VM) unwind(err error) bool {
+	if len(vm.handlers) == 0 || !interpreter.IsLoxError(err) || interpreter.IsUncatchable(err) {
+		return false
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.addStackTrace(err, h.frameCount)
+
+	vm.closeUpvalues(h.sp)
+	vm.frames = vm.frames[:h.frameCount]
+	vm.sp = h.sp
+	vm.push(err)
+	vm.frames[h.frameCount-1].ip = h.ip
+	return true
+}
+
+// checkLimits counts the current instruction against the step budget and
+// stops the program once it is spent or its context is done.
+func (vm *VM) checkLimits() error {
+	vm.steps++
+	if max := vm.config.MaxSteps; max > 0 && vm.steps > max {
+		return vm.runtimeError(interpreter.E_STEP_LIMIT_EXCEEDED, fmt.Sprintf("Exceeded the limit of %d steps", max))
+	}
+
+	if vm.memory.Exceeds(vm.config.MaxMemory) {
+		return vm.memoryError()
+	}
+
+	if ctx := vm.config.Context; ctx != nil {
+		select {
+		case <-ctx.Done():
+			return vm.runtimeError(interpreter.E_CANCELLED, fmt.Sprintf("Cancelled: %v", ctx.Err()))
+		default:
+		}
+	}
+	return nil
+}
+
+func (vm *VM) memoryError() error {
+	message := fmt.Sprintf("Exceeded the memory limit of %d bytes", vm.config.MaxMemory)
+	return vm.runtimeError(interpreter.E_MEMORY_LIMIT_EXCEEDED, message)
+}
+
+// MemoryStats reports the memory allocated by the last call to Run. The VM
+// keeps locals on its stack, so it allocates no environments.
+func (vm *VM) MemoryStats() interpreter.MemoryStats {
+	return vm.memory
+}
+
+func (vm *VM) call(closure *Closure, argCount int) error {
+	if argCount != closure.function.arity {
+		return vm.runtimeError(interpreter.E_INVALID_ARGUMENTS, "Provided arguments do not match function definition")
+	}
+
+	if len(vm.frames) == maxFrames {
+		return vm.runtimeError(interpreter.E_STACK_OVERFLOW, "Stack overflow")
+	}
+
+	// The script itself runs in the first frame.
+	if max := vm.config.MaxCallDepth; max > 0 && len(vm.frames) > max {
+		return vm.runtimeError(interpreter.E_CALL_DEPTH_EXCEEDED, fmt.Sprintf("Exceeded the limit of %d nested calls", max))
+	}
+
+	vm.frames = append(vm.frames, callFrame{closure: closure, ip: 0, base: vm.sp - argCount - 1})
+	return nil
+}
+
+func (vm *VM) callValue(callee interface{}, argCount int) error {
+	switch callee := callee.(type) {
+	case *Closure:
+		return vm.call(callee, argCount)
+	case *BoundMethod:
+		vm.stack[vm.sp-argCount-1] = callee.receiver
+		return vm.call(callee.method, argCount)
+	case *Class:
+		vm.memory.AddInstance()
+		vm.stack[vm.sp-argCount-1] = NewInstance(callee)
+		if init, ok := callee.methods["init"]; ok {
+			return vm.call(init, argCount)
+		}
+
+		if argCount != 0 {
+			return vm.runtimeError(interpreter.E_INVALID_ARGUMENTS, "Provided arguments do not match function definition")
+		}
+		return nil
+	case interpreter.Callable:
+		if callee.Arity() != argCount {
+			return vm.runtimeError(interpreter.E_INVALID_ARGUMENTS, "Provided arguments do not match function definition")
+		}
+
+		args := make([]interface{}, argCount)
+		copy(args, vm.stack[vm.sp-argCount:vm.sp])
+
+		// Native functions count what they allocate, such as list elements,
+		// on the host interpreter.
+		before := vm.host.MemoryStats()
+		result := callee.Call(vm.host, args)
+		vm.memory.Add(vm.host.MemoryStats().Since(before))
+		if err, ok := result.(error); ok {
+			return vm.nativeError(err)
+		}
+
+		if str, ok := result.(string); ok {
+			vm.memory.AddString(str)
+		}
+		vm.sp = vm.sp - argCount - 1
+		vm.push(result)
+		return nil
+	}
+
+	return vm.runtimeError(interpreter.E_CANNOT_CALL, "Can only call functions or classes")
+}
+
+func (vm *VM) invoke(name string, argCount int) error {
+	receiver := vm.peek(argCount)
+
+	if instance, ok := receiver.(*Instance); ok {
+		if field, ok := instance.fields[name]; ok {
+			vm.stack[vm.sp-argCount-1] = field
+			return vm.callValue(field, argCount)
+		}
+
+		method, ok := instance.class.methods[name]
+		if !ok {
+			return vm.runtimeError(interpreter.E_UNDEFINED_OBJECT_PROPERTY, "Property is not defined on object")
+		}
+		return vm.call(method, argCount)
+	}
+
+	object, ok := receiver.(interpreter.Gettable)
+	if !ok {
+		return vm.runtimeError(interpreter.E_NOT_AN_OBJECT, "Expression does not evaluate to an object")
+	}
+
+	value, ok := object.Get(name)
+	if !ok {
+		return vm.runtimeError(interpreter.E_UNDEFINED_OBJECT_PROPERTY, "Property is not defined on object")
+	}
+
+	vm.stack[vm.sp-argCount-1] = value
+	return vm.callValue(value, argCount)
+}
+
+func (vm *VM) captureUpvalue(slot int) *Upvalue {
+	var previous *Upvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		previous = upvalue
+		upvalue = upvalue.next
+	}
+
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	created := &Upvalue{slot: slot, isOpen: true, next: upvalue}
+	if previous == nil {
+		vm.openUpvalues = created
+	} else {
+		previous.next = created
+	}
+
+	return created
+}
+
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		upvalue.closed = vm.stack[upvalue.slot]
+		upvalue.isOpen = false
+		vm.openUpvalues = upvalue.next
+	}
+}
+
+func (vm *VM) arithmetic(op OpCode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	l, ok := left.(float64)
+	if !ok {
+		return vm.runtimeError(interpreter.E_UNEXPECTED_TYPE, "Left operand must be a number.")
+	}
+
+	r, ok := right.(float64)
+	if !ok {
+		return vm.runtimeError(interpreter.E_UNEXPECTED_TYPE, "Right operand must be a number.")
+	}
+
+	switch op {
+	case OP_SUBTRACT:
+		vm.push(l - r)
+	case OP_MULTIPLY:
+		vm.push(l * r)
+	case OP_DIVIDE:
+		vm.push(l / r)
+	default:
+		vm.push(l + r)
+	}
+
+	return nil
+}
+
+func (vm *VM) comparison(op OpCode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	var result bool
+	if l, ok := left.(string); ok {
+		r, ok := right.(string)
+		if !ok {
+			return vm.runtimeError(interpreter.E_UNEXPECTED_TYPE, "Right operand must be a string.")
+		}
+
+		switch op {
+		case OP_GREATER:
+			result = l > r
+		case OP_GREATER_EQUAL:
+			result = l >= r
+		case OP_LESS:
+			result = l < r
+		default:
+			result = l <= r
+		}
+	} else {
+		l, ok := left.(float64)
+		if !ok {
+			return vm.runtimeError(interpreter.E_UNEXPECTED_TYPE, "Left operand must be a number.")
+		}
+
+		r, ok := right.(float64)
+		if !ok {
+			return vm.runtimeError(interpreter.E_UNEXPECTED_TYPE, "Right operand must be a number.")
+		}
+
+		switch op {
+		case OP_GREATER:
+			result = l > r
+		case OP_GREATER_EQUAL:
+			result = l >= r
+		case OP_LESS:
+			result = l < r
+		default:
+			result = l <= r
+		}
+	}
+
+	vm.push(result)
+	return nil
+}
+
+// run executes the innermost frame until the script returns. Runtime errors
+// resume at the innermost try handler, or unwind the VM when there is none.
+func (vm *VM) run() (interface{}, error) {
+	for {
+		value, err := vm.execute()
+		if err == nil {
+			return value, nil
+		}
+
+		if !vm.unwind(err) {
+			vm.addStackTrace(err, 0)
+			vm.reset()
+			return nil, err
+		}
+	}
+}
+
+func (vm *VM) execute() (interface{}, error) {
+	frame := &vm.frames[len(vm.frames)-1]
+	chunk := frame.closure.function.chunk
+
+	readByte := func() byte {
+		b := chunk.Code[frame.ip]
+		frame.ip++
+		return b
+	}
+
+	readShort := func() int {
+		s := int(chunk.Code[frame.ip])<<8 | int(chunk.Code[frame.ip+1])
+		frame.ip += 2
+		return s
+	}
+
+	for {
+		op := OpCode(chunk.Code[frame.ip])
+		frame.ip++
+
+		if vm.limited {
+			if err := vm.checkLimits(); err != nil {
+				return nil, err
+			}
+		}
+
+		switch op {
+		case OP_CONSTANT:
+			vm.push(chunk.Constants[readShort()])
+		case OP_NIL:
+			vm.push(nil)
+		case OP_TRUE:
+			vm.push(true)
+		case OP_FALSE:
+			vm.push(false)
+		case OP_POP:
+			vm.sp--
+		case OP_GET_LOCAL:
+			vm.push(vm.stack[frame.base+int(readByte())])
+		case OP_SET_LOCAL:
+			vm.stack[frame.base+int(readByte())] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			value := vm.globals.values[readShort()]
+			if value == undefined {
+				return nil, vm.runtimeError(interpreter.E_UNDEFINED_VARIABLE, "Undefined variable")
+			}
+			vm.push(value)
+		case OP_DEFINE_GLOBAL:
+			vm.globals.values[readShort()] = vm.pop()
+		case OP_SET_GLOBAL:
+			idx := readShort()
+			if vm.globals.values[idx] == undefined {
+				return nil, vm.runtimeError(interpreter.E_UNDEFINED_VARIABLE, "Undefined variable")
+			}
+			vm.globals.values[idx] = vm.peek(0)
+		case OP_GET_UPVALUE:
+			vm.push(frame.closure.upvalues[readByte()].get(vm))
+		case OP_SET_UPVALUE:
+			frame.closure.upvalues[readByte()].set(vm, vm.peek(0))
+		case OP_GET_PROPERTY:
+			name := chunk.Constants[readShort()].(string)
+			object, ok := vm.peek(0).(interpreter.Gettable)
+			if !ok {
+				return nil, vm.runtimeError(interpreter.E_NOT_AN_OBJECT, "Expression does not evaluate to an object")
+			}
+
+			value, ok := object.Get(name)
+			if !ok {
+				return nil, vm.runtimeError(interpreter.E_UNDEFINED_OBJECT_PROPERTY, "Property is not defined on object")
+			}
+			vm.stack[vm.sp-1] = value
+		case OP_SET_PROPERTY:
+			name := chunk.Constants[readShort()].(string)
+			if settable, ok := vm.peek(1).(interpreter.Settable); ok {
+				value := vm.pop()
+				if err := settable.SetProperty(name, value); err != nil {
+					return nil, vm.nativeError(err)
+				}
+				vm.stack[vm.sp-1] = value
+				continue
+			}
+
+			instance, ok := vm.peek(1).(*Instance)
+			if !ok {
+				return nil, vm.runtimeError(interpreter.E_UNDEFINED_OBJECT_PROPERTY, "Property is not defined on object")
+			}
+
+			if _, ok := instance.fields[name]; !ok {
+				vm.memory.AddProperty()
+			}
+			value := vm.pop()
+			instance.Set(name, value)
+			vm.stack[vm.sp-1] = value
+		case OP_GET_SUPER:
+			name := chunk.Constants[readShort()].(string)
+			superclass := vm.pop().(*Class)
+			method, ok := superclass.methods[name]
+			if !ok {
+				return nil, vm.runtimeError(interpreter.E_UNDEFINED_OBJECT_PROPERTY, "Method does not exist on super")
+			}
+			vm.stack[vm.sp-1] = &BoundMethod{receiver: vm.peek(0), method: method}
+		case OP_EQUAL:
+			right := vm.pop()
+			vm.stack[vm.sp-1] = vm.stack[vm.sp-1] == right
+		case OP_NOT_EQUAL:
+			right := vm.pop()
+			vm.stack[vm.sp-1] = vm.stack[vm.sp-1] != right
+		case OP_GREATER, OP_GREATER_EQUAL, OP_LESS, OP_LESS_EQUAL:
+			if err := vm.comparison(op); err != nil {
+				return nil, err
+			}
+		case OP_ADD:
+			right, left := vm.peek(0), vm.peek(1)
+			if l, ok := left.(float64); ok {
+				if r, ok := right.(float64); ok {
+					vm.sp--
+					vm.stack[vm.sp-1] = l + r
+					continue
+				}
+			}
+
+			_, leftIsString := left.(string)
+			_, rightIsString := right.(string)
+			if leftIsString || rightIsString {
+				str := fmt.Sprintf("%v%v", left, right)
+				vm.memory.AddString(str)
+				if vm.memory.Exceeds(vm.config.MaxMemory) {
+					return nil, vm.memoryError()
+				}
+
+				vm.sp--
+				vm.stack[vm.sp-1] = str
+				continue
+			}
+
+			if err := vm.arithmetic(op); err != nil {
+				return nil, err
+			}
+		case OP_DIVIDE:
+			if r, ok := vm.peek(0).(float64); ok && r == 0.0 {
+				return nil, vm.runtimeError(interpreter.E_DIVIDE_BY_ZERO, "Cannot divide by zero.")
+			}
+
+			if err := vm.arithmetic(op); err != nil {
+				return nil, err
+			}
+		case OP_SUBTRACT, OP_MULTIPLY:
+			if err := vm.arithmetic(op); err != nil {
+				return nil, err
+			}
+		case OP_NOT:
+			vm.stack[vm.sp-1] = !isTruthy(vm.stack[vm.sp-1])
+		case OP_NEGATE:
+			number, ok := vm.peek(0).(float64)
+			if !ok {
+				return nil, vm.runtimeError(interpreter.E_UNEXPECTED_TYPE, "Operand must be a number.")
+			}
+			vm.stack[vm.sp-1] = -number
+		case OP_AND:
+			right := vm.pop()
+			vm.stack[vm.sp-1] = isTruthy(vm.stack[vm.sp-1]) && isTruthy(right)
+		case OP_PRINT:
+			value := vm.pop()
+			if vm.config.PrintFunc != nil {
+				vm.config.PrintFunc(fmt.Sprintf("%v", value))
+			}
+		case OP_JUMP:
+			offset := readShort()
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if !isTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := readShort()
+			frame.ip -= offset
+		case OP_CALL:
+			argCount := int(readByte())
+			if err := vm.callValue(vm.peek(argCount), argCount); err != nil {
+				return nil, err
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = frame.closure.function.chunk
+		case OP_INVOKE:
+			name := chunk.Constants[readShort()].(string)
+			argCount := int(readByte())
+			if err := vm.invoke(name, argCount); err != nil {
+				return nil, err
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = frame.closure.function.chunk
+		case OP_SUPER_INVOKE:
+			name := chunk.Constants[readShort()].(string)
+			argCount := int(readByte())
+			superclass := vm.pop().(*Class)
+			method, ok := superclass.methods[name]
+			if !ok {
+				return nil, vm.runtimeError(interpreter.E_UNDEFINED_OBJECT_PROPERTY, "Method does not exist on super")
+			}
+			if err := vm.call(method, argCount); err != nil {
+				return nil, err
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = frame.closure.function.chunk
+		case OP_CLOSURE:
+			fn := chunk.Constants[readShort()].(*Function)
+			closure := &Closure{function: fn, upvalues: make([]*Upvalue, fn.upvalueCount)}
+			vm.memory.AddClosure()
+			for idx := range closure.upvalues {
+				isLocal := readByte()
+				index := int(readByte())
+				if isLocal == 1 {
+					closure.upvalues[idx] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.upvalues[idx] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(closure)
+		case OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(vm.sp - 1)
+			vm.sp--
+		case OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			vm.frames = vm.frames[:len(vm.frames)-1]
+
+			if len(vm.frames) == 0 {
+				vm.reset()
+				return result, nil
+			}
+
+			vm.sp = frame.base
+			vm.push(result)
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = frame.closure.function.chunk
+		case OP_CLASS:
+			vm.push(NewClass(chunk.Constants[readShort()].(string)))
+		case OP_INHERIT:
+			superclass, ok := vm.peek(1).(*Class)
+			if !ok {
+				return nil, vm.runtimeError(interpreter.E_INVALID_CLASS, "Invalid super class")
+			}
+
+			subclass := vm.peek(0).(*Class)
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+			vm.sp--
+		case OP_METHOD:
+			name := chunk.Constants[readShort()].(string)
+			class := vm.peek(1).(*Class)
+			class.methods[name] = vm.pop().(*Closure)
+		case OP_LIST:
+			count := readShort()
+			elements := make([]interface{}, count)
+			copy(elements, vm.stack[vm.sp-count:vm.sp])
+			vm.sp = vm.sp - count
+			vm.memory.AddList(count)
+			vm.push(interpreter.NewList(elements))
+		case OP_MAP:
+			count := readShort()
+			m := interpreter.NewMap()
+			for idx := vm.sp - 2*count; idx < vm.sp; idx += 2 {
+				if err := m.Put(vm.stack[idx], vm.stack[idx+1]); err != nil {
+					return nil, vm.nativeError(err)
+				}
+			}
+			vm.sp = vm.sp - 2*count
+			vm.memory.AddMap(m.Len())
+			vm.push(m)
+		case OP_GET_INDEX:
+			indexable, ok := vm.peek(1).(interpreter.Indexable)
+			if !ok {
+				return nil, vm.runtimeError(interpreter.E_NOT_INDEXABLE, "Expression cannot be indexed")
+			}
+
+			value, err := indexable.GetIndex(vm.peek(0))
+			if err != nil {
+				return nil, vm.nativeError(err)
+			}
+			vm.sp--
+			vm.stack[vm.sp-1] = value
+		case OP_SET_INDEX:
+			indexable, ok := vm.peek(2).(interpreter.Indexable)
+			if !ok {
+				return nil, vm.runtimeError(interpreter.E_NOT_INDEXABLE, "Expression cannot be indexed")
+			}
+
+			m, isMap := indexable.(*interpreter.LoxMap)
+			entries := 0
+			if isMap {
+				entries = m.Len()
+			}
+
+			value := vm.peek(0)
+			if err := indexable.SetIndex(vm.peek(1), value); err != nil {
+				return nil, vm.nativeError(err)
+			}
+			if isMap && m.Len() > entries {
+				vm.memory.AddEntry()
+			}
+			vm.sp = vm.sp - 2
+			vm.stack[vm.sp-1] = value
+		case OP_TRY:
+			offset := readShort()
+			vm.handlers = append(vm.handlers, handler{frameCount: len(vm.frames), sp: vm.sp, ip: frame.ip + offset})
+		case OP_POP_HANDLER:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case OP_THROW:
+			return nil, interpreter.NewThrownError(vm.pop(), vm.currentToken())
+		case OP_CATCH:
+			vm.stack[vm.sp-1] = interpreter.CaughtValue(vm.stack[vm.sp-1].(error))
+		default:
+			return nil, vm.runtimeError(interpreter.E_UNEXPECTED_OPERATOR, fmt.Sprintf("Unknown opcode %d", op))
+		}
+	}
+}
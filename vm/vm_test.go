@@ -0,0 +1,155 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cgrunewald/golox/interpreter"
+)
+
+func parse(t *testing.T, program string) []interpreter.Stmt {
+	scanner := interpreter.NewScanner(program)
+	tokens := scanner.ScanTokens()
+	if scanner.HasError() {
+		t.Fatalf("scanner error: %v", scanner.Errors())
+	}
+
+	parser := interpreter.NewParser(tokens)
+	stmts := parser.Parse()
+	if parser.HasError() {
+		t.Fatalf("parser error: %v", parser.Errors())
+	}
+
+	return stmts
+}
+
+func TestInterpretExpr(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   interface{}
+	}{
+		{"1 == 1 ? 4 + 4 * 3 : false", 16.0},
+		{"\"ab\" + \"cd\"", "abcd"},
+		{"5 + \"cd\"", "5cd"},
+		{"-4", -4.0},
+		{"!!true", true},
+		{"4 <= 3", false},
+		{"\"a\" < \"b\"", true},
+		{"false or true", true},
+		{"true and false", false},
+	}
+
+	for _, test := range tests {
+		scanner := interpreter.NewScanner(test.expression)
+		parser := interpreter.NewParser(scanner.ScanTokens())
+		expr := parser.ParseExpr()
+		if parser.HasError() {
+			t.Fatalf("parser error: %v", parser.Errors())
+		}
+
+		result, err := NewVM(interpreter.InterpreterConfig{}).InterpretExpr(expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.expression, err)
+			continue
+		}
+
+		if result != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.expression, test.expected, result)
+		}
+	}
+}
+
+func TestGlobalsPersistAcrossRuns(t *testing.T) {
+	output := make([]string, 0)
+	vm := NewVM(interpreter.InterpreterConfig{PrintFunc: func(s string) { output = append(output, s) }})
+
+	if _, err := vm.Interpret(parse(t, "var a = 1; fun incr() { a = a + 1; return a; }")); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, err := vm.Interpret(parse(t, "print incr(); print a;")); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if strings.Join(output, ",") != "2,2" {
+		t.Errorf("expected 2,2, got %v", output)
+	}
+
+	// A runtime error must leave the VM usable.
+	if _, err := vm.Interpret(parse(t, "print undefinedVar;")); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	if _, err := vm.Interpret(parse(t, "print incr();")); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if output[len(output)-1] != "3" {
+		t.Errorf("expected 3, got %v", output[len(output)-1])
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	errs := RunProgram(interpreter.InterpreterConfig{}, "fun f() { f(); } f();")
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+
+	var loxError *interpreter.LoxError
+	if !errors.As(errs[0], &loxError) {
+		t.Fatalf("expected a lox error, got %v", errs[0])
+	}
+
+	if !strings.Contains(loxError.Error(), "Stack overflow") {
+		t.Errorf("expected a stack overflow, got %v", loxError)
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	vm := NewVM(interpreter.InterpreterConfig{})
+	program := `var s = "ab" + "cd"; class P {} var p = P(); p.x = 1; p.x = 2; fun f() { return 1; } f();`
+	if _, err := vm.Interpret(parse(t, program)); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := interpreter.MemoryStats{Total: 164, Strings: 20, Instances: 80, Closures: 64}
+	if vm.MemoryStats() != expected {
+		t.Errorf("expected %+v, got %+v", expected, vm.MemoryStats())
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	vm := NewVM(interpreter.InterpreterConfig{})
+	fn, errs := vm.Compile(parse(t, "fun add(a, b) { return a + b; } print add(1, 2);"))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	listing := fn.Disassemble()
+	for _, expected := range []string{"== <script> ==", "== add ==", "OP_CLOSURE", "OP_ADD", "OP_CALL", "OP_PRINT"} {
+		if !strings.Contains(listing, expected) {
+			t.Errorf("expected disassembly to contain %q:\n%s", expected, listing)
+		}
+	}
+}
+
+const fibProgram = `
+fun fib(n) {
+	if (n < 2) return n;
+	return fib(n - 1) + fib(n - 2);
+}
+print fib(20);
+`
+
+func BenchmarkFibVM(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		RunProgram(interpreter.InterpreterConfig{}, fibProgram)
+	}
+}
+
+func BenchmarkFibInterpreter(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		interpreter.RunProgram(interpreter.InterpreterConfig{}, fibProgram)
+	}
+}